@@ -0,0 +1,169 @@
+package pgparty
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+// relkind таблицы, секционированной таблицы, представления и материализованного представления
+const (
+	relKindTable            = "r"
+	relKindPartitionedTable = "p"
+	relKindView             = "v"
+	relKindMatView          = "m"
+)
+
+// relationKind returns pg_class.relkind of the relation in the store schema or empty string when it doesn't exist
+func (sr *PgStore) relationKind(ctx context.Context, name string) (string, error) {
+	kind := ""
+	err := sr.tx.GetContext(ctx, &kind, `SELECT coalesce((SELECT c.relkind::text FROM pg_class c
+	JOIN pg_namespace ns ON ns.oid = c.relnamespace
+	WHERE ns.nspname = $1 AND c.relname = $2), '')`, sr.Schema(), strings.ToLower(name))
+	return kind, err
+}
+
+// CurrentSchemaPrimaryKey returns primary key columns of the table in the key order
+func CurrentSchemaPrimaryKey(ctx context.Context, tablename string) ([]string, error) {
+	s, err := ShardFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("CurrentSchemaPrimaryKey: %w", err)
+	}
+	stx := s.Store
+	if stx == nil || stx.tx == nil {
+		return nil, fmt.Errorf("context must contains store transaction")
+	}
+	var ret []string
+	if err := stx.tx.SelectContext(ctx, &ret, `SELECT a.attname FROM pg_constraint c
+	JOIN pg_class t ON t.oid = c.conrelid
+	JOIN pg_namespace ns ON ns.oid = t.relnamespace
+	CROSS JOIN unnest(c.conkey) WITH ORDINALITY AS k(attnum, ord)
+	JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+	WHERE c.contype = 'p' AND ns.nspname = $1 AND t.relname = $2
+	ORDER BY k.ord`, stx.Schema(), strings.ToLower(tablename)); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+var reIndexColumn = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// AdoptedSQLModel builds the model config of an existing table from its live state.
+// Only indexes named by pgparty convention (table name + index name) are taken,
+// other indexes are listed as unmanaged and are left in the table by the following migrations.
+func AdoptedSQLModel(tname string, colinfos []DBColInfo, pks []string, dbidxs DBIndexDefs) *modelcols.SQLModel {
+	ret := &modelcols.SQLModel{
+		Table: tname,
+	}
+	for _, ci := range colinfos {
+		col := modelcols.SQLColumn{
+			ColName:  ci.Name,
+			DataType: ci.SQLDataType(),
+			NotNull:  strings.EqualFold(ci.IsNullable, "NO"),
+		}
+		for _, pk := range pks {
+			if strings.EqualFold(pk, ci.Name) {
+				col.PrimaryKey = true
+			}
+		}
+		if ci.Identity != nil {
+			col.Identity = *ci.Identity
+		}
+		if ci.Generated != nil {
+			col.Generated = *ci.Generated
+		}
+		if ci.Default != nil {
+			if strings.HasPrefix(*ci.Default, "nextval(") {
+				// последовательность колонки - это serial
+				switch col.DataType {
+				case "INT8":
+					col.DataType = "BIGSERIAL"
+				case "INT4":
+					col.DataType = "SERIAL"
+				}
+			} else if !col.PrimaryKey {
+				col.DefaultValue = *ci.Default
+			}
+		}
+		ret.Columns = append(ret.Columns, col)
+	}
+	sort.Slice(ret.Columns, func(i, j int) bool {
+		return ret.Columns[i].ColName < ret.Columns[j].ColName
+	})
+
+	pfx := strings.ToLower(tname)
+	for _, dbidx := range dbidxs {
+		name := strings.ToLower(dbidx.Name)
+		if dbidx.Invalid {
+			continue
+		}
+		if !strings.HasPrefix(name, pfx) || len(name) == len(pfx) {
+			ret.Unmanaged = append(ret.Unmanaged, name)
+			continue
+		}
+		idx := modelcols.SQLIndex{
+			Name:     name[len(pfx):],
+			IsUnique: dbidx.IsUnique,
+			Where:    dbidx.Predicate,
+			With:     strings.Join(dbidx.Options, ","),
+		}
+		if len(dbidx.Method) > 0 && dbidx.Method != "btree" {
+			idx.MethodName = dbidx.Method
+		}
+		for _, f := range dbidx.Fields {
+			if reIndexColumn.MatchString(f) {
+				idx.Columns = append(idx.Columns, f)
+			} else {
+				idx.Expressions = append(idx.Expressions, f)
+			}
+		}
+		ret.Indexes = append(ret.Indexes, idx)
+	}
+	return ret
+}
+
+// adoptModel introspects the existing relation of the model that has no stored config
+func (sr *PgStore) adoptModel(ctx context.Context, md *ModelDesc, kind string, colinfos []DBColInfo,
+	dbidxs DBIndexDefs,
+) (*modelcols.SQLModel, error) {
+	if md.IsView() {
+		return &modelcols.SQLModel{
+			Table:          md.DatabaseName(),
+			IsView:         true,
+			IsMaterialized: kind == relKindMatView,
+		}, nil
+	}
+	if kind != relKindTable && kind != relKindPartitionedTable {
+		return nil, fmt.Errorf("can't adopt %s.%s: relation is not a table", sr.Schema(), md.DatabaseName())
+	}
+	pks, err := CurrentSchemaPrimaryKey(ctx, md.DatabaseName())
+	if err != nil {
+		return nil, fmt.Errorf("adoptModel CurrentSchemaPrimaryKey error: %w", err)
+	}
+	ret := AdoptedSQLModel(md.DatabaseName(), colinfos, pks, dbidxs)
+	if kind == relKindPartitionedTable {
+		if ret.Partition, err = CurrentSchemaPartition(ctx, md.DatabaseName()); err != nil {
+			return nil, fmt.Errorf("adoptModel CurrentSchemaPartition error: %w", err)
+		}
+	}
+	return ret, nil
+}
+
+// saveAdoptedModel stores the introspected config of adopted table before its alter diff is applied
+func (sr *PgStore) saveAdoptedModel(ctx context.Context, mp ModelPlan) error {
+	if err := (DbConfigTable{
+		TableName: mp.Table,
+		Storej:    mp.From,
+	}).SaveTable(ctx); err != nil {
+		return err
+	}
+	return sr.appendSchemaHistory(ctx, ModelPlan{
+		Model: mp.Model,
+		Table: mp.Table,
+		To:    mp.From,
+	})
+}
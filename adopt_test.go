@@ -0,0 +1,62 @@
+package pgparty
+
+import (
+	"testing"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+func TestAdoptedSQLModel(t *testing.T) {
+	intp := func(i int) *int { return &i }
+	strp := func(s string) *string { return &s }
+
+	colinfos := []DBColInfo{
+		{Name: "id", Type: "int8", IsNullable: "NO", Default: strp("nextval('sh.items_id_seq'::regclass)")},
+		{Name: "name", Type: "varchar", IsNullable: "NO", CharLen: intp(100), Default: strp("''::character varying")},
+		{Name: "price", Type: "numeric", IsNullable: "YES", NumLen: intp(10), NumScale: intp(2)},
+		{Name: "tags", Type: "_text", IsNullable: "YES"},
+		{Name: "active", Type: "bool", IsNullable: "NO"},
+	}
+	dbidxs := DBIndexDefs{
+		{Name: "itemsnameidx", Fields: StringArray{"name"}, Method: "btree", IsUnique: true},
+		{Name: "itemslowername", Fields: StringArray{"lower((name)::text)"}, Method: "btree", Predicate: "active"},
+		{Name: "legacy_idx", Fields: StringArray{"price"}, Method: "btree"},
+	}
+
+	got := AdoptedSQLModel("items", colinfos, []string{"id"}, dbidxs)
+	want := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "active", DataType: "BOOLEAN", NotNull: true},
+			{ColName: "id", DataType: "BIGSERIAL", NotNull: true, PrimaryKey: true},
+			{ColName: "name", DataType: "VARCHAR(100)", NotNull: true, DefaultValue: "''::character varying"},
+			{ColName: "price", DataType: "NUMERIC(10,2)"},
+			{ColName: "tags", DataType: "TEXT[]"},
+		},
+		Indexes: modelcols.SQLIndexes{
+			{Name: "nameidx", IsUnique: true, Columns: []string{"name"}},
+			{Name: "lowername", Expressions: []string{"lower((name)::text)"}, Where: "active"},
+		},
+		Unmanaged: []string{"legacy_idx"},
+	}
+	if got.String() != want.String() {
+		t.Errorf("adopted model:\n%s\nwant:\n%s", got, want)
+	}
+
+	// индекс вне соглашения об именах не удаляется и не считается расхождением
+	pt, err := SQLAlterTablePatch("sh", "items", got, got, colinfos, dbidxs, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pt.DropIndexes) != 0 {
+		t.Errorf("unmanaged index dropped: %v", pt.DropIndexes)
+	}
+	managed := DBIndexDefs{dbidxs[0], dbidxs[2]}
+	if !IndexesEqualToDBIndexes(&modelcols.SQLModel{
+		Table:     "items",
+		Indexes:   modelcols.SQLIndexes{{Name: "nameidx", IsUnique: true, Columns: []string{"name"}}},
+		Unmanaged: []string{"legacy_idx"},
+	}, managed) {
+		t.Error("unmanaged index is compared")
+	}
+}
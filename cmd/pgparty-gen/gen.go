@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/covrom/pgparty"
+	"github.com/covrom/pgparty/modelcols"
+)
+
+// goType is a Go type of the model field for the column type
+type goType struct {
+	Name     string // pgparty.UUIDv4
+	SQLType  string // тип, который дает Go тип, если отличается от колонки - нужен тэг sql
+	Nullable bool   // Go тип допускает NULL
+}
+
+var reNumeric = regexp.MustCompile(`^NUMERIC\((\d+),(\d+)\)$`)
+
+// columnGoType maps the column type from model config to pgparty type
+func columnGoType(col modelcols.SQLColumn) (goType, bool) {
+	null := !col.NotNull
+	pick := func(notnull, nullable, sqltype string) goType {
+		if null && len(nullable) > 0 {
+			return goType{"pgparty." + nullable, sqltype, true}
+		}
+		return goType{"pgparty." + notnull, sqltype, false}
+	}
+
+	dt := strings.ToUpper(col.DataType)
+	switch {
+	case dt == "TEXT[]", strings.HasPrefix(dt, "VARCHAR") && strings.HasSuffix(dt, "[]"):
+		return goType{"pgparty.TextArray", "TEXT[]", false}, true
+	case dt == "UUID":
+		return pick("UUIDv4", "NullUUIDv4", "UUID"), true
+	case dt == "TIMESTAMPTZ":
+		return pick("Time", "NullTime", "TIMESTAMPTZ"), true
+	case dt == "TEXT":
+		return pick("Text", "NullText", "TEXT"), true
+	case dt == "VARCHAR", strings.HasPrefix(dt, "VARCHAR("):
+		return pick("String", "NullString", "VARCHAR"), true
+	case dt == "BOOLEAN":
+		return pick("Bool", "NullBool", "BOOLEAN"), true
+	case dt == "INT8", dt == "BIGINT":
+		return pick("Int64", "NullInt64", "BIGINT"), true
+	case dt == "INT4", dt == "INT2":
+		return pick("Int64", "NullInt64", "BIGINT"), true
+	case dt == "BIGSERIAL":
+		return goType{"pgparty.BigSerial", "BIGSERIAL", true}, true
+	case dt == "FLOAT8", dt == "FLOAT4":
+		return pick("Float64", "NullFloat64", "FLOAT8"), true
+	case dt == "JSONB":
+		return pick("JsonB", "NullJsonB", "JSONB"), true
+	case dt == "BYTEA":
+		return goType{"[]byte", "BYTEA", false}, true
+	case dt == "NUMERIC(15,2)":
+		return pick("Decimal152", "NullDecimal152", dt), true
+	case dt == "NUMERIC(15,3)":
+		return pick("Decimal153", "NullDecimal153", dt), true
+	case dt == "NUMERIC(19,2)":
+		return pick("Decimal192", "NullDecimal192", dt), true
+	case reNumeric.MatchString(dt):
+		// NUMERIC(ln,prec) задается тэгами len и prec, по умолчанию NUMERIC(19,6)
+		return pick("Decimal", "NullDecimal", "NUMERIC(19,6)"), true
+	}
+	// неизвестный тип читается как текст, тип колонки задается тэгом sql
+	return pick("Text", "NullText", "TEXT"), false
+}
+
+var initialisms = map[string]string{
+	"id":   "ID",
+	"uuid": "UUID",
+	"xid":  "XID",
+	"url":  "URL",
+	"uri":  "URI",
+	"api":  "API",
+	"ip":   "IP",
+	"json": "JSON",
+	"http": "HTTP",
+	"sql":  "SQL",
+}
+
+// sameSQLType reports whether the types are the same or aliases, e.g. INT8 and BIGINT
+func sameSQLType(a, b string) bool {
+	change, _ := pgparty.ClassifyColumnTypeChange("", a, b)
+	return change == pgparty.TypeChangeNone
+}
+
+// goName converts the snake case database name to the Go identifier
+func goName(s string) string {
+	var b strings.Builder
+	for _, p := range strings.Split(s, "_") {
+		if len(p) == 0 {
+			continue
+		}
+		if ini, ok := initialisms[strings.ToLower(p)]; ok {
+			b.WriteString(ini)
+			continue
+		}
+		b.WriteString(strings.ToUpper(p[:1]) + p[1:])
+	}
+	ret := b.String()
+	if len(ret) == 0 || (ret[0] >= '0' && ret[0] <= '9') {
+		ret = "F" + ret
+	}
+	return ret
+}
+
+// jsonName converts the snake case database name to the lower camel case json name
+func jsonName(s string) string {
+	var b strings.Builder
+	for _, p := range strings.Split(s, "_") {
+		if len(p) == 0 {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString(strings.ToLower(p))
+			continue
+		}
+		b.WriteString(strings.ToUpper(p[:1]) + strings.ToLower(p[1:]))
+	}
+	return b.String()
+}
+
+type genField struct {
+	Name string
+	Type string
+	Tags [][2]string
+}
+
+func (f *genField) tag(k, v string) {
+	for i := range f.Tags {
+		if f.Tags[i][0] == k {
+			f.Tags[i][1] += "," + v
+			return
+		}
+	}
+	f.Tags = append(f.Tags, [2]string{k, v})
+}
+
+func (f genField) tagString() string {
+	parts := make([]string, 0, len(f.Tags))
+	for _, t := range f.Tags {
+		parts = append(parts, fmt.Sprintf("%s:%q", t[0], t[1]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// genModel is a model struct generated from the table
+type genModel struct {
+	Name        string
+	Table       string
+	Fields      []genField
+	Indexes     []pgparty.ModelIndex
+	Constraints []pgparty.ModelConstraint
+
+	Partition *modelcols.SQLPartition
+}
+
+// tagIndex reports that the index is expressed by key, unikey or ginkey tag of one field
+func tagIndex(idx modelcols.SQLIndex) bool {
+	return len(idx.Columns) == 1 && len(idx.Expressions) == 0 && len(idx.Include) == 0 &&
+		len(idx.Where) == 0 && len(idx.With) == 0 && len(idx.Options) == 0
+}
+
+func newGenModel(sqm *modelcols.SQLModel) genModel {
+	ret := genModel{
+		Name:      goName(sqm.Table),
+		Table:     sqm.Table,
+		Partition: sqm.Partition,
+	}
+	// колонки первичного ключа - первыми
+	cols := make(modelcols.SQLColumns, len(sqm.Columns))
+	copy(cols, sqm.Columns)
+	sort.SliceStable(cols, func(i, j int) bool { return cols[i].PrimaryKey && !cols[j].PrimaryKey })
+
+	fieldByCol := make(map[string]int)
+	for _, col := range cols {
+		gt, known := columnGoType(col)
+		f := genField{
+			Name: goName(col.ColName),
+			Type: gt.Name,
+		}
+		f.tag("json", jsonName(col.ColName))
+		if pgparty.ToSnakeCase2(f.Name) != col.ColName {
+			f.tag(pgparty.TagDBName, col.ColName)
+		}
+		if m := reNumeric.FindStringSubmatch(strings.ToUpper(col.DataType)); known && m != nil &&
+			gt.SQLType != strings.ToUpper(col.DataType) {
+			f.tag(pgparty.TagLen, m[1])
+			f.tag(pgparty.TagPrec, m[2])
+		} else if !known || !sameSQLType(gt.SQLType, col.DataType) {
+			f.tag(pgparty.TagSql, col.DataType)
+		}
+		if gt.Nullable == col.NotNull {
+			f.tag("nullable", fmt.Sprint(!col.NotNull))
+		}
+		if col.PrimaryKey != (f.Name == pgparty.IDField) {
+			if col.PrimaryKey {
+				f.tag(pgparty.TagPK, "")
+			} else {
+				f.tag(pgparty.TagPK, "-")
+			}
+		}
+		if len(col.DefaultValue) > 0 {
+			f.tag(pgparty.TagDefVal, col.DefaultValue)
+		}
+		if len(col.Identity) > 0 {
+			f.tag(pgparty.TagIdentity, strings.ToLower(col.Identity))
+		}
+		if len(col.Generated) > 0 {
+			f.tag(pgparty.TagGenerated, col.Generated)
+		}
+		fieldByCol[col.ColName] = len(ret.Fields)
+		ret.Fields = append(ret.Fields, f)
+	}
+
+	idxs := make(modelcols.SQLIndexes, len(sqm.Indexes))
+	copy(idxs, sqm.Indexes)
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i].Name < idxs[j].Name })
+
+	fieldNames := func(cols []string) []string {
+		ret := make([]string, 0, len(cols))
+		for _, c := range cols {
+			ret = append(ret, goName(c))
+		}
+		return ret
+	}
+
+	for _, idx := range idxs {
+		fi, ok := -1, false
+		if tagIndex(idx) {
+			fi, ok = fieldByCol[idx.Columns[0]]
+		}
+		if ok {
+			f := &ret.Fields[fi]
+			switch {
+			case idx.IsUnique:
+				f.tag(pgparty.TagUniqueKey, strings.TrimSpace(idx.Name+" "+idx.MethodName))
+			case idx.MethodName == "gin":
+				f.tag(pgparty.TagGinKey, idx.Name)
+			default:
+				f.tag(pgparty.TagKey, strings.TrimSpace(idx.Name+" "+idx.MethodName))
+			}
+			continue
+		}
+		ret.Indexes = append(ret.Indexes, pgparty.ModelIndex{
+			Name:        idx.Name,
+			Fields:      fieldNames(idx.Columns),
+			Expressions: idx.Expressions,
+			Include:     fieldNames(idx.Include),
+			Unique:      idx.IsUnique,
+			Method:      idx.MethodName,
+			Where:       idx.Where,
+			With:        idx.With,
+		})
+	}
+
+	// ограничения сохраняют свои имена, иначе первая миграция пересоздаст их
+	for _, c := range sqm.Constraints {
+		mc := pgparty.ModelConstraint{Name: c.Name}
+		if c.Type == modelcols.ConstraintUnique {
+			mc.Unique = fieldNames(c.Columns)
+		} else {
+			mc.Check = c.Expr
+		}
+		ret.Constraints = append(ret.Constraints, mc)
+	}
+	return ret
+}
+
+var (
+	reUniqueDef = regexp.MustCompile(`^UNIQUE \(([^()]+)\)$`)
+	reCheckDef  = regexp.MustCompile(`^CHECK \((.+)\)$`)
+)
+
+// dbConstraints converts UNIQUE and CHECK constraints printed by pg_get_constraintdef to the model config,
+// constraints of other forms are skipped with a warning
+func dbConstraints(table string, dbcons pgparty.DBConstraintDefs) modelcols.SQLConstraints {
+	var ret modelcols.SQLConstraints
+	for _, dbc := range dbcons {
+		switch dbc.Type {
+		case "u":
+			if m := reUniqueDef.FindStringSubmatch(dbc.Def); m != nil {
+				var cols []string
+				for _, c := range strings.Split(m[1], ",") {
+					cols = append(cols, strings.Trim(strings.TrimSpace(c), `"`))
+				}
+				ret = append(ret, modelcols.SQLConstraint{Name: dbc.Name, Type: modelcols.ConstraintUnique, Columns: cols})
+				continue
+			}
+		case "c":
+			if m := reCheckDef.FindStringSubmatch(dbc.Def); m != nil {
+				ret = append(ret, modelcols.SQLConstraint{Name: dbc.Name, Type: modelcols.ConstraintCheck, Expr: m[1]})
+				continue
+			}
+		default:
+			continue
+		}
+		log.Printf("table %s: constraint %s is skipped, declare it manually: %s", table, dbc.Name, dbc.Def)
+	}
+	return ret
+}
+
+// Generate renders Go source of model structs for the tables
+func Generate(pkg string, tables []*modelcols.SQLModel) ([]byte, error) {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "// Models are generated by pgparty-gen from the existing database schema.\n\npackage %s\n\n", pkg)
+	fmt.Fprintf(b, "import \"github.com/covrom/pgparty\"\n")
+
+	for _, sqm := range tables {
+		m := newGenModel(sqm)
+		fmt.Fprintf(b, "\n// %s is a model of %s table\ntype %s struct {\n", m.Name, m.Table, m.Name)
+		for _, f := range m.Fields {
+			fmt.Fprintf(b, "\t%s %s `%s`\n", f.Name, f.Type, f.tagString())
+		}
+		fmt.Fprintf(b, "}\n\n")
+		fmt.Fprintf(b, "func (%s) DatabaseName() string { return %q }\n", m.Name, m.Table)
+		fmt.Fprintf(b, "func (%s) TypeName() pgparty.TypeName {\n\treturn pgparty.StructModel[%s]{}.TypeName()\n}\n", m.Name, m.Name)
+		fmt.Fprintf(b, "func (%s) Fields() []pgparty.FieldDescription {\n\treturn pgparty.StructModel[%s]{}.Fields()\n}\n", m.Name, m.Name)
+		if len(m.Indexes) > 0 {
+			fmt.Fprintf(b, "func (%s) Indexes() []pgparty.ModelIndex {\n\treturn []pgparty.ModelIndex{\n", m.Name)
+			for _, mi := range m.Indexes {
+				fmt.Fprintf(b, "\t\t%s,\n", modelIndexLiteral(mi))
+			}
+			fmt.Fprintf(b, "\t}\n}\n")
+		}
+		if len(m.Constraints) > 0 {
+			fmt.Fprintf(b, "func (%s) Constraints() []pgparty.ModelConstraint {\n\treturn []pgparty.ModelConstraint{\n", m.Name)
+			for _, mc := range m.Constraints {
+				fmt.Fprintf(b, "\t\t%s,\n", modelConstraintLiteral(mc))
+			}
+			fmt.Fprintf(b, "\t}\n}\n")
+		}
+		if m.Partition != nil {
+			fields := make([]string, 0, len(m.Partition.Columns))
+			for _, c := range m.Partition.Columns {
+				fields = append(fields, fmt.Sprintf("%q", goName(c)))
+			}
+			fmt.Fprintf(b, "func (%s) Partitioning() pgparty.ModelPartitioning {\n", m.Name)
+			fmt.Fprintf(b, "\treturn pgparty.ModelPartitioning{Method: pgparty.Partition%s, Fields: []string{%s}}\n}\n",
+				partitionMethodName(m.Partition.Method), strings.Join(fields, ", "))
+		}
+	}
+	return format.Source(b.Bytes())
+}
+
+func modelIndexLiteral(mi pgparty.ModelIndex) string {
+	parts := []string{fmt.Sprintf("Name: %q", mi.Name)}
+	strs := func(k string, ss []string) {
+		if len(ss) == 0 {
+			return
+		}
+		qs := make([]string, 0, len(ss))
+		for _, s := range ss {
+			qs = append(qs, fmt.Sprintf("%q", s))
+		}
+		parts = append(parts, fmt.Sprintf("%s: []string{%s}", k, strings.Join(qs, ", ")))
+	}
+	str := func(k, s string) {
+		if len(s) > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %q", k, s))
+		}
+	}
+	strs("Fields", mi.Fields)
+	strs("Expressions", mi.Expressions)
+	strs("Include", mi.Include)
+	if mi.Unique {
+		parts = append(parts, "Unique: true")
+	}
+	str("Method", mi.Method)
+	str("Where", mi.Where)
+	str("With", mi.With)
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func modelConstraintLiteral(mc pgparty.ModelConstraint) string {
+	if len(mc.Unique) > 0 {
+		qs := make([]string, 0, len(mc.Unique))
+		for _, s := range mc.Unique {
+			qs = append(qs, fmt.Sprintf("%q", s))
+		}
+		return fmt.Sprintf("{Name: %q, Unique: []string{%s}}", mc.Name, strings.Join(qs, ", "))
+	}
+	return fmt.Sprintf("{Name: %q, Check: %q}", mc.Name, mc.Check)
+}
+
+func partitionMethodName(method string) string {
+	switch strings.ToUpper(method) {
+	case string(pgparty.PartitionList):
+		return "List"
+	case string(pgparty.PartitionHash):
+		return "Hash"
+	}
+	return "Range"
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/covrom/pgparty"
+	"github.com/covrom/pgparty/modelcols"
+)
+
+func TestGenerate(t *testing.T) {
+	sqm := &modelcols.SQLModel{
+		Table: "shop_items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "created_at", DataType: "TIMESTAMPTZ", NotNull: true, DefaultValue: "now()"},
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "name", DataType: "VARCHAR(100)", NotNull: true},
+			{ColName: "owner_id", DataType: "UUID"},
+			{ColName: "price", DataType: "NUMERIC(12,4)"},
+			{ColName: "props", DataType: "JSONB"},
+			{ColName: "qty", DataType: "INT8", NotNull: true},
+			{ColName: "sku", DataType: "VARCHAR(20)", NotNull: true},
+			{ColName: "tags", DataType: "TEXT[]", NotNull: true},
+			{ColName: "labels", DataType: "VARCHAR(10)[]", NotNull: true},
+		},
+		Indexes: modelcols.SQLIndexes{
+			{Name: "nameidx", Columns: []string{"name"}, IsUnique: true},
+			{Name: "ownerprice", Columns: []string{"owner_id", "price"}},
+			{Name: "propsidx", Columns: []string{"props"}, MethodName: "gin"},
+			{Name: "lowername", Expressions: []string{"lower((name)::text)"}, Where: "(owner_id IS NOT NULL)"},
+		},
+	}
+	sqm.Constraints = dbConstraints("shop_items", pgparty.DBConstraintDefs{
+		{Name: "shop_items_pkey", Type: "p", Def: "PRIMARY KEY (id)"},
+		{Name: "legacy_sku_key", Type: "u", Def: "UNIQUE (owner_id, sku)"},
+		{Name: "shop_items_qty_check", Type: "c", Def: "CHECK ((qty > 0))"},
+	})
+	src, err := Generate("models", []*modelcols.SQLModel{sqm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(src)
+	for _, want := range []string{
+		"type ShopItems struct {",
+		"ID        pgparty.UUIDv4",
+		"CreatedAt pgparty.Time        `json:\"createdAt\" defval:\"now()\"`",
+		"Name      pgparty.String      `json:\"name\" sql:\"VARCHAR(100)\" unikey:\"nameidx\"`",
+		"OwnerID   pgparty.NullUUIDv4  `json:\"ownerId\"`",
+		"Price     pgparty.NullDecimal `json:\"price\" len:\"12\" prec:\"4\"`",
+		"Props     pgparty.NullJsonB   `json:\"props\" ginkey:\"propsidx\"`",
+		"Qty       pgparty.Int64       `json:\"qty\"`",
+		"Tags      pgparty.TextArray   `json:\"tags\"`",
+		"Labels    pgparty.TextArray   `json:\"labels\" sql:\"VARCHAR(10)[]\"`",
+		`{Name: "legacy_sku_key", Unique: []string{"OwnerID", "Sku"}},`,
+		`{Name: "shop_items_qty_check", Check: "(qty > 0)"},`,
+		`func (ShopItems) DatabaseName() string { return "shop_items" }`,
+		`{Name: "lowername", Expressions: []string{"lower((name)::text)"}, Where: "(owner_id IS NOT NULL)"}`,
+		`{Name: "ownerprice", Fields: []string{"OwnerID", "Price"}}`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("generated source has no %q:\n%s", want, s)
+		}
+	}
+}
+
+func TestGeneratePartitioned(t *testing.T) {
+	sqm := &modelcols.SQLModel{
+		Table: "events",
+		Columns: modelcols.SQLColumns{
+			{ColName: "created_at", DataType: "TIMESTAMPTZ", NotNull: true, PrimaryKey: true},
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+		},
+		Partition: &modelcols.SQLPartition{Method: "RANGE", Columns: []string{"created_at"}},
+	}
+	src, err := Generate("models", []*modelcols.SQLModel{sqm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `return pgparty.ModelPartitioning{Method: pgparty.PartitionRange, Fields: []string{"CreatedAt"}}`
+	if !strings.Contains(string(src), want) {
+		t.Errorf("generated source has no %q:\n%s", want, src)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for in, want := range map[string]string{
+		"id":         "ID",
+		"owner_id":   "OwnerID",
+		"app_xid":    "AppXID",
+		"created_at": "CreatedAt",
+		"2fa":        "F2fa",
+	} {
+		if got := goName(in); got != want {
+			t.Errorf("goName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package pgparty
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ColumnTypeChange is a risk class of column type change
+type ColumnTypeChange string
+
+const (
+	TypeChangeNone    ColumnTypeChange = ""        // types are the same
+	TypeChangeSafe    ColumnTypeChange = "safe"    // catalog only change, no table rewrite
+	TypeChangeRewrite ColumnTypeChange = "rewrite" // table is rewritten, all values are converted
+	TypeChangeUnsafe  ColumnTypeChange = "unsafe"  // conversion may fail or lose data, requires opt-in
+)
+
+var typeChangeRank = map[ColumnTypeChange]int{
+	TypeChangeNone:    0,
+	TypeChangeSafe:    1,
+	TypeChangeRewrite: 2,
+	TypeChangeUnsafe:  3,
+}
+
+var sqlTypeAliases = map[string]string{
+	"SMALLINT":                 "INT2",
+	"INT":                      "INT4",
+	"INTEGER":                  "INT4",
+	"SERIAL":                   "INT4",
+	"BIGINT":                   "INT8",
+	"BIGSERIAL":                "INT8",
+	"REAL":                     "FLOAT4",
+	"FLOAT":                    "FLOAT8",
+	"DOUBLE PRECISION":         "FLOAT8",
+	"DECIMAL":                  "NUMERIC",
+	"BOOL":                     "BOOLEAN",
+	"CHARACTER VARYING":        "VARCHAR",
+	"TIMESTAMP WITH TIME ZONE": "TIMESTAMPTZ",
+}
+
+// digits of integer types
+var sqlIntDigits = map[string]int{
+	"INT2": 5,
+	"INT4": 10,
+	"INT8": 19,
+}
+
+type sqlTypeName struct {
+	base  string
+	args  []int
+	array bool
+}
+
+func parseSQLType(s string) sqlTypeName {
+	ret := sqlTypeName{}
+	s = strings.ToUpper(strings.Join(strings.Fields(s), " "))
+	if strings.HasSuffix(s, "[]") {
+		ret.array = true
+		s = strings.TrimSpace(strings.TrimSuffix(s, "[]"))
+	}
+	if i := strings.Index(s, "("); i > 0 {
+		for _, a := range strings.Split(strings.Trim(s[i:], "() "), ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(a)); err == nil {
+				ret.args = append(ret.args, n)
+			}
+		}
+		s = strings.TrimSpace(s[:i])
+	}
+	if alias, ok := sqlTypeAliases[s]; ok {
+		s = alias
+	}
+	ret.base = s
+	return ret
+}
+
+func (t sqlTypeName) isString() bool { return !t.array && (t.base == "VARCHAR" || t.base == "TEXT") }
+func (t sqlTypeName) isInt() bool    { return !t.array && sqlIntDigits[t.base] > 0 }
+func (t sqlTypeName) isFloat() bool  { return !t.array && (t.base == "FLOAT4" || t.base == "FLOAT8") }
+
+func (t sqlTypeName) isNumeric() bool { return !t.array && t.base == "NUMERIC" }
+
+// unlimited string type
+func (t sqlTypeName) isText() bool { return t.isString() && len(t.args) == 0 }
+
+// integer digits of NUMERIC(p,s), 0 is unlimited
+func (t sqlTypeName) intDigits() int {
+	switch len(t.args) {
+	case 0:
+		return 0
+	case 1:
+		return t.args[0]
+	}
+	return t.args[0] - t.args[1]
+}
+
+func (t sqlTypeName) scale() int {
+	if len(t.args) > 1 {
+		return t.args[1]
+	}
+	return 0
+}
+
+// ClassifyColumnTypeChange returns the risk class of the column type change from one type to another
+// and USING expression for known conversions between pgparty types
+func ClassifyColumnTypeChange(col, from, to string) (ColumnTypeChange, string) {
+	f, t := parseSQLType(from), parseSQLType(to)
+	cast := fmt.Sprintf("%s::%s", col, to)
+	nullif := fmt.Sprintf("NULLIF(trim(%s), '')::%s", col, to)
+
+	if f.base == t.base && f.array == t.array {
+		switch {
+		case fmt.Sprint(f.args) == fmt.Sprint(t.args):
+			return TypeChangeNone, ""
+		case f.base == "VARCHAR":
+			if len(t.args) == 0 || (len(f.args) > 0 && t.args[0] >= f.args[0]) {
+				return TypeChangeSafe, ""
+			}
+			return TypeChangeUnsafe, ""
+		case f.base == "NUMERIC":
+			switch {
+			case len(t.args) == 0:
+				return TypeChangeSafe, ""
+			case len(f.args) == 0:
+				return TypeChangeUnsafe, ""
+			case f.scale() == t.scale() && t.args[0] >= f.args[0]:
+				return TypeChangeSafe, ""
+			case t.scale() >= f.scale() && t.intDigits() >= f.intDigits():
+				return TypeChangeRewrite, ""
+			}
+			return TypeChangeUnsafe, ""
+		}
+		return TypeChangeRewrite, ""
+	}
+
+	switch {
+	case f.isString() && t.isString():
+		// VARCHAR(n) -> TEXT, TEXT -> VARCHAR
+		if t.isText() {
+			return TypeChangeSafe, ""
+		}
+		return TypeChangeUnsafe, ""
+
+	case f.isInt() && t.isInt():
+		if sqlIntDigits[t.base] > sqlIntDigits[f.base] {
+			return TypeChangeRewrite, ""
+		}
+		return TypeChangeUnsafe, ""
+
+	case f.isInt() && t.isFloat():
+		return TypeChangeRewrite, ""
+
+	case f.isInt() && t.isNumeric():
+		if t.intDigits() == 0 || t.intDigits() >= sqlIntDigits[f.base] {
+			return TypeChangeRewrite, ""
+		}
+		return TypeChangeUnsafe, ""
+
+	case f.base == "FLOAT4" && t.base == "FLOAT8":
+		return TypeChangeRewrite, ""
+
+	case (f.isFloat() || f.isNumeric()) && t.isInt():
+		return TypeChangeUnsafe, fmt.Sprintf("round(%s)::%s", col, to)
+
+	case (f.isFloat() || f.isNumeric()) && (t.isFloat() || t.isNumeric()):
+		// округление
+		return TypeChangeUnsafe, ""
+
+	case f.base == "BOOLEAN" && !f.array && (t.isInt() || t.isNumeric()):
+		return TypeChangeRewrite, fmt.Sprintf("CASE WHEN %s THEN 1 ELSE 0 END", col)
+
+	case f.isInt() && t.base == "BOOLEAN" && !t.array:
+		return TypeChangeUnsafe, fmt.Sprintf("%s <> 0", col)
+
+	case t.isString():
+		// любой тип в строку
+		if t.isText() {
+			return TypeChangeRewrite, fmt.Sprintf("%s::text", col)
+		}
+		return TypeChangeUnsafe, fmt.Sprintf("%s::text", col)
+
+	case f.isString() && !t.array && (t.base == "UUID" || t.base == "BOOLEAN" || t.base == "TIMESTAMPTZ" ||
+		t.isInt() || t.isFloat() || t.isNumeric()):
+		// пустая строка - значение по умолчанию строковых полей
+		return TypeChangeUnsafe, nullif
+
+	case f.isString() && t.base == "JSONB" && !t.array:
+		return TypeChangeUnsafe, fmt.Sprintf("%s::jsonb", col)
+
+	case f.base == "JSONB" && !f.array && t.array && (t.base == "TEXT" || t.base == "VARCHAR"):
+		// массив строк json в массив postgres
+		return TypeChangeUnsafe, fmt.Sprintf("translate(%s::text, '[]', '{}')::%s", col, to)
+	}
+
+	return TypeChangeUnsafe, cast
+}
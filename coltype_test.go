@@ -0,0 +1,110 @@
+package pgparty
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+func TestClassifyColumnTypeChange(t *testing.T) {
+	tests := []struct {
+		from, to string
+		change   ColumnTypeChange
+		using    string
+	}{
+		{"VARCHAR(50)", "VARCHAR(100)", TypeChangeSafe, ""},
+		{"VARCHAR(100)", "VARCHAR(50)", TypeChangeUnsafe, ""},
+		{"VARCHAR(100)", "TEXT", TypeChangeSafe, ""},
+		{"INT8", "BIGINT", TypeChangeNone, ""},
+		{"INT", "BIGINT", TypeChangeRewrite, ""},
+		{"BIGINT", "INT", TypeChangeUnsafe, ""},
+		{"NUMERIC(15,2)", "NUMERIC(19,2)", TypeChangeSafe, ""},
+		{"NUMERIC(15,2)", "NUMERIC(15,3)", TypeChangeUnsafe, ""},
+		{"NUMERIC(15,2)", "NUMERIC(19,3)", TypeChangeRewrite, ""},
+		{"BIGINT", "NUMERIC(15,2)", TypeChangeUnsafe, ""},
+		{"UUID", "TEXT", TypeChangeRewrite, "c::text"},
+		{"VARCHAR", "UUID", TypeChangeUnsafe, "NULLIF(trim(c), '')::UUID"},
+		{"TEXT", "NUMERIC(15,2)", TypeChangeUnsafe, "NULLIF(trim(c), '')::NUMERIC(15,2)"},
+		{"JSONB", "TEXT[]", TypeChangeUnsafe, "translate(c::text, '[]', '{}')::TEXT[]"},
+		{"FLOAT8", "BIGINT", TypeChangeUnsafe, "round(c)::BIGINT"},
+		{"BYTEA", "UUID", TypeChangeUnsafe, "c::UUID"},
+	}
+	for _, tt := range tests {
+		change, using := ClassifyColumnTypeChange("c", tt.from, tt.to)
+		if change != tt.change || using != tt.using {
+			t.Errorf("%s -> %s: got %q %q, want %q %q", tt.from, tt.to, change, using, tt.change, tt.using)
+		}
+	}
+}
+
+func TestUnsafeTypeChangePatch(t *testing.T) {
+	last := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "shop", DataType: "VARCHAR(36)", NotNull: true, DefaultValue: "''"},
+		},
+	}
+	to := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "shop", DataType: "UUID", NotNull: true, DefaultValue: "'00000000-0000-0000-0000-000000000000'"},
+		},
+	}
+
+	_, err := SQLAlterTablePatch("sh", "items", last, to, nil, nil, nil, MigrationOptions{})
+	var tperr ErrorUnsafeColumnTypeChange
+	if !errors.As(err, &tperr) || tperr.Column != "shop" {
+		t.Fatalf("unsafe change must be refused: %v", err)
+	}
+
+	pt, err := SQLAlterTablePatch("sh", "items", last, to, nil, nil, nil, MigrationOptions{AllowUnsafeTypeChanges: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ALTER TABLE sh.items ALTER COLUMN shop DROP DEFAULT, ALTER COLUMN shop TYPE UUID USING NULLIF(trim(shop), '')::UUID, " +
+		"ALTER COLUMN shop SET DEFAULT '00000000-0000-0000-0000-000000000000'"
+	if qs := pt.Queries(); strings.Join(qs, "\n") != want {
+		t.Errorf("wrong queries:\n%s\nwant:\n%s", strings.Join(qs, "\n"), want)
+	}
+	if st := pt.Steps()[0]; st.TypeChange != TypeChangeUnsafe {
+		t.Errorf("wrong type change of step: %q", st.TypeChange)
+	}
+
+	// приведение из тега без типов смены не разрешает смену типа
+	to.Columns[1].Using = "shop::uuid"
+	if _, err := SQLAlterTablePatch("sh", "items", last, to, nil, nil, nil, MigrationOptions{}); !errors.As(err, &tperr) {
+		t.Errorf("change with using without types must be refused: %v", err)
+	}
+
+	// приведение из тега разрешает только смену типа из тега
+	to.Columns[1].UsingFrom, to.Columns[1].UsingTo = "varchar(36)", "UUID"
+	pt, err = SQLAlterTablePatch("sh", "items", last, to, nil, nil, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatalf("change with using must be allowed: %s", err)
+	}
+	if qs := pt.Queries(); !strings.Contains(qs[0], "TYPE UUID USING shop::uuid") {
+		t.Errorf("using of tag is not applied: %s", qs[0])
+	}
+	to.Columns[1].UsingFrom = "TEXT"
+	if _, err := SQLAlterTablePatch("sh", "items", last, to, nil, nil, nil, MigrationOptions{}); !errors.As(err, &tperr) {
+		t.Errorf("change with using of other types must be refused: %v", err)
+	}
+}
+
+func TestParseUsing(t *testing.T) {
+	for _, tt := range []struct{ tag, from, to, expr string }{
+		{"VARCHAR(36)->UUID:NULLIF(:Shop, '')::uuid", "VARCHAR(36)", "UUID", "NULLIF(:Shop, '')::uuid"},
+		{"NUMERIC(10,2) -> BIGINT::Price::bigint", "NUMERIC(10,2)", "BIGINT", ":Price::bigint"},
+		{"(:Data->>'id')::uuid", "", "", "(:Data->>'id')::uuid"},
+		{"data->>'id'", "", "", "data->>'id'"},
+	} {
+		from, to, expr := parseUsing(tt.tag)
+		if from != tt.from || to != tt.to || expr != tt.expr {
+			t.Errorf("parseUsing(%q) = %q, %q, %q", tt.tag, from, to, expr)
+		}
+	}
+}
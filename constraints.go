@@ -0,0 +1,206 @@
+package pgparty
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+// Constraints2SQL builds CHECK and UNIQUE constraints from field tags and Constrainer model
+func (sr *PgStore) Constraints2SQL(ctx context.Context, md *ModelDesc) (modelcols.SQLConstraints, error) {
+	var ret modelcols.SQLConstraints
+	tname := md.DatabaseName()
+
+	for fdIdx := 0; fdIdx < md.ColumnPtrsCount(); fdIdx++ {
+		f := md.ColumnPtr(fdIdx)
+		if !f.IsStored() || len(f.Check) == 0 {
+			continue
+		}
+		expr, err := sr.PrepareModelExpr(ctx, md, f.Check)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, modelcols.SQLConstraint{
+			Name: strings.ToLower(tname + "_" + f.DatabaseName + "_check"),
+			Type: modelcols.ConstraintCheck,
+			Expr: expr,
+		})
+	}
+
+	for _, mc := range md.Constraints() {
+		switch {
+		case len(mc.Check) > 0 && len(mc.Unique) > 0:
+			return nil, fmt.Errorf("constraint %q of %s must be either check or unique", mc.Name, md.TypeName())
+		case len(mc.Check) > 0:
+			if len(mc.Name) == 0 {
+				return nil, fmt.Errorf("check constraint of %s must have a name", md.TypeName())
+			}
+			expr, err := sr.PrepareModelExpr(ctx, md, mc.Check)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, modelcols.SQLConstraint{
+				Name: strings.ToLower(mc.Name),
+				Type: modelcols.ConstraintCheck,
+				Expr: expr,
+			})
+		case len(mc.Unique) > 0:
+			cols := make([]string, 0, len(mc.Unique))
+			for _, fn := range mc.Unique {
+				fd, err := md.ColumnByFieldName(fn)
+				if err != nil {
+					return nil, err
+				}
+				cols = append(cols, fd.DatabaseName)
+			}
+			name := mc.Name
+			if len(name) == 0 {
+				name = tname + "_" + strings.Join(cols, "_") + "_key"
+			}
+			ret = append(ret, modelcols.SQLConstraint{
+				Name:    strings.ToLower(name),
+				Type:    modelcols.ConstraintUnique,
+				Columns: cols,
+			})
+		default:
+			return nil, fmt.Errorf("constraint %q of %s is empty", mc.Name, md.TypeName())
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	for i := 1; i < len(ret); i++ {
+		if ret[i].Name == ret[i-1].Name {
+			return nil, fmt.Errorf("constraint name %q of %s is not unique", ret[i].Name, md.TypeName())
+		}
+	}
+
+	return ret, nil
+}
+
+type DBConstraintDef struct {
+	Name string `db:"conname"`
+	Type string `db:"contype"`
+	Def  string `db:"condef"`
+}
+
+func (d DBConstraintDef) String() string {
+	return fmt.Sprintf("%s %s", d.Name, d.Def)
+}
+
+type DBConstraintDefs []DBConstraintDef
+
+func (cs DBConstraintDefs) FindByName(n string) (DBConstraintDef, bool) {
+	for _, c := range cs {
+		if strings.EqualFold(c.Name, n) {
+			return c, true
+		}
+	}
+	return DBConstraintDef{}, false
+}
+
+// CurrentSchemaConstraints returns PRIMARY KEY, CHECK and UNIQUE constraints of the table from pg_constraint
+func CurrentSchemaConstraints(ctx context.Context, tablename string) (DBConstraintDefs, error) {
+	s, err := ShardFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("CurrentSchemaConstraints: %w", err)
+	}
+	stx := s.Store
+	if stx == nil || stx.tx == nil {
+		return nil, fmt.Errorf("context must contains store transaction")
+	}
+
+	var cons DBConstraintDefs
+
+	q := `select
+			c.conname,
+			c.contype::text as contype,
+			pg_get_constraintdef(c.oid) as condef
+		from
+			pg_constraint as c
+		join pg_class as t
+		on
+			t.oid = c.conrelid
+		join pg_namespace as ns
+		on
+			ns.oid = t.relnamespace
+		where
+		c.contype in ('p', 'c', 'u')
+		and ns.nspname = $1
+		and t.relname = $2
+		order by c.conname`
+
+	if err := stx.tx.SelectContext(ctx, &cons, q, stx.Schema(), tablename); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return cons, nil
+}
+
+// ConstraintsEqualToDBConstraints reports whether the database has all constraints of the model with the same definitions
+func ConstraintsEqualToDBConstraints(sqs *modelcols.SQLModel, dbcons DBConstraintDefs) bool {
+	for _, c := range sqs.Constraints {
+		dbc, ok := dbcons.FindByName(c.Name)
+		if !ok || !ConstraintEqualDBConstraint(c, dbc) {
+			return false
+		}
+	}
+	return true
+}
+
+// ConstraintEqualDBConstraint compares the model constraint with pg_get_constraintdef of the database one.
+// The definition read back after the migration is compared as is, postgres rewrites expressions of checks.
+// Without it definitions are compared without case, spaces, quotes, parentheses and type casts.
+func ConstraintEqualDBConstraint(c modelcols.SQLConstraint, dbc DBConstraintDef) bool {
+	expected := constraintDBDef(c)
+	if len(c.DBDef) > 0 {
+		return dbc.Type == expected.Type && dbc.Def == c.DBDef
+	}
+	return dbc.Type == expected.Type && normConstraintDef(dbc.Def) == normConstraintDef(expected.Def)
+}
+
+// readBackConstraints stores definitions of the model constraints as postgres prints them
+func readBackConstraints(m *modelcols.SQLModel, dbcons DBConstraintDefs) {
+	for i, c := range m.Constraints {
+		if dbc, ok := dbcons.FindByName(c.Name); ok {
+			m.Constraints[i].DBDef = dbc.Def
+		}
+	}
+}
+
+// constraintDBDef returns the constraint as it is read by CurrentSchemaConstraints
+func constraintDBDef(c modelcols.SQLConstraint) DBConstraintDef {
+	if len(c.DBDef) > 0 {
+		typ := "c"
+		if c.Type == modelcols.ConstraintUnique {
+			typ = "u"
+		}
+		return DBConstraintDef{Name: c.Name, Type: typ, Def: c.DBDef}
+	}
+	if c.Type == modelcols.ConstraintUnique {
+		return DBConstraintDef{Name: c.Name, Type: "u", Def: "UNIQUE (" + strings.Join(c.Columns, ", ") + ")"}
+	}
+	return DBConstraintDef{Name: c.Name, Type: "c", Def: "CHECK ((" + c.Expr + "))"}
+}
+
+var (
+	constraintCastRe = regexp.MustCompile(`::\s*(character varying|double precision|bit varying|` +
+		`time(stamp)? with(out)? time zone|"?[a-z_][a-z0-9_.]*"?)(\s*\(\s*\d+(\s*,\s*\d+)?\s*\))?(\[\])?`)
+	constraintNoiseRe = regexp.MustCompile(`[\s()"]+`)
+	constraintNotInRe = regexp.MustCompile(`\s+not\s+in\s*\(([^()]*)\)`)
+	constraintInRe    = regexp.MustCompile(`\s+in\s*\(([^()]*)\)`)
+)
+
+// normConstraintDef removes from the constraint definition what postgres adds when it prints the definition,
+// IN lists are printed by postgres as ANY of arrays
+func normConstraintDef(def string) string {
+	def = constraintCastRe.ReplaceAllString(strings.ToLower(def), "")
+	def = constraintNotInRe.ReplaceAllString(def, " <> all (array[$1])")
+	def = constraintInRe.ReplaceAllString(def, " = any (array[$1])")
+	return constraintNoiseRe.ReplaceAllString(def, "")
+}
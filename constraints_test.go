@@ -0,0 +1,122 @@
+package pgparty
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+func TestConstraintPatches(t *testing.T) {
+	cols := modelcols.SQLColumns{
+		{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+		{ColName: "qty", DataType: "BIGINT", NotNull: true, DefaultValue: "0"},
+		{ColName: "shop", DataType: "UUID"},
+	}
+	last := &modelcols.SQLModel{
+		Table:   "items",
+		Columns: cols,
+		Constraints: modelcols.SQLConstraints{
+			{Name: "items_qty_check", Type: modelcols.ConstraintCheck, Expr: "qty >= 0"},
+			{Name: "items_old_check", Type: modelcols.ConstraintCheck, Expr: "qty < 100"},
+		},
+	}
+	to := &modelcols.SQLModel{
+		Table:   "items",
+		Columns: cols,
+		Constraints: modelcols.SQLConstraints{
+			{Name: "items_qty_check", Type: modelcols.ConstraintCheck, Expr: "qty > 0"},
+			{Name: "items_shop_qty_key", Type: modelcols.ConstraintUnique, Columns: []string{"shop", "qty"}},
+		},
+	}
+	dbcons := DBConstraintDefs{
+		{Name: "items_qty_check", Type: "c", Def: "CHECK ((qty >= 0))"},
+		{Name: "items_old_check", Type: "c", Def: "CHECK ((qty < 100))"},
+	}
+
+	pt, err := SQLAlterTablePatch("sh", "items", last, to, nil, nil, dbcons, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ALTER TABLE sh.items DROP CONSTRAINT IF EXISTS items_old_check",
+		"ALTER TABLE sh.items DROP CONSTRAINT IF EXISTS items_qty_check",
+		"ALTER TABLE sh.items ADD CONSTRAINT items_qty_check CHECK (qty > 0)",
+		"ALTER TABLE sh.items ADD CONSTRAINT items_shop_qty_key UNIQUE (shop,qty)",
+	}
+	if qs := pt.Queries(); strings.Join(qs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong queries:\n%s\nwant:\n%s", strings.Join(qs, "\n"), strings.Join(want, "\n"))
+	}
+
+	if ConstraintsEqualToDBConstraints(to, dbcons) {
+		t.Errorf("unique constraint is not in db")
+	}
+
+	// ограничение с тем же именем, но другим определением в базе пересоздается
+	dbcons = DBConstraintDefs{
+		{Name: "items_qty_check", Type: "c", Def: "CHECK ((qty > 0))"},
+		{Name: "items_shop_qty_key", Type: "u", Def: "UNIQUE (qty, shop)"},
+	}
+	if ConstraintsEqualToDBConstraints(to, dbcons) {
+		t.Errorf("unique constraint with other columns must differ")
+	}
+	pt, err = SQLAlterTablePatch("sh", "items", to, to, nil, nil, dbcons, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"ALTER TABLE sh.items DROP CONSTRAINT IF EXISTS items_shop_qty_key",
+		"ALTER TABLE sh.items ADD CONSTRAINT items_shop_qty_key UNIQUE (shop,qty)",
+	}
+	if qs := pt.Queries(); strings.Join(qs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong queries:\n%s\nwant:\n%s", strings.Join(qs, "\n"), strings.Join(want, "\n"))
+	}
+	dbcons[1].Def = "UNIQUE (shop, qty)"
+	if !ConstraintsEqualToDBConstraints(to, dbcons) || !ConstraintsEqualToDBConstraints(to, ExpectedDBConstraints(to)) {
+		t.Errorf("constraints must be equal to db")
+	}
+
+	for _, tt := range []struct {
+		expr, def string
+		equal     bool
+	}{
+		{"status <> ''", "CHECK (((status)::text <> ''::text))", true},
+		{"shop IS NOT NULL OR qty > 0", "CHECK (((shop IS NOT NULL) OR (qty > 0)))", true},
+		{"code <> 'x'", `CHECK (((code)::character varying(10) <> 'x'::"char"))`, true},
+		{"status IN ('new', 'paid')", "CHECK (((status)::text = ANY ((ARRAY['new'::character varying, 'paid'::character varying])::text[])))", true},
+		{"status NOT IN ('x')", "CHECK (((status)::text <> ALL ((ARRAY['x'::character varying])::text[])))", true},
+		{"qty > 0", "CHECK ((qty > 1))", false},
+	} {
+		c := modelcols.SQLConstraint{Name: "c", Type: modelcols.ConstraintCheck, Expr: tt.expr}
+		if eq := ConstraintEqualDBConstraint(c, DBConstraintDef{Name: "c", Type: "c", Def: tt.def}); eq != tt.equal {
+			t.Errorf("%q and %q: equal %v, want %v", tt.expr, tt.def, eq, tt.equal)
+		}
+	}
+
+	// postgres переписывает BETWEEN, поэтому база сравнивается с прочитанным после миграции определением
+	between := modelcols.SQLConstraint{Name: "items_qty_check", Type: modelcols.ConstraintCheck, Expr: "qty BETWEEN 1 AND 10 AND code != 'x'"}
+	dbc := DBConstraintDef{Name: "items_qty_check", Type: "c",
+		Def: "CHECK (((qty >= 1) AND (qty <= 10) AND ((code)::text <> 'x'::text)))"}
+	if ConstraintEqualDBConstraint(between, dbc) {
+		t.Errorf("rewritten check can't be compared by text")
+	}
+	stored := &modelcols.SQLModel{Table: "items", Constraints: modelcols.SQLConstraints{between}}
+	readBackConstraints(stored, DBConstraintDefs{dbc})
+	target := &modelcols.SQLModel{Table: "items", Constraints: modelcols.SQLConstraints{between}}
+	target.KeepDBDefs(stored)
+	if !ConstraintEqualDBConstraint(target.Constraints[0], dbc) || !stored.Equal(target) {
+		t.Errorf("check must be equal to its read back definition")
+	}
+	changed := &modelcols.SQLModel{Table: "items", Constraints: modelcols.SQLConstraints{between}}
+	changed.Constraints[0].Expr = "qty BETWEEN 1 AND 20"
+	changed.KeepDBDefs(stored)
+	if len(changed.Constraints[0].DBDef) > 0 {
+		t.Errorf("definition of the changed check must not be kept")
+	}
+
+	ct := PatchCreateTable{Schema: "sh", Table: "items", Cols: cols, Cons: to.Constraints}
+	if s := ct.String(); !strings.HasSuffix(s, ",PRIMARY KEY (id),CONSTRAINT items_qty_check CHECK (qty > 0),"+
+		"CONSTRAINT items_shop_qty_key UNIQUE (shop,qty))") {
+		t.Errorf("wrong create table: %s", s)
+	}
+}
@@ -0,0 +1,229 @@
+package pgparty
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DataMigration is a named Go migration of schema data, applied once in order of Version
+// after the structural migration and recorded in <schema>._migrations table
+type DataMigration struct {
+	Version int64
+	Name    string
+	// Source is included into the checksum, e.g. SQL text or revision of the migration code,
+	// it is required: the checksum of Up code itself can't be computed
+	Source string
+	Up     func(ctx context.Context, stx *PgStore) error
+	Down   func(ctx context.Context, stx *PgStore) error // optional
+}
+
+// Key is a name of migration record in _migrations table
+func (m DataMigration) Key() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+func (m DataMigration) Checksum() string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s\n%s", m.Version, m.Name, m.Source)))
+	return hex.EncodeToString(h[:])
+}
+
+// RegisterDataMigrations adds data migrations of the shard schema
+func RegisterDataMigrations(sh Shard, ms ...DataMigration) error {
+	for _, m := range ms {
+		if len(m.Name) == 0 || m.Up == nil {
+			return fmt.Errorf("data migration %d must have a name and up function", m.Version)
+		}
+		// без Source изменение кода миграции не меняет контрольную сумму
+		if len(m.Source) == 0 {
+			return fmt.Errorf("data migration %d %q must have a source for the checksum", m.Version, m.Name)
+		}
+		for _, dm := range sh.Store.dataMigrations {
+			if dm.Version == m.Version {
+				return fmt.Errorf("data migration version %d is already registered as %q", m.Version, dm.Name)
+			}
+		}
+		sh.Store.dataMigrations = append(sh.Store.dataMigrations, m)
+	}
+	sort.Slice(sh.Store.dataMigrations, func(i, j int) bool {
+		return sh.Store.dataMigrations[i].Version < sh.Store.dataMigrations[j].Version
+	})
+	return nil
+}
+
+// DataMigrationStatus is a state of registered data migration in the schema
+type DataMigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Duration  time.Duration
+	Checksum  string
+	Modified  bool // applied migration has other checksum now
+	CanRevert bool
+}
+
+type dataMigrationRecord struct {
+	Name       string    `db:"name"`
+	AppliedAt  time.Time `db:"applied_at"`
+	DurationMs int64     `db:"duration_ms"`
+	Checksum   string    `db:"checksum"`
+}
+
+func ensureMigrationsTable(ctx context.Context, ex sqlx.ExecerContext, schema string) error {
+	if _, err := ex.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS `+schema+`._migrations (name VARCHAR(250) NOT NULL, PRIMARY KEY (name))`); err != nil {
+		return err
+	}
+	// колонки добавлены позже, таблица могла быть создана без них
+	_, err := ex.ExecContext(ctx, `ALTER TABLE `+schema+`._migrations
+		ADD COLUMN IF NOT EXISTS applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		ADD COLUMN IF NOT EXISTS duration_ms BIGINT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS checksum VARCHAR(64) NOT NULL DEFAULT ''`)
+	return err
+}
+
+func (sr *PgStore) dataMigrationRecord(ctx context.Context, key string) (dataMigrationRecord, bool, error) {
+	var rec dataMigrationRecord
+	err := sr.tx.GetContext(ctx, &rec,
+		`SELECT name,applied_at,duration_ms,checksum FROM `+sr.Schema()+`._migrations WHERE name = $1`, key)
+	if err == sql.ErrNoRows {
+		return rec, false, nil
+	}
+	return rec, err == nil, err
+}
+
+func (s Shard) DataMigrationsStatus(ctx context.Context) ([]DataMigrationStatus, error) {
+	return s.Store.DataMigrationsStatus(WithShard(ctx, s))
+}
+
+// DataMigrationsStatus reports registered data migrations in order of versions
+func (sr *PgStore) DataMigrationsStatus(ctx context.Context) ([]DataMigrationStatus, error) {
+	ret := make([]DataMigrationStatus, 0, len(sr.dataMigrations))
+	if err := sr.WithTx(ctx, func(stx *PgStore) error {
+		ok := false
+		if err := stx.tx.GetContext(ctx, &ok, `SELECT to_regclass($1) IS NOT NULL`, stx.Schema()+"._migrations"); err != nil {
+			return err
+		}
+		for _, m := range stx.dataMigrations {
+			st := DataMigrationStatus{
+				Version:   m.Version,
+				Name:      m.Name,
+				Checksum:  m.Checksum(),
+				CanRevert: m.Down != nil,
+			}
+			if ok {
+				rec, applied, err := stx.dataMigrationRecord(ctx, m.Key())
+				if err != nil {
+					return err
+				}
+				if applied {
+					st.Applied = true
+					st.AppliedAt = rec.AppliedAt
+					st.Duration = time.Duration(rec.DurationMs) * time.Millisecond
+					st.Modified = rec.Checksum != st.Checksum
+				}
+			}
+			ret = append(ret, st)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("DataMigrationsStatus: %w", err)
+	}
+	return ret, nil
+}
+
+// ApplyDataMigrations runs not applied data migrations, each in its own transaction under the schema migration lock
+func (sr *PgStore) ApplyDataMigrations(ctx context.Context) error {
+	shard, err := ShardFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("ApplyDataMigrations: %w", err)
+	}
+	opts := MigrationOptionsFromContext(ctx)
+	for _, m := range sr.dataMigrations {
+		if err := sr.WithTx(ctx, func(stx *PgStore) error {
+			ctxTx := WithShard(ctx, Shard{shard.ID, stx})
+			if _, err := stx.lockMigration(ctxTx, opts.LockTimeout); err != nil {
+				return err
+			}
+			if err := ensureMigrationsTable(ctxTx, stx.tx, stx.Schema()); err != nil {
+				return err
+			}
+			rec, applied, err := stx.dataMigrationRecord(ctxTx, m.Key())
+			if err != nil {
+				return err
+			}
+			if applied {
+				if rec.Checksum != m.Checksum() {
+					log.Printf("data migration %s of schema %s was changed after it was applied", m.Key(), stx.Schema())
+				}
+				return nil
+			}
+
+			log.Printf("apply data migration %s of schema %s", m.Key(), stx.Schema())
+			start := time.Now()
+			if err := m.Up(ctxTx, stx); err != nil {
+				return err
+			}
+			_, err = stx.tx.ExecContext(ctxTx, `INSERT INTO `+stx.Schema()+`._migrations (name,applied_at,duration_ms,checksum)
+			VALUES($1,now(),$2,$3)`, m.Key(), time.Since(start).Milliseconds(), m.Checksum())
+			return err
+		}); err != nil {
+			return fmt.Errorf("ApplyDataMigrations %s: %w", m.Key(), err)
+		}
+	}
+	return nil
+}
+
+func (s Shard) RollbackDataMigrations(ctx context.Context, toVersion int64) error {
+	return s.Store.RollbackDataMigrations(WithShard(ctx, s), toVersion)
+}
+
+// RollbackDataMigrations runs down functions of applied data migrations with version greater than toVersion,
+// from the latest to the earliest
+func (sr *PgStore) RollbackDataMigrations(ctx context.Context, toVersion int64) error {
+	shard, err := ShardFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("RollbackDataMigrations: %w", err)
+	}
+	opts := MigrationOptionsFromContext(ctx)
+	for i := len(sr.dataMigrations) - 1; i >= 0; i-- {
+		m := sr.dataMigrations[i]
+		if m.Version <= toVersion {
+			break
+		}
+		if err := sr.WithTx(ctx, func(stx *PgStore) error {
+			ctxTx := WithShard(ctx, Shard{shard.ID, stx})
+			if _, err := stx.lockMigration(ctxTx, opts.LockTimeout); err != nil {
+				return err
+			}
+			if err := ensureMigrationsTable(ctxTx, stx.tx, stx.Schema()); err != nil {
+				return err
+			}
+			_, applied, err := stx.dataMigrationRecord(ctxTx, m.Key())
+			if err != nil || !applied {
+				return err
+			}
+			if m.Down == nil {
+				return fmt.Errorf("data migration has no down function")
+			}
+
+			log.Printf("revert data migration %s of schema %s", m.Key(), stx.Schema())
+			if err := m.Down(ctxTx, stx); err != nil {
+				return err
+			}
+			_, err = stx.tx.ExecContext(ctxTx, `DELETE FROM `+stx.Schema()+`._migrations WHERE name = $1`, m.Key())
+			return err
+		}); err != nil {
+			return fmt.Errorf("RollbackDataMigrations %s: %w", m.Key(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package pgparty
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegisterDataMigrations(t *testing.T) {
+	sh := Shard{ID: "test", Store: NewPgStore(nil, "test")}
+	up := func(ctx context.Context, stx *PgStore) error { return nil }
+
+	if err := RegisterDataMigrations(sh,
+		DataMigration{Version: 2, Name: "fill_totals", Up: up, Source: "v1"},
+		DataMigration{Version: 1, Name: "init_shops", Up: up, Source: "v1"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterDataMigrations(sh, DataMigration{Version: 2, Name: "other", Up: up, Source: "v1"}); err == nil {
+		t.Errorf("duplicate version must be refused")
+	}
+	if err := RegisterDataMigrations(sh, DataMigration{Version: 3, Name: "noop", Source: "v1"}); err == nil {
+		t.Errorf("migration without up function must be refused")
+	}
+	if err := RegisterDataMigrations(sh, DataMigration{Version: 3, Name: "nosource", Up: up}); err == nil {
+		t.Errorf("migration without source must be refused")
+	}
+
+	ms := sh.Store.DataMigrations()
+	if len(ms) != 2 || ms[0].Key() != "1_init_shops" || ms[1].Key() != "2_fill_totals" {
+		t.Errorf("wrong order of migrations: %v", ms)
+	}
+
+	m := ms[0]
+	sum := m.Checksum()
+	m.Source = "v2"
+	if m.Checksum() == sum {
+		t.Errorf("checksum must depend on source")
+	}
+}
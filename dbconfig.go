@@ -6,14 +6,15 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"strings"
 
 	"github.com/covrom/pgparty/modelcols"
 	"github.com/jmoiron/sqlx"
 )
 
 type DbConfigTable struct {
-	TableName string              `db:"table_name"`
-	Storej    *modelcols.SQLModel `db:"storej"`
+	TableName string              `db:"table_name" json:"table"`
+	Storej    *modelcols.SQLModel `db:"storej" json:"storej"`
 }
 
 func (sr *PgStore) DbConfigTableFromModel(ctx context.Context, md *ModelDesc) (*DbConfigTable, error) {
@@ -44,7 +45,11 @@ func (c *DbConfigTable) LoadTable(ctx context.Context, table string) error {
 		table); err != nil && err != sql.ErrNoRows {
 		return err
 	}
-	sqsdb := *c.Storej
+	sortStoredModel(c.Storej)
+	return nil
+}
+
+func sortStoredModel(sqsdb *modelcols.SQLModel) {
 	sort.Slice(sqsdb.Columns, func(i, j int) bool {
 		return sqsdb.Columns[i].ColName < sqsdb.Columns[j].ColName
 	})
@@ -52,13 +57,7 @@ func (c *DbConfigTable) LoadTable(ctx context.Context, table string) error {
 	sort.Slice(sqsdb.Indexes, func(i, j int) bool {
 		return sqsdb.Indexes[i].Name < sqsdb.Indexes[j].Name
 	})
-
-	for _, idx := range sqsdb.Indexes {
-		sort.Slice(idx.Columns, func(i, j int) bool {
-			return idx.Columns[i] < idx.Columns[j]
-		})
-	}
-	return nil
+	// порядок колонок индекса сохраняется, он задает порядок ключей индекса
 }
 
 func (c DbConfigTable) SaveTable(ctx context.Context) error {
@@ -96,6 +95,16 @@ func NewDbConfig() *DbConfig {
 	return &r
 }
 
+// Find returns the stored model config of the table
+func (c DbConfig) Find(table string) (DbConfigTable, bool) {
+	for _, t := range c {
+		if strings.EqualFold(t.TableName, table) {
+			return t, true
+		}
+	}
+	return DbConfigTable{}, false
+}
+
 func (c *DbConfig) LoadAll(ctx context.Context, tx *sqlx.Tx, schema string) error {
 	return tx.SelectContext(ctx, c, `SELECT table_name,storej from `+schema+`._config`)
 }
@@ -109,22 +118,63 @@ func DBColumnsInfo(ctx context.Context, tx *sqlx.Tx, schema, tname string) ([]DB
 
 const SQL_ColumnsInfo = `select
 column_name,
+data_type,
+udt_schema,
 udt_name,
 is_nullable,
 character_maximum_length,
 numeric_precision,
-numeric_precision_radix
+numeric_precision_radix,
+numeric_scale,
+column_default,
+identity_generation,
+generation_expression
 from
 information_schema.columns
 where
 table_name = '%s'
-and table_schema = '%s'`
+and table_schema = '%s'
+order by ordinal_position`
 
 type DBColInfo struct {
-	Name       string `db:"column_name"`
-	Type       string `db:"udt_name"`
-	IsNullable string `db:"is_nullable"`
-	CharLen    *int   `db:"character_maximum_length"`
-	NumLen     *int   `db:"numeric_precision"`
-	NumPrec    *int   `db:"numeric_precision_radix"`
+	Name       string  `db:"column_name"`
+	DataType   string  `db:"data_type"`
+	TypeSchema string  `db:"udt_schema"`
+	Type       string  `db:"udt_name"`
+	IsNullable string  `db:"is_nullable"`
+	CharLen    *int    `db:"character_maximum_length"`
+	NumLen     *int    `db:"numeric_precision"`
+	NumPrec    *int    `db:"numeric_precision_radix"`
+	NumScale   *int    `db:"numeric_scale"`
+	Default    *string `db:"column_default"`
+	Identity   *string `db:"identity_generation"`
+	Generated  *string `db:"generation_expression"`
+}
+
+// SQLDataType returns the column type in the form used by model config
+func (d DBColInfo) SQLDataType() string {
+	if d.DataType == "USER-DEFINED" {
+		// ENUM и прочие пользовательские типы указываются со схемой
+		return EnumTypeName(d.TypeSchema, d.Type)
+	}
+	dt := strings.ToUpper(d.Type)
+	arr := ""
+	if strings.HasPrefix(dt, "_") {
+		dt, arr = dt[1:], "[]"
+	}
+	switch dt {
+	case "VARCHAR":
+		if d.CharLen != nil {
+			dt = fmt.Sprintf("VARCHAR(%d)", *d.CharLen)
+		}
+	case "NUMERIC":
+		if d.NumLen != nil && d.NumScale != nil {
+			dt = fmt.Sprintf("NUMERIC(%d,%d)", *d.NumLen, *d.NumScale)
+		}
+	case "JSONB":
+		dt = jsonType
+	case "BOOL":
+		dt = "BOOLEAN"
+	}
+	return dt + arr
 }
@@ -0,0 +1,216 @@
+package pgparty
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type EmbedAddress struct {
+	City   String `json:"city" key:"cityidx"`
+	Street String `json:"street"`
+	Zip    String `json:"zip"`
+}
+
+type EmbedCustomer struct {
+	ID       UUIDv4        `json:"id"`
+	Name     String        `json:"name"`
+	Address  EmbedAddress  `json:"address" embed:"addr_"`
+	Delivery *EmbedAddress `json:"delivery" embed:""`
+}
+
+func (EmbedCustomer) DatabaseName() string       { return "customers" }
+func (EmbedCustomer) TypeName() TypeName         { return StructModel[EmbedCustomer]{}.TypeName() }
+func (EmbedCustomer) Fields() []FieldDescription { return StructModel[EmbedCustomer]{}.Fields() }
+
+type embedRows struct {
+	cols []string
+	vals []interface{}
+}
+
+func (r embedRows) Columns() ([]string, error) { return r.cols, nil }
+func (r embedRows) Err() error                 { return nil }
+
+func (r embedRows) Scan(dest ...interface{}) error {
+	for i, d := range dest {
+		if err := scanEmbedValue(d, r.vals[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanEmbedValue(d, v interface{}) error {
+	if sc, ok := d.(interface{ Scan(interface{}) error }); ok {
+		return sc.Scan(v)
+	}
+	rv := reflect.ValueOf(d).Elem()
+	switch {
+	case v == nil:
+		rv.Set(reflect.Zero(rv.Type()))
+	case rv.Kind() == reflect.Ptr:
+		p := reflect.New(rv.Type().Elem())
+		if err := scanEmbedValue(p.Interface(), v); err != nil {
+			return err
+		}
+		rv.Set(p)
+	default:
+		rv.Set(reflect.ValueOf(v).Convert(rv.Type()))
+	}
+	return nil
+}
+
+func TestEmbedModel(t *testing.T) {
+	shs, ctx := NewShards(context.Background())
+	sh := shs.SetShard("sh", nil, "sh")
+	if err := Register(sh, MD[EmbedCustomer]{}); err != nil {
+		t.Fatal(err)
+	}
+	md := sh.Store.ModelDescriptions()[EmbedCustomer{}.TypeName()]
+	fd, err := md.ColumnByFieldName("Delivery.City")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fd.DatabaseName != "delivery_city" || !fd.Nullable {
+		t.Errorf("wrong embed field: %s", fd)
+	}
+
+	m, err := sh.Store.MD2SQLModel(WithShard(ctx, sh), md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cols []string
+	for _, c := range m.Columns {
+		cols = append(cols, fmt.Sprintf("%s %s %v", c.ColName, c.DataType, c.NotNull))
+	}
+	want := "addr_city VARCHAR true,addr_street VARCHAR true,addr_zip VARCHAR true," +
+		"delivery_city VARCHAR false,delivery_street VARCHAR false,delivery_zip VARCHAR false,id UUID true,name VARCHAR true"
+	if strings.Join(cols, ",") != want {
+		t.Errorf("wrong columns:\n%s\nwant:\n%s", strings.Join(cols, ","), want)
+	}
+	for _, n := range []string{"addr_cityidx", "delivery_cityidx"} {
+		if idx, ok := m.Indexes.FindByName(n); !ok || len(idx.Columns) != 1 {
+			t.Errorf("no index %s of embed field: %+v", n, m.Indexes)
+		}
+	}
+
+	item := EmbedCustomer{Name: "n", Address: EmbedAddress{City: "Paris"}}
+	v, err := sh.Store.FieldByFD(item, fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != nil || item.Delivery != nil {
+		t.Errorf("field of nil embed struct must be read as NULL: %v", v)
+	}
+	afd, _ := md.ColumnByFieldName("Address.City")
+	if v, _ := sh.Store.FieldByFD(item, afd); v != String("Paris") {
+		t.Errorf("wrong embed field value: %v", v)
+	}
+
+	sv := &SQLView[EmbedCustomer]{}
+	if err := sv.Scan(embedRows{
+		cols: []string{"name", "addr_city", "delivery_zip"},
+		vals: []interface{}{"Bob", "Rome", "00100"},
+	}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if sv.V.Name != "Bob" || sv.V.Address.City != "Rome" || sv.V.Delivery == nil || sv.V.Delivery.Zip != "00100" {
+		t.Errorf("embed structs are not filled: %+v %+v", sv.V, sv.V.Delivery)
+	}
+	if vals := sv.Values(); len(vals) != 3 || vals[1] != String("Rome") {
+		t.Errorf("wrong view values: %v", vals)
+	}
+}
+
+func TestEmbedNilRoundTrip(t *testing.T) {
+	shs, _ := NewShards(context.Background())
+	sh := shs.SetShard("sh", nil, "sh")
+	if err := Register(sh, MD[EmbedCustomer]{}); err != nil {
+		t.Fatal(err)
+	}
+	md := sh.Store.ModelDescriptions()[EmbedCustomer{}.TypeName()]
+	item := EmbedCustomer{Name: "n", Address: EmbedAddress{City: "Paris"}}
+
+	// запись: nil структура пишется как NULL, чтение: NULL не создает структуру
+	jv := &JsonView[EmbedCustomer]{V: item, MD: md}
+	md.WalkColumnPtrs(func(_ int, fd *FieldDescription) error {
+		jv.Filled = append(jv.Filled, fd)
+		return nil
+	})
+	sv := jv.SQLView()
+	cols, vals := sv.Columns(), sv.Values()
+	for i, c := range cols {
+		if strings.HasPrefix(c, "delivery_") && vals[i] != nil {
+			t.Errorf("column %s of nil embed struct must be NULL: %v", c, vals[i])
+		}
+		if dv, ok := vals[i].(driver.Valuer); ok {
+			vals[i], _ = dv.Value()
+		}
+	}
+	rsv := &SQLView[EmbedCustomer]{}
+	if err := rsv.Scan(embedRows{cols: cols, vals: vals}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if rsv.V.Delivery != nil || rsv.V.Address.City != "Paris" || rsv.V.Name != "n" {
+		t.Errorf("wrong scanned embed structs: %+v %+v", rsv.V, rsv.V.Delivery)
+	}
+
+	// json: вложенные структуры остаются объектами
+	b, err := jv.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = compactJSON(t, b)
+	wantjs := `"address":{"city":"Paris","street":"","zip":""},"delivery":null`
+	if !strings.Contains(string(b), wantjs) || strings.Contains(string(b), "address.city") {
+		t.Errorf("wrong json of embed structs:\n%s", b)
+	}
+	rjv := &JsonView[EmbedCustomer]{}
+	if err := rjv.UnmarshalJSON([]byte(`{"name":"m","address":{"city":"Oslo"},"delivery":{"zip":"0150"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if rjv.V.Name != "m" || rjv.V.Address.City != "Oslo" || rjv.V.Delivery == nil || rjv.V.Delivery.Zip != "0150" {
+		t.Errorf("wrong unmarshaled embed structs: %+v %+v", rjv.V, rjv.V.Delivery)
+	}
+
+	mo, err := sh.Store.ModelObjectFrom(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = mo.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = compactJSON(t, b)
+	if !strings.Contains(string(b), wantjs) {
+		t.Errorf("wrong json of model object:\n%s", b)
+	}
+	rmo := NewModelObject(md)
+	if err := rmo.UnmarshalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rmo.FieldValue(embedFD(md, "Address.City")); v != String("Paris") {
+		t.Errorf("wrong model object embed field: %v", v)
+	}
+	if v, _ := rmo.FieldValue(embedFD(md, "Delivery.City")); v != nil {
+		t.Errorf("model object field of null embed struct must be nil: %v", v)
+	}
+}
+
+func embedFD(md *ModelDesc, fieldName string) *FieldDescription {
+	f, _ := md.ColumnByFieldName(fieldName)
+	return f
+}
+
+func compactJSON(t *testing.T, b []byte) []byte {
+	buf := &bytes.Buffer{}
+	if err := json.Compact(buf, b); err != nil {
+		t.Fatalf("wrong json %s: %s", b, err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,258 @@
+package pgparty
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+// PostgresEnum is implemented by a named Go string type stored as postgres ENUM type.
+// The type is created in the shard schema with snake case name of the Go type, e.g. OrderStatus -> order_status.
+type PostgresEnum interface {
+	PostgresEnumValues() []string
+}
+
+// EnumColumn is a table column of ENUM type
+type EnumColumn struct {
+	Table   string `db:"table_name"`
+	Column  string `db:"column_name"`
+	Default string `db:"column_default"`
+}
+
+// fieldEnum returns ENUM type of the field if its type implements PostgresEnum
+func fieldEnum(f FieldDescription) (modelcols.SQLEnum, bool) {
+	ft := f.ElemType
+	if ft == nil || ft.Kind() != reflect.String || !ft.Implements(reflect.TypeOf((*PostgresEnum)(nil)).Elem()) {
+		return modelcols.SQLEnum{}, false
+	}
+	v := reflect.New(ft).Elem().Interface().(PostgresEnum)
+	return modelcols.SQLEnum{
+		Name:   ToSnakeCase2(ft.Name()),
+		Values: v.PostgresEnumValues(),
+	}, true
+}
+
+// EnumTypeName returns the schema qualified ENUM type name used as a column type
+func EnumTypeName(schema, name string) string {
+	return strings.ToLower(schema + "." + name)
+}
+
+// ModelEnums collects ENUM types of all models, the same type must have the same values in all models
+func ModelEnums(mds []*ModelDesc) (modelcols.SQLEnums, error) {
+	var ret modelcols.SQLEnums
+	owners := make(map[string]TypeName)
+	for _, md := range mds {
+		if md.IsView() {
+			continue
+		}
+		for fdIdx := 0; fdIdx < md.ColumnPtrsCount(); fdIdx++ {
+			f := md.ColumnPtr(fdIdx)
+			if !f.IsStored() || len(f.SQLTypeDef) > 0 {
+				continue
+			}
+			en, ok := fieldEnum(*f)
+			if !ok {
+				continue
+			}
+			if len(en.Values) == 0 {
+				return nil, fmt.Errorf("enum %s of %s has no values", en.Name, md.TypeName())
+			}
+			if ex, ok := ret.FindByName(en.Name); ok {
+				if !ex.Equal(en) {
+					return nil, fmt.Errorf("enum %s has different values in %s and %s", en.Name, owners[en.Name], md.TypeName())
+				}
+				continue
+			}
+			owners[en.Name] = md.TypeName()
+			ret = append(ret, en)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// CurrentSchemaEnums returns ENUM types of the store schema with values in sort order
+func CurrentSchemaEnums(ctx context.Context) (modelcols.SQLEnums, error) {
+	s, err := ShardFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("CurrentSchemaEnums: %w", err)
+	}
+	stx := s.Store
+	if stx == nil || stx.tx == nil {
+		return nil, fmt.Errorf("context must contains store transaction")
+	}
+	var rows []struct {
+		Name   string      `db:"typname"`
+		Values StringArray `db:"vals"`
+	}
+	if err := stx.tx.SelectContext(ctx, &rows, `SELECT t.typname,
+	to_jsonb(array_agg(e.enumlabel::text ORDER BY e.enumsortorder)) AS vals
+	FROM pg_type t
+	JOIN pg_enum e ON e.enumtypid = t.oid
+	JOIN pg_namespace ns ON ns.oid = t.typnamespace
+	WHERE ns.nspname = $1
+	GROUP BY t.typname
+	ORDER BY t.typname`, stx.Schema()); err != nil {
+		return nil, err
+	}
+	ret := make(modelcols.SQLEnums, 0, len(rows))
+	for _, r := range rows {
+		ret = append(ret, modelcols.SQLEnum{Name: r.Name, Values: r.Values})
+	}
+	return ret, nil
+}
+
+// CurrentSchemaEnumColumns returns table columns of ENUM types of the store schema by type name
+func CurrentSchemaEnumColumns(ctx context.Context) (map[string][]EnumColumn, error) {
+	s, err := ShardFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("CurrentSchemaEnumColumns: %w", err)
+	}
+	stx := s.Store
+	if stx == nil || stx.tx == nil {
+		return nil, fmt.Errorf("context must contains store transaction")
+	}
+	var rows []struct {
+		EnumColumn
+		Type string `db:"udt_name"`
+	}
+	if err := stx.tx.SelectContext(ctx, &rows, `SELECT c.udt_name, c.table_name, c.column_name,
+	coalesce(c.column_default, '') AS column_default
+	FROM information_schema.columns c
+	JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+	WHERE c.udt_schema = $1 AND c.data_type = 'USER-DEFINED' AND t.table_type = 'BASE TABLE'
+	ORDER BY c.table_name, c.column_name`, stx.Schema()); err != nil {
+		return nil, err
+	}
+	ret := make(map[string][]EnumColumn)
+	for _, r := range rows {
+		ret[r.Type] = append(ret[r.Type], r.EnumColumn)
+	}
+	return ret, nil
+}
+
+// planEnums compares ENUM types of models with the store schema
+func (sr *PgStore) planEnums(ctx context.Context, mds []*ModelDesc, opts MigrationOptions) (PatchSteps, error) {
+	enums, err := ModelEnums(mds)
+	if err != nil || len(enums) == 0 {
+		return nil, err
+	}
+	dbenums, err := CurrentSchemaEnums(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("planEnums CurrentSchemaEnums error: %w", err)
+	}
+	uses, err := CurrentSchemaEnumColumns(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("planEnums CurrentSchemaEnumColumns error: %w", err)
+	}
+	return SQLEnumSteps(sr.Schema(), enums, dbenums, uses, opts)
+}
+
+// SQLEnumSteps creates missing ENUM types and adds new values to existing ones.
+// Removal of values is refused with ErrorEnumValueRemoval unless AllowEnumValueRemoval is set,
+// then the type is recreated and columns from uses are converted to it.
+func SQLEnumSteps(schema string, enums, dbenums modelcols.SQLEnums, uses map[string][]EnumColumn,
+	opts MigrationOptions,
+) (PatchSteps, error) {
+	var ret PatchSteps
+	for _, en := range enums {
+		tn := EnumTypeName(schema, en.Name)
+		dben, ok := dbenums.FindByName(en.Name)
+		if !ok {
+			ret = append(ret, PatchStep{
+				Kind: StepCreateType,
+				Type: tn,
+				SQL:  fmt.Sprintf("CREATE TYPE %s AS ENUM (%s)", tn, enumValuesSQL(en.Values)),
+			})
+			continue
+		}
+
+		exists := make(map[string]bool, len(dben.Values))
+		for _, v := range dben.Values {
+			exists[v] = true
+		}
+		want := make(map[string]bool, len(en.Values))
+		for _, v := range en.Values {
+			want[v] = true
+		}
+		var removed []string
+		for _, v := range dben.Values {
+			if !want[v] {
+				removed = append(removed, v)
+			}
+		}
+
+		if len(removed) > 0 {
+			if !opts.AllowEnumValueRemoval {
+				return nil, ErrorEnumValueRemoval{Schema: schema, Type: en.Name, Values: removed}
+			}
+			// значения из ENUM не удаляются - пересоздаем тип и переводим на него колонки
+			old := en.Name + "_old"
+			ret = append(ret,
+				PatchStep{Kind: StepAlterType, Type: tn, SQL: fmt.Sprintf("ALTER TYPE %s RENAME TO %s", tn, old)},
+				PatchStep{Kind: StepAlterType, Type: tn, SQL: fmt.Sprintf("CREATE TYPE %s AS ENUM (%s)", tn, enumValuesSQL(en.Values))},
+			)
+			for _, c := range uses[en.Name] {
+				if len(c.Default) > 0 {
+					ret = append(ret, PatchStep{Kind: StepAlterType, Type: tn,
+						SQL: fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN %s DROP DEFAULT", schema, c.Table, c.Column)})
+				}
+				ret = append(ret, PatchStep{Kind: StepAlterType, Type: tn,
+					SQL: fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN %s TYPE %s USING %s::text::%s",
+						schema, c.Table, c.Column, tn, c.Column, tn)})
+				if len(c.Default) > 0 {
+					ret = append(ret, PatchStep{Kind: StepAlterType, Type: tn,
+						SQL: fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN %s SET DEFAULT %s", schema, c.Table, c.Column, c.Default)})
+				}
+			}
+			ret = append(ret, PatchStep{Kind: StepAlterType, Type: tn, SQL: fmt.Sprintf("DROP TYPE %s.%s", schema, old)})
+			continue
+		}
+
+		// новые значения добавляем на их место в порядке сортировки
+		added := false
+		for i, v := range en.Values {
+			if exists[v] {
+				continue
+			}
+			pos := ""
+			if i > 0 {
+				pos = " AFTER " + quoteSQLString(en.Values[i-1])
+			} else {
+				for _, next := range en.Values[1:] {
+					if exists[next] {
+						pos = " BEFORE " + quoteSQLString(next)
+						break
+					}
+				}
+			}
+			ret = append(ret, PatchStep{
+				Kind: StepAddEnumValue,
+				Type: tn,
+				SQL:  fmt.Sprintf("ALTER TYPE %s ADD VALUE IF NOT EXISTS %s%s", tn, quoteSQLString(v), pos),
+			})
+			exists[v] = true
+			added = true
+		}
+
+		if !added && !dben.Equal(en) {
+			log.Printf("order of enum %s values differs from the model, it is not changed by migration", tn)
+		}
+	}
+	return ret, nil
+}
+
+func enumValuesSQL(vs []string) string {
+	qs := make([]string, 0, len(vs))
+	for _, v := range vs {
+		qs = append(qs, quoteSQLString(v))
+	}
+	return strings.Join(qs, ", ")
+}
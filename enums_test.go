@@ -0,0 +1,102 @@
+package pgparty
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+type OrderStatus string
+
+func (OrderStatus) PostgresEnumValues() []string { return []string{"new", "paid", "shipped"} }
+
+type EnumOrder struct {
+	ID     UUIDv4      `json:"id"`
+	Status OrderStatus `json:"status"`
+}
+
+func (EnumOrder) DatabaseName() string       { return "orders" }
+func (EnumOrder) TypeName() TypeName         { return StructModel[EnumOrder]{}.TypeName() }
+func (EnumOrder) Fields() []FieldDescription { return StructModel[EnumOrder]{}.Fields() }
+
+func TestEnumModel(t *testing.T) {
+	shs, ctx := NewShards(context.Background())
+	sh := shs.SetShard("sh", nil, "sh")
+	if err := Register(sh, MD[EnumOrder]{}); err != nil {
+		t.Fatal(err)
+	}
+	md := sh.Store.ModelDescriptions()[EnumOrder{}.TypeName()]
+	m, err := sh.Store.MD2SQLModel(WithShard(ctx, sh), md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col, ok := m.Columns.FindColumnByName("status")
+	if !ok {
+		t.Fatalf("no status column: %+v", m.Columns)
+	}
+	if col.DataType != "sh.order_status" || col.DefaultValue != "'new'" {
+		t.Errorf("wrong enum column: %+v", col)
+	}
+	if len(m.Enums) != 1 || m.Enums[0].Name != "order_status" {
+		t.Errorf("wrong model enums: %+v", m.Enums)
+	}
+
+	enums, err := ModelEnums([]*ModelDesc{md})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps, err := SQLEnumSteps("sh", enums, nil, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := steps.Queries(); len(q) != 1 || q[0] != "CREATE TYPE sh.order_status AS ENUM ('new', 'paid', 'shipped')" {
+		t.Errorf("wrong create steps: %q", q)
+	}
+}
+
+func TestSQLEnumSteps(t *testing.T) {
+	enums := modelcols.SQLEnums{{Name: "status", Values: []string{"draft", "new", "paid", "shipped"}}}
+
+	dbenums := modelcols.SQLEnums{{Name: "status", Values: []string{"new", "shipped"}}}
+	steps, err := SQLEnumSteps("sh", enums, dbenums, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ALTER TYPE sh.status ADD VALUE IF NOT EXISTS 'draft' BEFORE 'new'",
+		"ALTER TYPE sh.status ADD VALUE IF NOT EXISTS 'paid' AFTER 'new'",
+	}
+	if q := steps.Queries(); strings.Join(q, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong add value steps:\n%s", strings.Join(q, "\n"))
+	}
+	if len(steps.OfKind(StepAddEnumValue)) != len(want) {
+		t.Errorf("added values must be committed before tables: %+v", steps)
+	}
+
+	dbenums = modelcols.SQLEnums{{Name: "status", Values: []string{"draft", "new", "paid", "canceled", "shipped"}}}
+	_, err = SQLEnumSteps("sh", enums, dbenums, nil, MigrationOptions{})
+	var rmerr ErrorEnumValueRemoval
+	if !errors.As(err, &rmerr) || len(rmerr.Values) != 1 || rmerr.Values[0] != "canceled" {
+		t.Fatalf("want ErrorEnumValueRemoval, got %v", err)
+	}
+
+	uses := map[string][]EnumColumn{"status": {{Table: "orders", Column: "status", Default: "'draft'::status"}}}
+	steps, err = SQLEnumSteps("sh", enums, dbenums, uses, MigrationOptions{AllowEnumValueRemoval: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"ALTER TYPE sh.status RENAME TO status_old",
+		"CREATE TYPE sh.status AS ENUM ('draft', 'new', 'paid', 'shipped')",
+		"ALTER TABLE sh.orders ALTER COLUMN status DROP DEFAULT",
+		"ALTER TABLE sh.orders ALTER COLUMN status TYPE sh.status USING status::text::sh.status",
+		"ALTER TABLE sh.orders ALTER COLUMN status SET DEFAULT 'draft'::status",
+		"DROP TYPE sh.status_old",
+	}
+	if q := steps.Queries(); strings.Join(q, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong recreate steps:\n%s", strings.Join(q, "\n"))
+	}
+}
@@ -1,6 +1,11 @@
 package pgparty
 
-import "reflect"
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
 
 // Ошибка транзакции
 type ErrorNoTransaction struct{}
@@ -15,3 +20,97 @@ type ErrorNotFound struct {
 	Type    reflect.Type
 	Message string
 }
+
+// Ошибка устаревшего плана миграции - схема в БД или модель изменились после планирования
+type ErrorMigrationPlanOutdated struct {
+	Schema string
+	Table  string
+}
+
+func (e ErrorMigrationPlanOutdated) Error() string {
+	return fmt.Sprintf("migration plan for %s.%s is outdated: schema changed since planning", e.Schema, e.Table)
+}
+
+// Ошибка изменения первичного ключа таблицы
+type ErrorPrimaryKeyChange struct {
+	Schema string
+	Table  string
+	From   []string
+	To     []string
+	Reason string
+}
+
+func (e ErrorPrimaryKeyChange) Error() string {
+	return fmt.Sprintf("can't change primary key of %s.%s from (%s) to (%s): %s", e.Schema, e.Table,
+		strings.Join(e.From, ","), strings.Join(e.To, ","), e.Reason)
+}
+
+// Ошибка блокировки миграции - схему мигрирует другой экземпляр сервиса
+type ErrorMigrationLocked struct {
+	Schema  string
+	Timeout time.Duration
+}
+
+func (e ErrorMigrationLocked) Error() string {
+	return fmt.Sprintf("another instance is migrating schema %s: lock is not acquired in %s", e.Schema, e.Timeout)
+}
+
+// Ошибка небезопасной смены типа колонки - требует явного разрешения
+type ErrorUnsafeColumnTypeChange struct {
+	Schema string
+	Table  string
+	Column string
+	From   string
+	To     string
+}
+
+func (e ErrorUnsafeColumnTypeChange) Error() string {
+	return fmt.Sprintf("unsafe type change of column %s.%s.%s from %s to %s: set using tag %q or allow unsafe type changes",
+		e.Schema, e.Table, e.Column, e.From, e.To, e.From+"->"+e.To+":expression")
+}
+
+// Ошибка циклической зависимости моделей по внешним ключам и запросам представлений
+type ErrorModelDependencyCycle struct {
+	Models []TypeName
+}
+
+func (e ErrorModelDependencyCycle) Error() string {
+	names := make([]string, 0, len(e.Models))
+	for _, tn := range e.Models {
+		names = append(names, string(tn))
+	}
+	return fmt.Sprintf("models have cyclic dependency: %s", strings.Join(names, " -> "))
+}
+
+// Ошибка существующей таблицы без сохраненного конфига модели
+type ErrorUnmanagedTable struct {
+	Schema string
+	Table  string
+}
+
+func (e ErrorUnmanagedTable) Error() string {
+	return fmt.Sprintf("table %s.%s exists but is not managed by pgparty: set AdoptExisting migration option to adopt it",
+		e.Schema, e.Table)
+}
+
+// Ошибка удаления значений ENUM типа - требует явного разрешения
+type ErrorEnumValueRemoval struct {
+	Schema string
+	Type   string
+	Values []string
+}
+
+func (e ErrorEnumValueRemoval) Error() string {
+	return fmt.Sprintf("values %s are removed from enum %s.%s: allow enum value removal to recreate the type",
+		strings.Join(e.Values, ","), e.Schema, e.Type)
+}
+
+// Ошибка изменения секционирования существующей таблицы
+type ErrorPartitionChange struct {
+	Schema string
+	Table  string
+}
+
+func (e ErrorPartitionChange) Error() string {
+	return fmt.Sprintf("partitioning of %s.%s can't be changed by migration: recreate the table and move its data", e.Schema, e.Table)
+}
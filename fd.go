@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -15,14 +16,23 @@ import (
 // Description of field in struct
 type FieldDescription struct {
 	Idx             int          // index in ModelDescription.Columns
-	FieldName       string       // struct field name
+	FieldName       string       // struct field name, path of names separated by point for fields of embed structs
 	ElemType        reflect.Type // type
 	DatabaseName    string       // database name
-	JsonName        string       // json name
+	JsonName        string       // json name, fields of embed structs have a path "parent.field" and are marshaled as nested objects
 	Ln              int          // length for string and numbers
 	Prec            int          // precision length for float/decimals
 	SQLTypeDef      string       // raw postgres type definition
 	DefVal          string       // default postgres value
+	RenamedFrom     string       // previous database name of renamed column
+	ForeignKey      string       // foreign key reference "Model.Field[,options]"
+	Check           string       // CHECK constraint expression
+	Using           string       // USING expression of column type change
+	UsingFrom       string       // column type the Using expression converts from
+	UsingTo         string       // column type the Using expression converts to
+	Comment         string       // column comment
+	Identity        string       // ALWAYS or BY DEFAULT of identity column
+	Generated       string       // expression of stored generated column
 	Indexes         []string     // btree index names
 	GinIndexes      []string     // gin index names
 	UniqIndexes     []string     // unique btree index names
@@ -30,6 +40,7 @@ type FieldDescription struct {
 	Skip            bool         // database skip
 	SkipReplace     bool         // ignore on upsert
 	FullTextEnabled bool         // enable fulltext search
+	FullTextWeight  string       // A, B, C or D weight of fulltext search, empty for default D
 	PK              bool         // is primary key field
 	JsonSkip        bool         // skip in json
 	JsonOmitEmpty   bool         // omit empty on json marshal
@@ -59,10 +70,14 @@ func NewFDByStructField(structField reflect.StructField) *FieldDescription {
 	}
 
 	var fullTextEnabled bool
+	var fullTextWeight string
 
-	switch strings.ToLower(structField.Tag.Get(TagFullText)) {
+	switch ft := strings.ToLower(structField.Tag.Get(TagFullText)); ft {
 	case "true", "enabled", "yes", "on", "1":
 		fullTextEnabled = true
+	case "a", "b", "c", "d":
+		fullTextEnabled = true
+		fullTextWeight = strings.ToUpper(ft)
 	}
 
 	column := FieldDescription{
@@ -74,6 +89,7 @@ func NewFDByStructField(structField reflect.StructField) *FieldDescription {
 		SkipReplace:     structField.Type == reflect.TypeOf(BigSerial{}),
 		Nullable:        SQLAllowNull(structField.Type),
 		FullTextEnabled: fullTextEnabled,
+		FullTextWeight:  fullTextWeight,
 		PK:              structField.Name == IDField,
 		JsonOmitEmpty:   strings.Contains(structField.Tag.Get("json"), ",omitempty"),
 		JsonSkip:        structField.Tag.Get("json") == "-",
@@ -114,6 +130,43 @@ func NewFDByStructField(structField reflect.StructField) *FieldDescription {
 		column.DefVal = dv
 	}
 
+	if fk, ok := structField.Tag.Lookup(TagFK); ok && len(fk) > 0 {
+		column.ForeignKey = fk
+	}
+
+	if chk, ok := structField.Tag.Lookup(TagCheck); ok && len(chk) > 0 {
+		column.Check = chk
+	}
+
+	if rf, ok := structField.Tag.Lookup(TagRenamedFrom); ok && len(rf) > 0 {
+		column.RenamedFrom = rf
+	}
+
+	if u, ok := structField.Tag.Lookup(TagUsing); ok && len(u) > 0 {
+		column.UsingFrom, column.UsingTo, column.Using = parseUsing(u)
+	}
+
+	if c, ok := structField.Tag.Lookup(TagComment); ok && len(c) > 0 {
+		column.Comment = c
+	}
+
+	// значения identity и вычисляемых колонок задает база, в Replace они не передаются
+	if idt, ok := structField.Tag.Lookup(TagIdentity); ok && idt != "-" {
+		switch strings.ToUpper(strings.Join(strings.Fields(strings.ReplaceAll(idt, "_", " ")), " ")) {
+		case "BY DEFAULT", "DEFAULT":
+			column.Identity = IdentityByDefault
+		default:
+			column.Identity = IdentityAlways
+		}
+		column.Nullable = false
+		column.SkipReplace = true
+	}
+
+	if gen, ok := structField.Tag.Lookup(TagGenerated); ok && len(gen) > 0 {
+		column.Generated = gen
+		column.SkipReplace = true
+	}
+
 	if indexes, ok := structField.Tag.Lookup(TagKey); ok && len(indexes) > 0 {
 		column.Indexes = strings.Split(indexes, ",")
 	}
@@ -140,6 +193,95 @@ func NewFDByStructField(structField reflect.StructField) *FieldDescription {
 	return &column
 }
 
+var usingTypeRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_ (),\[\]]*$`)
+
+// parseUsing splits the using tag "FROM->TO:expression" into types of the change and the expression,
+// types are empty if the tag has the expression only
+func parseUsing(tag string) (from, to, expr string) {
+	if i := strings.Index(tag, "->"); i > 0 {
+		if j := strings.IndexByte(tag[i+2:], ':'); j > 0 {
+			from, to = strings.TrimSpace(tag[:i]), strings.TrimSpace(tag[i+2:i+2+j])
+			if usingTypeRe.MatchString(from) && usingTypeRe.MatchString(to) {
+				return from, to, tag[i+3+j:]
+			}
+		}
+	}
+	return "", "", tag
+}
+
+// structValue returns the field of the model struct value rv,
+// nil pointers to embed structs are allocated if rv is addressable, otherwise ok is false
+func (fd *FieldDescription) structValue(rv reflect.Value) (ret reflect.Value, ok bool) {
+	path := strings.Split(fd.FieldName, ".")
+	for i, fn := range path {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				if !rv.CanSet() {
+					return reflect.Zero(fieldTypeByPath(rv.Type().Elem(), path[i:])), false
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.FieldByName(fn)
+	}
+	return rv, true
+}
+
+// readValue returns the field value of the model struct value rv,
+// it is nil if the field belongs to an embed struct with nil pointer
+func (fd *FieldDescription) readValue(rv reflect.Value) interface{} {
+	fv, ok := fd.structValue(rv)
+	if !ok {
+		return nil
+	}
+	return fv.Interface()
+}
+
+// embedPtr reports whether the field belongs to an embed struct referenced by a pointer
+func (fd *FieldDescription) embedPtr(typ reflect.Type) bool {
+	path := strings.Split(fd.FieldName, ".")
+	for i, fn := range path {
+		if i > 0 && typ.Kind() == reflect.Ptr {
+			return true
+		}
+		sf, _ := typ.FieldByName(fn)
+		typ = sf.Type
+	}
+	return false
+}
+
+// embedParent returns the top level struct field name and the json name of the embed struct,
+// ok is false if the field does not belong to an embed struct
+func (fd *FieldDescription) embedParent() (fieldName, jsonName string, ok bool) {
+	i := strings.IndexByte(fd.FieldName, '.')
+	if i < 0 {
+		return "", "", false
+	}
+	fieldName = fd.FieldName[:i]
+	jsonName = fd.JsonName
+	if j := strings.IndexByte(jsonName, '.'); j >= 0 {
+		jsonName = jsonName[:j]
+	}
+	return fieldName, jsonName, true
+}
+
+func fieldTypeByPath(typ reflect.Type, path []string) reflect.Type {
+	for _, fn := range path {
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		sf, _ := typ.FieldByName(fn)
+		typ = sf.Type
+	}
+	return typ
+}
+
+const (
+	IdentityAlways    = "ALWAYS"
+	IdentityByDefault = "BY DEFAULT"
+)
+
 // Вывод FieldDescription в виде сткроки
 func (fd FieldDescription) String() string {
 	ret := fd.FieldName
@@ -0,0 +1,113 @@
+package pgparty
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+// ForeignKeyRef is a parsed `fk` tag value, e.g. `fk:"BasicModel.ID,ondelete=cascade,onupdate=restrict"`.
+// Fields with the same `name=` option are combined into one composite foreign key,
+// they must reference the same model with the same actions.
+type ForeignKeyRef struct {
+	Model    TypeName
+	Field    string
+	Name     string
+	OnDelete string
+	OnUpdate string
+}
+
+func ParseForeignKeyRef(s string) (ForeignKeyRef, error) {
+	ret := ForeignKeyRef{}
+	parts := strings.Split(s, ",")
+	ref := strings.Split(strings.TrimSpace(parts[0]), ".")
+	if len(ref) != 2 || len(ref[0]) == 0 || len(ref[1]) == 0 {
+		return ret, fmt.Errorf("foreign key reference must be Model.Field: %q", s)
+	}
+	ret.Model = TypeName(ref[0])
+	ret.Field = ref[1]
+
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			return ret, fmt.Errorf("foreign key option must be key=value: %q", p)
+		}
+		var err error
+		switch strings.ToLower(kv[0]) {
+		case "name":
+			ret.Name = strings.ToLower(kv[1])
+		case "ondelete":
+			ret.OnDelete, err = foreignKeyAction(kv[1])
+		case "onupdate":
+			ret.OnUpdate, err = foreignKeyAction(kv[1])
+		default:
+			err = fmt.Errorf("unknown foreign key option %q", kv[0])
+		}
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+func foreignKeyAction(s string) (string, error) {
+	switch strings.ToLower(strings.Join(strings.Fields(s), "")) {
+	case "cascade":
+		return "CASCADE", nil
+	case "restrict":
+		return "RESTRICT", nil
+	case "setnull":
+		return "SET NULL", nil
+	case "setdefault":
+		return "SET DEFAULT", nil
+	case "noaction":
+		return "NO ACTION", nil
+	}
+	return "", fmt.Errorf("unknown foreign key action %q", s)
+}
+
+// ForeignKey2SQL resolves the `fk` tag of the field against registered models of the store
+func (sr *PgStore) ForeignKey2SQL(tname string, f FieldDescription) (modelcols.SQLForeignKey, error) {
+	ref, err := ParseForeignKeyRef(f.ForeignKey)
+	if err != nil {
+		return modelcols.SQLForeignKey{}, fmt.Errorf("field %s: %w", f.FieldName, err)
+	}
+	refmd, ok := sr.ModelDescriptions()[ref.Model]
+	if !ok {
+		return modelcols.SQLForeignKey{}, fmt.Errorf("field %s: foreign key model %s is not registered", f.FieldName, ref.Model)
+	}
+	if refmd.IsView() {
+		return modelcols.SQLForeignKey{}, fmt.Errorf("field %s: foreign key model %s is a view", f.FieldName, ref.Model)
+	}
+	reffd, err := refmd.ColumnByFieldName(ref.Field)
+	if err != nil {
+		return modelcols.SQLForeignKey{}, fmt.Errorf("field %s: %w", f.FieldName, err)
+	}
+	ret := modelcols.SQLForeignKey{
+		Name:       ref.Name,
+		Columns:    []string{f.DatabaseName},
+		RefTable:   refmd.DatabaseName(),
+		RefColumns: []string{reffd.DatabaseName},
+		OnDelete:   ref.OnDelete,
+		OnUpdate:   ref.OnUpdate,
+	}
+	if len(ret.Name) == 0 {
+		ret.Name = strings.ToLower(tname + "_" + f.DatabaseName + "_fkey")
+	}
+	return ret, nil
+}
+
+// ForeignKeyModels returns type names of models referenced by foreign keys of md
+func (md *ModelDesc) ForeignKeyModels() []TypeName {
+	var ret []TypeName
+	for _, fd := range md.columnPtrs {
+		if !fd.IsStored() || len(fd.ForeignKey) == 0 {
+			continue
+		}
+		if ref, err := ParseForeignKeyRef(fd.ForeignKey); err == nil {
+			ret = UniqAdd(ret, ref.Model)
+		}
+	}
+	return ret
+}
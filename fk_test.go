@@ -0,0 +1,136 @@
+package pgparty
+
+import (
+	"context"
+	"testing"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+func TestParseForeignKeyRef(t *testing.T) {
+	ref, err := ParseForeignKeyRef("BasicModel.ID,ondelete=cascade,onupdate=set null")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Model != "BasicModel" || ref.Field != "ID" || ref.OnDelete != "CASCADE" || ref.OnUpdate != "SET NULL" {
+		t.Errorf("wrong ref: %+v", ref)
+	}
+
+	for _, s := range []string{"BasicModel", "BasicModel.ID,ondelete=drop", "BasicModel.ID,cascade"} {
+		if _, err := ParseForeignKeyRef(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestForeignKeyPatches(t *testing.T) {
+	fk := modelcols.SQLForeignKey{
+		Name:       "orders_item_id_fkey",
+		Columns:    []string{"item_id"},
+		RefTable:   "items",
+		RefColumns: []string{"id"},
+		OnDelete:   "CASCADE",
+	}
+	ct := PatchCreateTable{
+		Schema: "sh",
+		Table:  "orders",
+		Cols: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "item_id", DataType: "UUID", NotNull: true},
+		},
+		FKs: modelcols.SQLForeignKeys{fk},
+	}
+	if s := ct.String(); s != "CREATE TABLE sh.orders (id UUID NOT NULL,item_id UUID NOT NULL,PRIMARY KEY (id),"+
+		"CONSTRAINT orders_item_id_fkey FOREIGN KEY (item_id) REFERENCES sh.items (id) ON DELETE CASCADE)" {
+		t.Errorf("wrong create table: %s", s)
+	}
+
+	last := &modelcols.SQLModel{Table: "orders", Columns: ct.Cols, ForeignKeys: ct.FKs}
+	to := &modelcols.SQLModel{Table: "orders", Columns: ct.Cols, ForeignKeys: ct.FKs}
+	if !last.Equal(to) {
+		t.Errorf("models must be equal")
+	}
+
+	fk.OnDelete = ""
+	to.ForeignKeys = modelcols.SQLForeignKeys{fk}
+	if last.Equal(to) {
+		t.Errorf("models must not be equal")
+	}
+	pt, err := SQLAlterTablePatch("sh", "orders", last, to, nil, nil, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ALTER TABLE sh.orders DROP CONSTRAINT IF EXISTS orders_item_id_fkey",
+		"ALTER TABLE sh.orders ADD CONSTRAINT orders_item_id_fkey FOREIGN KEY (item_id) REFERENCES sh.items (id)",
+	}
+	qs := pt.Queries()
+	if len(qs) != len(want) {
+		t.Fatalf("wrong queries: %q", qs)
+	}
+	for i := range want {
+		if qs[i] != want[i] {
+			t.Errorf("query %d: %s, want: %s", i, qs[i], want[i])
+		}
+	}
+}
+
+type FkPair struct {
+	A Int64 `json:"a" pk:""`
+	B Int64 `json:"b" pk:""`
+}
+
+func (FkPair) DatabaseName() string       { return "pairs" }
+func (FkPair) TypeName() TypeName         { return StructModel[FkPair]{}.TypeName() }
+func (FkPair) Fields() []FieldDescription { return StructModel[FkPair]{}.Fields() }
+
+type FkPairMismatch struct {
+	ID Int64 `json:"id" pk:""`
+	A  Int64 `json:"a" fk:"FkPair.A,name=pairfk,ondelete=cascade"`
+	B  Int64 `json:"b" fk:"FkPair.B,name=pairfk"`
+}
+
+func (FkPairMismatch) DatabaseName() string       { return "pairrefs" }
+func (FkPairMismatch) TypeName() TypeName         { return StructModel[FkPairMismatch]{}.TypeName() }
+func (FkPairMismatch) Fields() []FieldDescription { return StructModel[FkPairMismatch]{}.Fields() }
+
+type FkPairRef struct {
+	ID Int64 `json:"id" pk:""`
+	A  Int64 `json:"a" fk:"FkPair.A,name=pairfk,ondelete=cascade"`
+	B  Int64 `json:"b" fk:"FkPair.B,name=pairfk,ondelete=cascade"`
+}
+
+func (FkPairRef) DatabaseName() string       { return "pairrefs" }
+func (FkPairRef) TypeName() TypeName         { return StructModel[FkPairRef]{}.TypeName() }
+func (FkPairRef) Fields() []FieldDescription { return StructModel[FkPairRef]{}.Fields() }
+
+func TestCompositeForeignKeyMismatch(t *testing.T) {
+	shs, ctx := NewShards(context.Background())
+	sh := shs.SetShard("sh", nil, "sh")
+	if err := Register(sh, MD[FkPair]{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(sh, MD[FkPairMismatch]{}); err != nil {
+		t.Fatal(err)
+	}
+	md := sh.Store.ModelDescriptions()[FkPairMismatch{}.TypeName()]
+	if _, err := sh.Store.MD2SQLModel(WithShard(ctx, sh), md); err == nil {
+		t.Error("composite foreign key with different actions must be rejected")
+	}
+
+	sh = shs.SetShard("sh2", nil, "sh2")
+	if err := Register(sh, MD[FkPair]{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(sh, MD[FkPairRef]{}); err != nil {
+		t.Fatal(err)
+	}
+	md = sh.Store.ModelDescriptions()[FkPairRef{}.TypeName()]
+	m, err := sh.Store.MD2SQLModel(WithShard(ctx, sh), md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.ForeignKeys) != 1 || len(m.ForeignKeys[0].Columns) != 2 || m.ForeignKeys[0].OnDelete != "CASCADE" {
+		t.Errorf("wrong composite foreign key: %+v", m.ForeignKeys)
+	}
+}
@@ -0,0 +1,173 @@
+package pgparty
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/covrom/pgparty/modelcols"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	FullTextColumn        = "fts"    // generated TSVECTOR column of fulltext fields
+	FullTextIndex         = "ftsidx" // GIN index of FullTextColumn
+	DefaultFullTextConfig = "simple"
+)
+
+// FullText2SQL builds the generated TSVECTOR column and its GIN index from fields with fulltext tag,
+// ok is false if the model has no such fields
+func FullText2SQL(md *ModelDesc) (col modelcols.SQLColumn, idx modelcols.SQLIndex, ok bool) {
+	cfg := quoteSQLString(md.FullTextConfig()) + "::regconfig"
+	var exprs []string
+	for fdIdx := 0; fdIdx < md.ColumnPtrsCount(); fdIdx++ {
+		f := md.ColumnPtr(fdIdx)
+		if !f.IsStored() || !f.FullTextEnabled {
+			continue
+		}
+		expr := fmt.Sprintf("to_tsvector(%s, coalesce(%s::text, ''))", cfg, f.DatabaseName)
+		if len(f.FullTextWeight) > 0 {
+			expr = fmt.Sprintf("setweight(%s, '%s')", expr, f.FullTextWeight)
+		}
+		exprs = append(exprs, expr)
+	}
+	if len(exprs) == 0 {
+		return col, idx, false
+	}
+	col = modelcols.SQLColumn{
+		ColName:   FullTextColumn,
+		DataType:  "TSVECTOR",
+		Generated: strings.Join(exprs, " || "),
+	}
+	idx = modelcols.SQLIndex{
+		Name:       FullTextIndex,
+		Columns:    []string{FullTextColumn},
+		MethodName: "gin",
+	}
+	return col, idx, true
+}
+
+type SearchParser string
+
+const (
+	SearchWebsearch SearchParser = "websearch_to_tsquery" // search engine syntax: "quoted phrase", or, -exclude
+	SearchPlain     SearchParser = "plainto_tsquery"      // all words
+	SearchPhrase    SearchParser = "phraseto_tsquery"     // words in the given order
+	SearchRaw       SearchParser = "to_tsquery"           // tsquery syntax with & | ! <-> operators
+)
+
+// SearchOptions controls fulltext search of the model
+type SearchOptions struct {
+	// Parser of the search query, SearchWebsearch by default
+	Parser SearchParser
+	// Where is an additional condition with &Model and :Field replacements and ? placeholders of Args
+	Where string
+	Args  []interface{}
+	// Highlight is a struct field name that is returned as a headline with marked query words
+	Highlight string
+	// HighlightOptions are ts_headline options, e.g. "StartSel=<b>, StopSel=</b>, MaxWords=20"
+	HighlightOptions string
+	Limit            int
+	Offset           int
+}
+
+// SearchResult is a found model item ordered by Rank
+type SearchResult[T Modeller] struct {
+	Item     T
+	Rank     float64
+	Headline string
+}
+
+const (
+	searchRankColumn     = "fts_rank"
+	searchHeadlineColumn = "fts_headline"
+)
+
+func (r *SearchResult[T]) RowScan(rows sqlx.ColScanner) error {
+	md, err := (MD[T]{Val: r.Item}).MD()
+	if err != nil {
+		return err
+	}
+	_, err = scanModelStruct(rows, md, reflect.ValueOf(&r.Item).Elem(), "", map[string]interface{}{
+		searchRankColumn:     &r.Rank,
+		searchHeadlineColumn: &r.Headline,
+	})
+	return err
+}
+
+func Search[T Modeller](ctx context.Context, query string, opts SearchOptions) ([]SearchResult[T], error) {
+	s, err := ShardFromContext(ctx)
+	if err != nil {
+		_, file, no, ok := runtime.Caller(1)
+		if ok {
+			log.Printf("Search error at %s line %d: %s", file, no, err)
+		}
+		return nil, fmt.Errorf("Search: %w", err)
+	}
+	md, ok := s.Store.GetModelDescription(*new(T))
+	if !ok {
+		return nil, fmt.Errorf("Search error: can't get model description for %T in schema %q", *new(T), s.Store.Schema())
+	}
+	q, args, err := s.Store.SearchQuery(md, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var ret []SearchResult[T]
+	if err := s.Store.PrepSelect(ctx, q, &ret, args...); err != nil {
+		return nil, fmt.Errorf("Search %s: %w", md.TypeName(), err)
+	}
+	return ret, nil
+}
+
+// SearchQuery returns the fulltext search query of the model with &Model replacements and its arguments,
+// found rows are ordered by rank of the match
+func (sr *PgStore) SearchQuery(md *ModelDesc, query string, opts SearchOptions) (string, []interface{}, error) {
+	if md.IsView() {
+		return "", nil, fmt.Errorf("SearchQuery: %s is a view", md.TypeName())
+	}
+	if _, _, ok := FullText2SQL(md); !ok {
+		return "", nil, fmt.Errorf("SearchQuery: %s has no fulltext fields", md.TypeName())
+	}
+	parser := opts.Parser
+	if len(parser) == 0 {
+		parser = SearchWebsearch
+	}
+	switch parser {
+	case SearchWebsearch, SearchPlain, SearchPhrase, SearchRaw:
+	default:
+		return "", nil, fmt.Errorf("SearchQuery: unknown parser %q", parser)
+	}
+	cfg := quoteSQLString(md.FullTextConfig()) + "::regconfig"
+	tn := string(md.TypeName())
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "SELECT :%s.*, ts_rank(%s, _q) AS %s", tn, FullTextColumn, searchRankColumn)
+	if len(opts.Highlight) > 0 {
+		fd, err := md.ColumnByFieldName(opts.Highlight)
+		if err != nil {
+			return "", nil, fmt.Errorf("SearchQuery: %w", err)
+		}
+		hlopts := ""
+		if len(opts.HighlightOptions) > 0 {
+			hlopts = ", " + quoteSQLString(opts.HighlightOptions)
+		}
+		fmt.Fprintf(sb, ", ts_headline(%s, coalesce(%s::text, ''), _q%s) AS %s", cfg, fd.DatabaseName, hlopts, searchHeadlineColumn)
+	}
+	fmt.Fprintf(sb, " FROM &%s, %s(%s, ?) AS _q WHERE %s @@ _q", tn, parser, cfg, FullTextColumn)
+	args := []interface{}{query}
+	if len(opts.Where) > 0 {
+		fmt.Fprintf(sb, " AND (%s)", opts.Where)
+		args = append(args, opts.Args...)
+	}
+	fmt.Fprintf(sb, " ORDER BY %s DESC", searchRankColumn)
+	if opts.Limit > 0 {
+		fmt.Fprintf(sb, " LIMIT %d", opts.Limit)
+	}
+	if opts.Offset > 0 {
+		fmt.Fprintf(sb, " OFFSET %d", opts.Offset)
+	}
+	return sb.String(), args, nil
+}
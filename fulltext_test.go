@@ -0,0 +1,72 @@
+package pgparty
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type Article struct {
+	ID    UUIDv4 `json:"id"`
+	Title String `json:"title" fulltext:"A"`
+	Body  Text   `json:"body" fulltext:"true"`
+	Draft Bool   `json:"draft"`
+}
+
+func (Article) DatabaseName() string       { return "articles" }
+func (Article) TypeName() TypeName         { return StructModel[Article]{}.TypeName() }
+func (Article) Fields() []FieldDescription { return StructModel[Article]{}.Fields() }
+func (Article) FullTextConfig() string     { return "english" }
+
+func TestFullTextModel(t *testing.T) {
+	shs, ctx := NewShards(context.Background())
+	sh := shs.SetShard("sh", nil, "sh")
+	if err := Register(sh, MD[Article]{}); err != nil {
+		t.Fatal(err)
+	}
+	md := sh.Store.ModelDescriptions()[Article{}.TypeName()]
+	m, err := sh.Store.MD2SQLModel(WithShard(ctx, sh), md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := &PatchTable{Schema: "sh", Name: "articles"}
+	SQLCreateTableWithColumns(pt, m)
+	q := pt.Queries()
+	wantcol := "fts TSVECTOR GENERATED ALWAYS AS (" +
+		"setweight(to_tsvector('english'::regconfig, coalesce(title::text, '')), 'A') || " +
+		"to_tsvector('english'::regconfig, coalesce(body::text, ''))) STORED"
+	if !strings.Contains(q[0], wantcol) {
+		t.Errorf("no fulltext column in:\n%s", q[0])
+	}
+	if len(q) != 2 || !strings.Contains(q[1], "articlesftsidx ON sh.articles USING gin") {
+		t.Errorf("no fulltext index in:\n%s", strings.Join(q, "\n"))
+	}
+
+	sq, args, err := sh.Store.SearchQuery(md, "go -java", SearchOptions{
+		Where:     ":Draft = ?",
+		Args:      []interface{}{false},
+		Highlight: "Body",
+		Limit:     10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 2 {
+		t.Errorf("wrong search args: %v", args)
+	}
+	pq, err := sh.Store.PrepareQuery(WithShard(ctx, sh), sq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT sh.articles.*, ts_rank(fts, _q) AS fts_rank, " +
+		"ts_headline('english'::regconfig, coalesce(body::text, ''), _q) AS fts_headline " +
+		"FROM sh.articles, websearch_to_tsquery('english'::regconfig, $1) AS _q " +
+		"WHERE fts @@ _q AND (draft = $2) ORDER BY fts_rank DESC LIMIT 10"
+	if pq != want {
+		t.Errorf("wrong search query:\n%s\nwant:\n%s", pq, want)
+	}
+
+	if _, _, err := sh.Store.SearchQuery(md, "go", SearchOptions{Parser: "bad"}); err == nil {
+		t.Error("unknown parser must fail")
+	}
+}
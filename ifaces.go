@@ -8,6 +8,11 @@ type Modeller interface {
 	Fields() []FieldDescription
 	// optional Viewable
 	// optional MaterializedViewable
+	// optional Constrainer
+	// optional Indexer
+	// optional Describer
+	// optional Partitioner
+	// optional FullTextConfigurer
 }
 
 // Viewable is an interface that the view-model structure must implement
@@ -21,3 +26,63 @@ type MaterializedViewable interface {
 	Viewable
 	MaterializedView() bool
 }
+
+// Constrainer is an optional interface of the model with table constraints
+type Constrainer interface {
+	Constraints() []ModelConstraint
+}
+
+// ModelConstraint is a CHECK constraint with Check expression
+// or a multi-column UNIQUE constraint with Unique struct field names.
+// Check expression can use :FieldName replacements.
+type ModelConstraint struct {
+	Name   string
+	Check  string
+	Unique []string
+}
+
+// Indexer is an optional interface of the model with indexes
+// that can't be declared by field tags
+type Indexer interface {
+	Indexes() []ModelIndex
+}
+
+// ModelIndex is a model level index declaration.
+// Fields, Include are struct field names.
+// Expressions and Where can use :FieldName replacements, e.g. "lower(:Email)", ":DeletedAt IS NULL".
+// With is a storage parameters list, e.g. "fillfactor=70".
+type ModelIndex struct {
+	Name         string
+	Fields       []string
+	Expressions  []string
+	Include      []string
+	Unique       bool
+	Method       string
+	Where        string
+	With         string
+	Concurrently bool
+}
+
+// Describer is an optional interface of the model with the table or view comment
+type Describer interface {
+	DatabaseComment() string
+}
+
+// Partitioner is an optional interface of the model stored as a partitioned table
+type Partitioner interface {
+	Partitioning() ModelPartitioning
+}
+
+// ModelPartitioning declares PARTITION BY of the table.
+// Fields are struct field names of the partition key, they must be in the primary key.
+// Zero value is a plain table.
+type ModelPartitioning struct {
+	Method PartitionMethod
+	Fields []string
+}
+
+// FullTextConfigurer is an optional interface of the model with the text search configuration
+// of its fulltext fields, e.g. "english", DefaultFullTextConfig by default
+type FullTextConfigurer interface {
+	FullTextConfig() string
+}
@@ -0,0 +1,65 @@
+package pgparty
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+// ModelIndexes2SQL builds partial, expression and covering indexes declared by Indexer model
+func (sr *PgStore) ModelIndexes2SQL(ctx context.Context, md *ModelDesc) (modelcols.SQLIndexes, error) {
+	var ret modelcols.SQLIndexes
+
+	fieldCols := func(fns []string) ([]string, error) {
+		cols := make([]string, 0, len(fns))
+		for _, fn := range fns {
+			fd, err := md.ColumnByFieldName(fn)
+			if err != nil {
+				return nil, err
+			}
+			cols = append(cols, fd.DatabaseName)
+		}
+		return cols, nil
+	}
+
+	for _, mi := range md.Indexes() {
+		if len(mi.Name) == 0 {
+			return nil, fmt.Errorf("index of %s must have a name", md.TypeName())
+		}
+		if len(mi.Fields) == 0 && len(mi.Expressions) == 0 {
+			return nil, fmt.Errorf("index %q of %s has no fields and expressions", mi.Name, md.TypeName())
+		}
+		sqi := modelcols.SQLIndex{
+			Name:         strings.ToLower(mi.Name),
+			IsUnique:     mi.Unique,
+			MethodName:   mi.Method,
+			Concurrently: mi.Concurrently,
+			With:         mi.With,
+		}
+		var err error
+		if sqi.Columns, err = fieldCols(mi.Fields); err != nil {
+			return nil, err
+		}
+		if len(mi.Include) > 0 {
+			if sqi.Include, err = fieldCols(mi.Include); err != nil {
+				return nil, err
+			}
+		}
+		for _, e := range mi.Expressions {
+			expr, err := sr.PrepareQuery(ctx, e)
+			if err != nil {
+				return nil, err
+			}
+			sqi.Expressions = append(sqi.Expressions, expr)
+		}
+		if len(mi.Where) > 0 {
+			if sqi.Where, err = sr.PrepareQuery(ctx, mi.Where); err != nil {
+				return nil, err
+			}
+		}
+		ret = append(ret, sqi)
+	}
+	return ret, nil
+}
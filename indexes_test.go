@@ -0,0 +1,123 @@
+package pgparty
+
+import (
+	"testing"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+func TestModelIndexPatches(t *testing.T) {
+	idx := modelcols.SQLIndex{
+		Name:        "email_lower_idx",
+		IsUnique:    true,
+		Columns:     []string{"shop"},
+		Expressions: []string{"lower(email)"},
+		Include:     []string{"name"},
+		With:        "fillfactor=70",
+		Where:       "deleted_at IS NULL",
+	}
+	ci := PatchCreateIndex{Schema: "sh", Table: "users", Index: idx}
+	want := "CREATE UNIQUE INDEX usersemail_lower_idx ON sh.users(shop, (lower(email)) ) " +
+		"INCLUDE (name) WITH (fillfactor=70) WHERE deleted_at IS NULL"
+	if s := ci.String(); s != want {
+		t.Errorf("wrong create index:\n%s\nwant:\n%s", s, want)
+	}
+
+	dbidx := DBIndexDef{
+		Name:      "usersemail_lower_idx",
+		Fields:    []string{"shop", "lower((email)::text)", "name"},
+		Method:    "btree",
+		IsUnique:  true,
+		Predicate: "(deleted_at IS NULL)",
+		Options:   []string{"fillfactor=70"},
+	}
+	if !IndexEqualDBIndex("users", idx, dbidx) {
+		t.Errorf("index must be equal to db index")
+	}
+
+	drifts := map[string]func(d *DBIndexDef){
+		"include": func(d *DBIndexDef) { d.Fields = []string{"shop", "lower((email)::text)"} },
+		"expr":    func(d *DBIndexDef) { d.Fields = []string{"shop", "upper((email)::text)", "name"} },
+		"order":   func(d *DBIndexDef) { d.Fields = []string{"lower((email)::text)", "shop", "name"} },
+		"method":  func(d *DBIndexDef) { d.Method = "hash" },
+		"unique":  func(d *DBIndexDef) { d.IsUnique = false },
+		"where":   func(d *DBIndexDef) { d.Predicate = "(deleted_at IS NOT NULL)" },
+		"with":    func(d *DBIndexDef) { d.Options = nil },
+	}
+	for name, drift := range drifts {
+		d := dbidx
+		drift(&d)
+		if IndexEqualDBIndex("users", idx, d) {
+			t.Errorf("%s drift is not detected", name)
+		}
+	}
+}
+
+func TestIndexColumnsOrder(t *testing.T) {
+	idx := modelcols.SQLIndex{Name: "shop_created_idx", Columns: []string{"shop", "created_at"}, Include: []string{"a", "b"}}
+	dbidx := DBIndexDef{Name: "ordersshop_created_idx", Fields: []string{"shop", "created_at", "b", "a"}, Method: "btree"}
+	if !IndexEqualDBIndex("orders", idx, dbidx) {
+		t.Errorf("index must be equal to db index with included columns in other order")
+	}
+	dbidx.Fields = []string{"created_at", "shop", "a", "b"}
+	if IndexEqualDBIndex("orders", idx, dbidx) {
+		t.Errorf("order of index keys is not compared with db index")
+	}
+	swapped := idx
+	swapped.Columns = []string{"created_at", "shop"}
+	if idx.Equal(swapped) {
+		t.Errorf("order of index keys is not compared with stored index")
+	}
+}
+
+func TestIndexReadBack(t *testing.T) {
+	idx := modelcols.SQLIndex{Name: "active_idx", Columns: []string{"shop"}, Where: "status != 'x' AND kind IN ('a', 'b')"}
+	def := "CREATE INDEX itemsactive_idx ON sh.items USING btree (shop) WHERE (((status)::text <> 'x'::text) AND " +
+		"((kind)::text = ANY ((ARRAY['a'::character varying, 'b'::character varying])::text[])))"
+	dbidx := DBIndexDef{
+		Name:       "itemsactive_idx",
+		Fields:     []string{"shop"},
+		Method:     "btree",
+		Predicate:  "(status)::text <> 'x'::text AND (kind)::text = ANY (ARRAY['a'::character varying, 'b'::character varying]::text[])",
+		Definition: def,
+	}
+	if IndexEqualDBIndex("items", idx, dbidx) {
+		t.Errorf("rewritten predicate can't be compared by text")
+	}
+
+	// база сравнивается с определением, прочитанным после миграции
+	stored := &modelcols.SQLModel{Table: "items", Indexes: modelcols.SQLIndexes{idx}}
+	readBackIndexes(stored, DBIndexDefs{dbidx}, false)
+	target := &modelcols.SQLModel{Table: "items", Indexes: modelcols.SQLIndexes{idx}}
+	target.KeepDBDefs(stored)
+	if !IndexesEqualToDBIndexes(target, DBIndexDefs{dbidx}) || !stored.Equal(target) {
+		t.Errorf("index must be equal to its read back definition")
+	}
+	if !IndexesEqualToDBIndexes(target, ExpectedDBIndexes("sh", stored)) {
+		t.Errorf("index must be equal to expected index of the config")
+	}
+	drifted := dbidx
+	drifted.Definition = "CREATE INDEX itemsactive_idx ON sh.items USING btree (shop)"
+	if IndexEqualDBIndex("items", target.Indexes[0], drifted) {
+		t.Errorf("drift from the read back definition is not detected")
+	}
+
+	changed := &modelcols.SQLModel{Table: "items", Indexes: modelcols.SQLIndexes{idx}}
+	changed.Indexes[0].Where = "status != 'y'"
+	changed.KeepDBDefs(stored)
+	if len(changed.Indexes[0].DBDef) > 0 {
+		t.Errorf("definition of the changed index must not be kept")
+	}
+
+	// конкурентный индекс читается после сборки
+	conc := &modelcols.SQLModel{Table: "items", Indexes: modelcols.SQLIndexes{idx}}
+	conc.Indexes[0].Concurrently = true
+	readBackIndexes(conc, DBIndexDefs{dbidx}, false)
+	if len(conc.Indexes[0].DBDef) > 0 {
+		t.Errorf("concurrent index must be read back after build")
+	}
+	readBackIndexes(conc, DBIndexDefs{dbidx}, true)
+	if conc.Indexes[0].DBDef != def {
+		t.Errorf("concurrent index is not read back: %q", conc.Indexes[0].DBDef)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 
 	jsoniter "github.com/json-iterator/go"
 )
@@ -132,14 +133,32 @@ func (mo *JsonView[T]) MarshalJSON() ([]byte, error) {
 	enc := json.NewEncoder(b)
 	b.WriteByte('{')
 	comma := false
+	mrv := reflect.ValueOf(mo.V)
+	parents := make(map[string]bool)
 	for _, fd := range mo.Filled {
-		rv := reflect.ValueOf(mo.V).FieldByName(fd.FieldName)
+		if fd.JsonName == "" {
+			continue
+		}
+		name, omitEmpty := fd.JsonName, fd.JsonOmitEmpty
+		var rv reflect.Value
+		if pf, pj, ok := fd.embedParent(); ok {
+			// вложенная структура выводится одним объектом
+			if parents[pf] {
+				continue
+			}
+			parents[pf] = true
+			sf, _ := mrv.Type().FieldByName(pf)
+			rv = mrv.FieldByName(pf)
+			name, omitEmpty = pj, strings.Contains(sf.Tag.Get("json"), ",omitempty")
+		} else {
+			rv, _ = fd.structValue(mrv)
+		}
 		v := rv.Interface()
-		if v == nil || fd.JsonName == "" {
+		if v == nil {
 			continue
 		}
 
-		if fd.JsonOmitEmpty && rv.IsZero() {
+		if omitEmpty && rv.IsZero() {
 			continue
 		}
 
@@ -147,7 +166,7 @@ func (mo *JsonView[T]) MarshalJSON() ([]byte, error) {
 			b.WriteByte(',')
 		}
 		b.WriteByte('"')
-		b.WriteString(fd.JsonName)
+		b.WriteString(name)
 		b.WriteByte('"')
 		b.WriteByte(':')
 
@@ -190,18 +209,26 @@ func (mo *JsonView[T]) UnmarshalJSON(b []byte) error {
 	iter.ReadObjectCB(func(it *jsoniter.Iterator, k string) bool {
 		fd, err := mo.MD.ColumnByJsonName(k)
 		if err != nil {
+			// вложенная структура читается одним объектом
+			if pf, leafs := mo.MD.embedColumnsByJsonName(k); len(leafs) > 0 {
+				mo.Filled = append(mo.Filled, leafs...)
+				it.ReadVal(morv.Elem().FieldByName(pf).Addr().Interface())
+			} else {
+				it.Skip()
+			}
 			return true
 		}
 
 		if fd.JsonSkip {
 			newv := reflect.Zero(fd.ElemType)
-			morv.Elem().FieldByName(fd.FieldName).Set(newv)
+			fv, _ := fd.structValue(morv.Elem())
+			fv.Set(newv)
 			return true
 		}
 
 		mo.Filled = append(mo.Filled, fd)
-		f := morv.Elem().FieldByName(fd.FieldName).Addr().Interface()
-		it.ReadVal(f)
+		fv, _ := fd.structValue(morv.Elem())
+		it.ReadVal(fv.Addr().Interface())
 
 		return true
 	})
@@ -217,8 +244,7 @@ func (mo *JsonView[T]) Value() (driver.Value, error) {
 	b.WriteByte('{')
 	comma := false
 	for _, fd := range mo.Filled {
-		rv := reflect.ValueOf(mo.V).FieldByName(fd.FieldName)
-		v := rv.Interface()
+		v := fd.readValue(reflect.ValueOf(mo.V))
 		if fd.Skip {
 			continue
 		}
@@ -295,12 +321,19 @@ func (mo *JsonView[T]) Scan(value interface{}) error {
 
 		if fd.Skip {
 			newv := reflect.Zero(fd.ElemType)
-			morv.Elem().FieldByName(fd.FieldName).Set(newv)
+			fv, _ := fd.structValue(morv.Elem())
+			fv.Set(newv)
 			return true
 		}
 
 		mo.Filled = append(mo.Filled, fd)
-		f := morv.Elem().FieldByName(fd.FieldName).Addr().Interface()
+		if it.WhatIsNext() == jsoniter.NilValue && fd.embedPtr(morv.Elem().Type()) {
+			// не создаем вложенную структуру для null значений
+			it.Skip()
+			return true
+		}
+		fv, _ := fd.structValue(morv.Elem())
+		f := fv.Addr().Interface()
 		if IsJsonView(f) &&
 			it.WhatIsNext() == jsoniter.ObjectValue {
 			if err := f.(sql.Scanner).Scan(it.SkipAndReturnBytes()); err != nil {
@@ -89,6 +89,13 @@ type ModelDesc struct {
 	viewQuery      string
 	isView         bool
 	isMaterialized bool
+
+	constraints []ModelConstraint
+	indexes     []ModelIndex
+	comment     string
+
+	partitioning ModelPartitioning
+	ftsConfig    string
 }
 
 func (md ModelDesc) Modeller() Modeller {
@@ -132,6 +139,34 @@ func (md ModelDesc) ViewQuery(ctx context.Context, sr *PgStore) (string, error)
 	return sr.PrepareQuery(ctx, md.viewQuery)
 }
 
+func (md ModelDesc) Constraints() []ModelConstraint {
+	return md.constraints
+}
+
+func (md ModelDesc) Indexes() []ModelIndex {
+	return md.indexes
+}
+
+func (md ModelDesc) Comment() string {
+	return md.comment
+}
+
+func (md ModelDesc) Partitioning() ModelPartitioning {
+	return md.partitioning
+}
+
+func (md ModelDesc) IsPartitioned() bool {
+	return len(md.partitioning.Method) > 0
+}
+
+// FullTextConfig returns the text search configuration of fulltext fields
+func (md ModelDesc) FullTextConfig() string {
+	if len(md.ftsConfig) == 0 {
+		return DefaultFullTextConfig
+	}
+	return md.ftsConfig
+}
+
 func viewAttrs(m any) (isView, isMaterialized bool, viewQuery string) {
 	var v Viewable
 	var vm MaterializedViewable
@@ -182,6 +217,20 @@ func (md ModelDesc) ColumnByJsonName(jsonName string) (*FieldDescription, error)
 	return field, nil
 }
 
+// embedColumnsByJsonName returns the top level field name of the embed struct with the json name
+// and the columns of its fields
+func (md ModelDesc) embedColumnsByJsonName(jsonName string) (fieldName string, fds []*FieldDescription) {
+	for _, fd := range md.columnPtrs {
+		pf, pj, ok := fd.embedParent()
+		if !ok || pj != jsonName || fd.JsonSkip {
+			continue
+		}
+		fieldName = pf
+		fds = append(fds, fd)
+	}
+	return fieldName, fds
+}
+
 func (md ModelDesc) ColumnByDatabaseName(storeName string) (*FieldDescription, error) {
 	field, ok := md.columnByName[storeName]
 	if !ok {
@@ -201,6 +250,26 @@ func (md *ModelDesc) Init(m Modeller) error {
 
 	md.isView, md.isMaterialized, md.viewQuery = viewAttrs(m)
 
+	if c, ok := m.(Constrainer); ok {
+		md.constraints = c.Constraints()
+	}
+
+	if ix, ok := m.(Indexer); ok {
+		md.indexes = ix.Indexes()
+	}
+
+	if d, ok := m.(Describer); ok {
+		md.comment = d.DatabaseComment()
+	}
+
+	if p, ok := m.(Partitioner); ok && !md.isView {
+		md.partitioning = p.Partitioning()
+	}
+
+	if c, ok := m.(FullTextConfigurer); ok {
+		md.ftsConfig = c.FullTextConfig()
+	}
+
 	// fill shortcuts
 	for i := range columns {
 		column := &columns[i]
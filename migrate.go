@@ -3,20 +3,88 @@ package pgparty
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 )
 
 func (sr *PgStore) Migrate(ctx context.Context, mProcessor MigrationProcessor) error {
+	_, err := sr.migrate(ctx, nil, mProcessor)
+	return err
+}
+
+// migrate plans and applies migration of all models and returns plans of changed models,
+// when approved plan is not nil, it is applied instead of the computed one
+func (sr *PgStore) migrate(ctx context.Context, approved *MigrationPlan, mProcessor MigrationProcessor) (*MigrationPlan, error) {
 	shard, err := ShardFromContext(ctx)
 	if err != nil {
-		return fmt.Errorf("Migrate: %w", err)
+		return nil, fmt.Errorf("Migrate: %w", err)
+	}
+	opts := MigrationOptionsFromContext(ctx)
+	applied := &MigrationPlan{
+		Schema: sr.Schema(),
+	}
+	// новые значения ENUM нельзя использовать в транзакции, которая их добавила,
+	// поэтому они коммитятся до изменения таблиц
+	committed := false
+	if sr.tx == nil {
+		added, err := sr.commitEnumValues(ctx, approved, opts)
+		if err != nil {
+			return nil, err
+		}
+		applied.Enums = added
+		committed = true
 	}
+	// планы с CREATE/DROP INDEX CONCURRENTLY, они выполняются после коммита
+	var concurrent []ModelPlan
 	if e := sr.WithTx(ctx, func(stx *PgStore) error {
-		tx := stx.tx
 		ctxTx := WithShard(ctx, Shard{shard.ID, stx})
 		mdsn := stx.Schema()
-		mds := stx.ModelDescriptions()
+
+		// DDL применяет только один экземпляр сервиса, остальные ждут его коммита
+		// и затем сверяют схему с моделями, применяя только оставшиеся отличия
+		waited, err := stx.lockMigration(ctxTx, opts.LockTimeout)
+		if err != nil {
+			return err
+		}
+		if waited {
+			log.Printf("schema %s was migrated by another instance, verifying", mdsn)
+		}
+
+		mds, err := MigrationOrder(stx.ModelDescriptions())
+		if err != nil {
+			return err
+		}
+		// ENUM типы создаются до таблиц, которые их используют
+		if _, err := stx.tx.ExecContext(ctxTx, `CREATE SCHEMA IF NOT EXISTS `+mdsn); err != nil {
+			return err
+		}
+		// таблица миграций для процессоров миграций моделей, один раз на миграцию
+		if err := ensureMigrationsTable(ctxTx, stx.tx, mdsn); err != nil {
+			return err
+		}
+		enums, err := stx.planEnums(ctxTx, mds, opts)
+		if err != nil {
+			return err
+		}
+		if approved != nil {
+			want := approved.Enums
+			if committed {
+				want = want.WithoutKind(StepAddEnumValue)
+			}
+			if !slices.Equal(want.Queries(), enums.Queries()) {
+				return ErrorMigrationPlanOutdated{Schema: mdsn, Table: "enums"}
+			}
+		}
+		if err := stx.execEnumSteps(ctxTx, enums); err != nil {
+			return err
+		}
+		applied.Enums = append(applied.Enums, enums...)
+
+		// представления, которые удалены вместе с измененными представлениями и создаются заново
+		recreate := make(map[TypeName]bool)
 		// 	if _, err := tx.ExecContext(ctxTx, `DROP SCHEMA IF EXISTS public`); err != nil {
 		// 		log.Println(err)
 		// 	}
@@ -31,74 +99,122 @@ func (sr *PgStore) Migrate(ctx context.Context, mProcessor MigrationProcessor) e
 				return err
 			}
 
-			dbidxs, err := CurrentSchemaIndexes(ctxTx, md.DatabaseName())
-			if err != nil {
-				return fmt.Errorf("Migrate CurrentSchemaIndexes error: %w", err)
-			}
-
-			log.Printf("db table %s have indexes: %s", mdsn+"."+md.DatabaseName(), dbidxs)
-
-			// грузим конфиг схемы
-			dbconf := &DbConfigTable{}
-			if err := dbconf.LoadTable(ctxTx, md.DatabaseName()); err != nil {
-				return err
-			}
-
-			sqsmd, err := stx.MD2SQLModel(ctxTx, md)
+			mp, err := stx.PlanModel(ctxTx, md)
 			if err != nil {
-				return err
-			}
-
-			if dbconf.IsEmpty() {
-				// пустая - создаем
-				if err := SQLCreateModelWithColumns(ctxTx, md, sqsmd); err != nil {
-					return err
-				}
-				if mProcessor != nil {
-					if err := mProcessor.AfterCreateNewSchemaTable(ctxTx, stx, md, mdsn); err != nil {
-						return err
+				var pkerr ErrorPrimaryKeyChange
+				var tperr ErrorUnsafeColumnTypeChange
+				if (errors.As(err, &pkerr) || errors.As(err, &tperr)) && mProcessor != nil {
+					if err2 := mProcessor.AfterAlterModelError(ctxTx, err, stx, md, mp.From, mp.To, mdsn); err2 != nil {
+						return err2
 					}
 				}
-				continue
+				return err
 			}
+			mp = stx.planDependentViews(mds, recreate, md, mp)
 
-			sqsdb := dbconf.Storej
-
-			if !(sqsdb.Equal(sqsmd) && IndexesEqualToDBIndexes(sqsmd, dbidxs)) {
-				// модифицируем таблицу
-				err := SQLAlterModel(ctxTx, md, dbidxs, sqsdb, sqsmd)
-				if err != nil {
-					if mProcessor != nil {
-						if err2 := mProcessor.AfterAlterModelError(ctxTx, err, stx, md, sqsdb, sqsmd, mdsn); err2 != nil {
-							return err2
-						}
-					}
-					return err
+			if approved != nil {
+				// применяем только одобренный план, если состояние схемы не изменилось
+				amp, ok := approved.FindModel(md.TypeName())
+				if !ok || amp.Fingerprint != mp.Fingerprint {
+					return ErrorMigrationPlanOutdated{Schema: mdsn, Table: md.DatabaseName()}
 				}
+				mp = amp
 			}
 
-			// миграции
-			if _, err := tx.ExecContext(ctxTx,
-				`CREATE TABLE IF NOT EXISTS `+mdsn+`._migrations (name VARCHAR(250) NOT NULL, PRIMARY KEY (name))`); err != nil {
+			if err := stx.ApplyModelPlan(ctxTx, md, mp, mProcessor); err != nil {
 				return err
 			}
-			if mProcessor != nil {
-				if err := mProcessor.AfterMigrate(ctxTx, stx, sr, sqsdb, sqsmd, mdsn); err != nil {
-					return err
+			if mp.Action != MigrationActionNone {
+				applied.Models = append(applied.Models, mp)
+			}
+
+			if len(mp.Steps.Concurrent()) > 0 {
+				if sr.tx != nil {
+					return fmt.Errorf("Migrate %s: concurrent index steps can't be applied inside a transaction", md.DatabaseName())
 				}
+				concurrent = append(concurrent, mp)
 			}
 		}
-		return nil
+
+		// таблицы и представления моделей, которые больше не зарегистрированы
+		return stx.cleanupOrphans(ctxTx, opts)
 	}); e != nil {
-		return e
+		return nil, e
+	}
+
+	// вторая фаза - без транзакции
+	if len(concurrent) > 0 {
+		unlock, err := sr.lockConcurrent(ctx, opts.LockTimeout)
+		if err != nil {
+			return applied, err
+		}
+		defer unlock()
+		for _, mp := range concurrent {
+			if err := sr.ApplyConcurrentSteps(ctx, mp); err != nil {
+				return applied, err
+			}
+		}
+	}
+
+	// миграции данных - после структурной миграции
+	if err := sr.ApplyDataMigrations(ctx); err != nil {
+		return applied, err
 	}
 
 	if mProcessor != nil {
 		if err := mProcessor.AfterCommit(ctx, sr); err != nil {
+			return applied, err
+		}
+	}
+
+	return applied, nil
+}
+
+// commitEnumValues adds new values to existing ENUM types in a separate transaction and returns applied steps
+func (sr *PgStore) commitEnumValues(ctx context.Context, approved *MigrationPlan, opts MigrationOptions) (PatchSteps, error) {
+	shard, err := ShardFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Migrate: %w", err)
+	}
+	var added PatchSteps
+	err = sr.WithTx(ctx, func(stx *PgStore) error {
+		ctxTx := WithShard(ctx, Shard{shard.ID, stx})
+		if _, err := stx.lockMigration(ctxTx, opts.LockTimeout); err != nil {
 			return err
 		}
+		mds, err := MigrationOrder(stx.ModelDescriptions())
+		if err != nil {
+			return err
+		}
+		if _, err := stx.tx.ExecContext(ctxTx, `CREATE SCHEMA IF NOT EXISTS `+stx.Schema()); err != nil {
+			return err
+		}
+		enums, err := stx.planEnums(ctxTx, mds, opts)
+		if err != nil {
+			return err
+		}
+		if approved != nil && !slices.Equal(approved.Enums.Queries(), enums.Queries()) {
+			return ErrorMigrationPlanOutdated{Schema: stx.Schema(), Table: "enums"}
+		}
+		added = enums.OfKind(StepAddEnumValue)
+		return stx.execEnumSteps(ctxTx, added)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return added, nil
+}
 
+func (sr *PgStore) execEnumSteps(ctx context.Context, steps PatchSteps) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	log.Println(strings.Join(steps.Queries(), "\n"))
+	for _, st := range steps {
+		if _, err := sr.tx.ExecContext(ctx, st.SQL); err != nil {
+			return fmt.Errorf("Migrate enums ExecContext error: %w", err)
+		}
+	}
 	return nil
 }
 
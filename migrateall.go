@@ -0,0 +1,165 @@
+package pgparty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MigrateAllOptions controls migration of all shards
+type MigrateAllOptions struct {
+	// Concurrency limits shards migrated at once, GOMAXPROCS by default
+	Concurrency int
+	// PerDB limits shards of one *sqlx.DB migrated at once, Concurrency by default,
+	// every migration holds a transaction connection and a connection for concurrent indexes,
+	// so set it below the pool size of the database
+	PerDB int
+	// ContinueOnError migrates the rest of shards after a failure,
+	// otherwise shards that are not started yet are skipped
+	ContinueOnError bool
+	// Processor is passed to Migrate of every shard
+	Processor MigrationProcessor
+}
+
+type ShardMigrationStatus string
+
+const (
+	ShardMigrationOK      ShardMigrationStatus = "ok"
+	ShardMigrationFailed  ShardMigrationStatus = "failed"
+	ShardMigrationSkipped ShardMigrationStatus = "skipped" // not started because of a failure of another shard or canceled context
+)
+
+// ShardMigrationResult is a migration result of one shard, Plan contains models changed by migration
+type ShardMigrationResult struct {
+	ShardID  string               `json:"shardId"`
+	Schema   string               `json:"schema"`
+	Status   ShardMigrationStatus `json:"status"`
+	Error    string               `json:"error,omitempty"`
+	Started  time.Time            `json:"started"`
+	Duration time.Duration        `json:"duration"`
+	Plan     *MigrationPlan       `json:"plan,omitempty"`
+
+	Err error `json:"-"`
+}
+
+// MigrationReport is a result of MigrateAll ordered by shard id
+type MigrationReport struct {
+	Results []ShardMigrationResult `json:"results"`
+}
+
+func (r MigrationReport) Failed() []ShardMigrationResult {
+	var ret []ShardMigrationResult
+	for _, res := range r.Results {
+		if res.Status == ShardMigrationFailed {
+			ret = append(ret, res)
+		}
+	}
+	return ret
+}
+
+// Err joins errors of failed shards
+func (r MigrationReport) Err() error {
+	var errs []error
+	for _, res := range r.Failed() {
+		errs = append(errs, fmt.Errorf("shard %s: %w", res.ShardID, res.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// migrateShard migrates one shard of MigrateAll
+var migrateShard = func(ctx context.Context, sh Shard, mProcessor MigrationProcessor) (*MigrationPlan, error) {
+	return sh.Store.migrate(WithShard(ctx, sh), nil, mProcessor)
+}
+
+func MigrateAll(ctx context.Context, opts MigrateAllOptions) (*MigrationReport, error) {
+	shs, err := ShardsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return shs.MigrateAll(ctx, opts)
+}
+
+// MigrateAll migrates all shards in parallel, shards that share one *sqlx.DB are limited by PerDB.
+// The report contains results of all shards, the error joins errors of failed shards.
+func (s *Shards) MigrateAll(ctx context.Context, opts MigrateAllOptions) (*MigrationReport, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if opts.PerDB <= 0 {
+		opts.PerDB = opts.Concurrency
+	}
+
+	s.RLock()
+	shards := make([]Shard, 0, len(s.m))
+	for _, sh := range s.m {
+		shards = append(shards, sh)
+	}
+	s.RUnlock()
+	sort.Slice(shards, func(i, j int) bool {
+		return shards[i].ID < shards[j].ID
+	})
+
+	// шарды одной базы мигрируем не более PerDB одновременно, чтобы не исчерпать пул соединений
+	dbsems := make(map[*sqlx.DB]chan struct{})
+	for _, sh := range shards {
+		if _, ok := dbsems[sh.Store.db]; !ok {
+			dbsems[sh.Store.db] = make(chan struct{}, opts.PerDB)
+		}
+	}
+	sem := make(chan struct{}, opts.Concurrency)
+
+	report := &MigrationReport{
+		Results: make([]ShardMigrationResult, len(shards)),
+	}
+	var stop atomic.Bool
+	wg := sync.WaitGroup{}
+	for i, sh := range shards {
+		report.Results[i] = ShardMigrationResult{
+			ShardID: sh.ID,
+			Schema:  sh.Store.Schema(),
+			Status:  ShardMigrationSkipped,
+		}
+		wg.Add(1)
+		go func(res *ShardMigrationResult, sh Shard, dbsem chan struct{}) {
+			defer wg.Done()
+			dbsem <- struct{}{}
+			defer func() { <-dbsem }()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if stop.Load() || ctx.Err() != nil {
+				return
+			}
+			res.Started = time.Now()
+			plan, err := migrateShard(ctx, sh, opts.Processor)
+			res.Duration = time.Since(res.Started)
+			res.Plan = plan
+			if err != nil {
+				res.Status = ShardMigrationFailed
+				res.Err = err
+				res.Error = err.Error()
+				if !opts.ContinueOnError {
+					stop.Store(true)
+				}
+				return
+			}
+			res.Status = ShardMigrationOK
+		}(&report.Results[i], sh, dbsems[sh.Store.db])
+	}
+	wg.Wait()
+
+	if err := report.Err(); err != nil {
+		return report, err
+	}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
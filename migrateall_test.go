@@ -0,0 +1,162 @@
+package pgparty
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestMigrateAllCanceled(t *testing.T) {
+	shs, ctx := NewShards(context.Background())
+	shs.SetShard("s2", nil, "s2")
+	shs.SetShard("s1", nil, "s1")
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	report, err := MigrateAll(ctx, MigrateAllOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled error, got %v", err)
+	}
+	if len(report.Results) != 2 || report.Results[0].ShardID != "s1" || report.Results[1].ShardID != "s2" {
+		t.Fatalf("wrong results: %+v", report.Results)
+	}
+	for _, res := range report.Results {
+		if res.Status != ShardMigrationSkipped {
+			t.Errorf("shard %s must be skipped, got %s", res.ShardID, res.Status)
+		}
+	}
+	if report.Err() != nil || len(report.Failed()) != 0 {
+		t.Errorf("skipped shards are not failed")
+	}
+}
+
+// stubMigrateShard replaces migration of shards in the test
+func stubMigrateShard(t *testing.T, f func(ctx context.Context, sh Shard) (*MigrationPlan, error)) {
+	old := migrateShard
+	migrateShard = func(ctx context.Context, sh Shard, _ MigrationProcessor) (*MigrationPlan, error) {
+		return f(ctx, sh)
+	}
+	t.Cleanup(func() { migrateShard = old })
+}
+
+func TestMigrateAllStopOnError(t *testing.T) {
+	shs, ctx := NewShards(context.Background())
+	for _, id := range []string{"s1", "s2", "s3", "s4"} {
+		shs.SetShard(id, nil, id)
+	}
+	errFail := errors.New("fail")
+	var calls atomic.Int32
+	stubMigrateShard(t, func(ctx context.Context, sh Shard) (*MigrationPlan, error) {
+		calls.Add(1)
+		return nil, errFail
+	})
+
+	// шарды одной базы мигрируют по одному, после первой ошибки остальные не начинаются
+	report, err := MigrateAll(ctx, MigrateAllOptions{})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("expected shard error, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("shards must not be migrated after the failure: %d calls", calls.Load())
+	}
+	failed, skipped := 0, 0
+	for _, res := range report.Results {
+		switch res.Status {
+		case ShardMigrationFailed:
+			failed++
+			if res.Error != "fail" || !errors.Is(res.Err, errFail) || res.Started.IsZero() {
+				t.Errorf("wrong failed result: %+v", res)
+			}
+		case ShardMigrationSkipped:
+			skipped++
+			if !res.Started.IsZero() || res.Plan != nil {
+				t.Errorf("skipped shard must not be started: %+v", res)
+			}
+		}
+	}
+	if failed != 1 || skipped != 3 {
+		t.Errorf("wrong statuses: %d failed, %d skipped", failed, skipped)
+	}
+
+	calls.Store(0)
+	report, err = MigrateAll(ctx, MigrateAllOptions{ContinueOnError: true})
+	if !errors.Is(err, errFail) || calls.Load() != 4 || len(report.Failed()) != 4 {
+		t.Errorf("all shards must be migrated with ContinueOnError: %d calls, %v", calls.Load(), err)
+	}
+}
+
+func TestMigrateAllPerDB(t *testing.T) {
+	shs, ctx := NewShards(context.Background())
+	dba, dbb := &sqlx.DB{}, &sqlx.DB{}
+	for _, id := range []string{"a1", "a2", "a3"} {
+		shs.SetShard(id, dba, id)
+	}
+	for _, id := range []string{"b1", "b2", "b3"} {
+		shs.SetShard(id, dbb, id)
+	}
+
+	var mu sync.Mutex
+	active := make(map[*sqlx.DB]int)
+	maxPerDB, total, maxTotal := 0, 0, 0
+	stubMigrateShard(t, func(ctx context.Context, sh Shard) (*MigrationPlan, error) {
+		mu.Lock()
+		active[sh.Store.db]++
+		total++
+		maxPerDB = max(maxPerDB, active[sh.Store.db])
+		maxTotal = max(maxTotal, total)
+		mu.Unlock()
+		// ждем шард другой базы, чтобы увидеть параллельную миграцию
+		for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline); {
+			mu.Lock()
+			n := total
+			mu.Unlock()
+			if n > 1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		active[sh.Store.db]--
+		total--
+		mu.Unlock()
+		return &MigrationPlan{Schema: sh.Store.Schema(), Models: []ModelPlan{{Table: "items"}}}, nil
+	})
+
+	report, err := MigrateAll(ctx, MigrateAllOptions{Concurrency: 10, PerDB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxPerDB != 1 || maxTotal != 2 {
+		t.Errorf("wrong parallelism: %d per db, %d total", maxPerDB, maxTotal)
+	}
+	ids := make([]string, 0, len(report.Results))
+	for _, res := range report.Results {
+		ids = append(ids, res.ShardID)
+		if res.Status != ShardMigrationOK || res.Duration < 5*time.Millisecond || res.Started.IsZero() {
+			t.Errorf("wrong result of shard %s: %+v", res.ShardID, res)
+		}
+		if res.Plan == nil || res.Plan.Schema != res.Schema || len(res.Plan.Models) != 1 {
+			t.Errorf("plan of shard %s is not reported: %+v", res.ShardID, res.Plan)
+		}
+	}
+	if strings.Join(ids, ",") != "a1,a2,a3,b1,b2,b3" {
+		t.Errorf("results must be ordered by shard id: %v", ids)
+	}
+
+	maxPerDB = 0
+	// по умолчанию шарды одной базы ограничены только общим Concurrency
+	if _, err := MigrateAll(ctx, MigrateAllOptions{Concurrency: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if maxPerDB < 2 {
+		t.Errorf("shards of one db must be migrated in parallel by default: %d", maxPerDB)
+	}
+}
@@ -29,13 +29,18 @@ func EnsureModelSchema(ctx context.Context, md *ModelDesc) error {
 	}
 
 	// убедимся, что есть конфиг-таблица в схеме
-	if _, err := stx.tx.ExecContext(ctx,
-		`CREATE TABLE IF NOT EXISTS `+mdsn+`._config (
+	if _, err := stx.tx.ExecContext(ctx, configTableDDL(mdsn)); err != nil {
+		return err
+	}
+
+	// история примененных миграций моделей
+	return ensureSchemaHistoryTable(ctx, stx.tx, mdsn)
+}
+
+func configTableDDL(schema string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + schema + `._config (
 		table_name VARCHAR(250) NOT NULL,
 		storej JSONB NULL,
 		PRIMARY KEY (table_name)
-	)`); err != nil {
-		return err
-	}
-	return nil
+	)`
 }
@@ -21,9 +21,11 @@ func Field2SQLColumn(f FieldDescription) (modelcols.SQLColumn, modelcols.SQLInde
 
 	sqc := modelcols.SQLColumn{
 		// Table:      tname,
-		ColName:    f.DatabaseName,
-		NotNull:    !f.Nullable,
-		PrimaryKey: f.PK,
+		ColName:     f.DatabaseName,
+		NotNull:     !f.Nullable,
+		PrimaryKey:  f.PK,
+		RenamedFrom: f.RenamedFrom,
+		Comment:     f.Comment,
 	}
 
 	var sqci modelcols.SQLIndexes
@@ -45,6 +47,23 @@ func Field2SQLColumn(f FieldDescription) (modelcols.SQLColumn, modelcols.SQLInde
 		sqc.DefaultValue = SQLDefaultValue(ft)
 	}
 
+	// значения identity и вычисляемой колонки задает база, DEFAULT для них недопустим
+	switch {
+	case len(f.Generated) > 0:
+		sqc.Generated = f.Generated
+		sqc.DefaultValue = ""
+	case len(f.Identity) > 0:
+		sqc.Identity = f.Identity
+		sqc.NotNull = true
+		sqc.DefaultValue = ""
+		switch strings.ToUpper(sqc.DataType) {
+		case "BIGSERIAL":
+			sqc.DataType = "BIGINT"
+		case "SERIAL":
+			sqc.DataType = "INTEGER"
+		}
+	}
+
 	for _, idx := range f.Indexes {
 		if len(idx) > 0 {
 			idxParts := strings.Split(idx, " ")
@@ -138,9 +157,11 @@ func (sr *PgStore) MD2SQLModel(ctx context.Context, md *ModelDesc) (*modelcols.S
 		IsView:         md.IsView(),
 		IsMaterialized: md.IsMaterialized(),
 		ViewQuery:      vq,
+		Comment:        md.Comment(),
 	}
 	sqs := make(modelcols.SQLColumns, 0, md.ColumnPtrsCount())
 	sqis := make(modelcols.SQLIndexes, 0)
+	var sqfks modelcols.SQLForeignKeys
 
 	for fdIdx := 0; fdIdx < md.ColumnPtrsCount(); fdIdx++ {
 		f := md.ColumnPtr(fdIdx)
@@ -152,7 +173,62 @@ func (sr *PgStore) MD2SQLModel(ctx context.Context, md *ModelDesc) (*modelcols.S
 		if err != nil {
 			return nil, err
 		}
+		if en, ok := fieldEnum(*f); ok && len(f.SQLTypeDef) == 0 {
+			sqc.DataType = EnumTypeName(sr.Schema(), en.Name)
+			if len(f.DefVal) == 0 && sqc.NotNull && !sqc.PrimaryKey && len(en.Values) > 0 {
+				// пустая строка не является значением ENUM
+				sqc.DefaultValue = quoteSQLString(en.Values[0])
+			}
+			if _, ok := ret.Enums.FindByName(en.Name); !ok && !md.IsView() {
+				ret.Enums = append(ret.Enums, en)
+			}
+		}
+		if len(f.Using) > 0 && !md.IsView() {
+			if sqc.Using, err = sr.PrepareModelExpr(ctx, md, f.Using); err != nil {
+				return nil, fmt.Errorf("MD2SQLModel %s: %w", md.TypeName(), err)
+			}
+			sqc.UsingFrom, sqc.UsingTo = f.UsingFrom, f.UsingTo
+		}
+		if md.IsView() {
+			// колонки представления задает его запрос
+			sqc.Identity, sqc.Generated = "", ""
+		} else if len(sqc.Generated) > 0 {
+			if sqc.Generated, err = sr.PrepareModelExpr(ctx, md, sqc.Generated); err != nil {
+				return nil, fmt.Errorf("MD2SQLModel %s: %w", md.TypeName(), err)
+			}
+		}
 		sqs = append(sqs, sqc)
+		if sqc.PrimaryKey {
+			ret.PrimaryKey = append(ret.PrimaryKey, sqc.ColName)
+		}
+
+		if len(f.ForeignKey) > 0 && !md.IsView() {
+			fk, err := sr.ForeignKey2SQL(md.DatabaseName(), *f)
+			if err != nil {
+				return nil, fmt.Errorf("MD2SQLModel %s: %w", md.TypeName(), err)
+			}
+			fnd := false
+			for i, exfk := range sqfks {
+				if strings.EqualFold(exfk.Name, fk.Name) {
+					// поля одного составного ключа должны ссылаться на одну таблицу с одинаковыми действиями
+					if !strings.EqualFold(exfk.RefTable, fk.RefTable) ||
+						!strings.EqualFold(exfk.OnDelete, fk.OnDelete) ||
+						!strings.EqualFold(exfk.OnUpdate, fk.OnUpdate) {
+						return nil, fmt.Errorf("MD2SQLModel %s: field %s: foreign key %s differs from other fields of the key in referenced table or actions",
+							md.TypeName(), f.FieldName, fk.Name)
+					}
+					exfk.Columns = append(exfk.Columns, fk.Columns...)
+					exfk.RefColumns = append(exfk.RefColumns, fk.RefColumns...)
+					sqfks[i] = exfk
+					fnd = true
+					break
+				}
+			}
+			if !fnd {
+				sqfks = append(sqfks, fk)
+			}
+		}
+
 		for _, idx := range sqi {
 			fnd := false
 			for i, exidx := range sqis {
@@ -173,6 +249,20 @@ func (sr *PgStore) MD2SQLModel(ctx context.Context, md *ModelDesc) (*modelcols.S
 		return nil, fmt.Errorf("sql fields not found in type %v", md.TypeName())
 	}
 
+	if !md.IsView() {
+		// полнотекстовый поиск - вычисляемая колонка tsvector с GIN индексом
+		if ftc, fti, ok := FullText2SQL(md); ok {
+			if _, fnd := sqs.FindColumnByName(ftc.ColName); fnd {
+				return nil, fmt.Errorf("MD2SQLModel %s: column name %q is reserved for fulltext search", md.TypeName(), ftc.ColName)
+			}
+			if _, fnd := sqis.FindByName(fti.Name); fnd {
+				return nil, fmt.Errorf("MD2SQLModel %s: index name %q is reserved for fulltext search", md.TypeName(), fti.Name)
+			}
+			sqs = append(sqs, ftc)
+			sqis = append(sqis, fti)
+		}
+	}
+
 	sort.Slice(sqs, func(i, j int) bool {
 		return sqs[i].ColName < sqs[j].ColName
 	})
@@ -187,20 +277,69 @@ func (sr *PgStore) MD2SQLModel(ctx context.Context, md *ModelDesc) (*modelcols.S
 		})
 	}
 
+	// индексы уровня модели, порядок их колонок сохраняется
+	mdidxs, err := sr.ModelIndexes2SQL(ctx, md)
+	if err != nil {
+		return nil, fmt.Errorf("MD2SQLModel %s: %w", md.TypeName(), err)
+	}
+	for _, idx := range mdidxs {
+		if _, ok := sqis.FindByName(idx.Name); ok {
+			return nil, fmt.Errorf("MD2SQLModel %s: index name %q is not unique", md.TypeName(), idx.Name)
+		}
+		sqis = append(sqis, idx)
+	}
+	sort.Slice(sqis, func(i, j int) bool {
+		return sqis[i].Name < sqis[j].Name
+	})
+
+	if md.IsPartitioned() {
+		if ret.Partition, err = Partition2SQL(md, sqs); err != nil {
+			return nil, fmt.Errorf("MD2SQLModel %s: %w", md.TypeName(), err)
+		}
+		// CONCURRENTLY не поддерживается для секционированных таблиц,
+		// индекс родителя создается и во всех секциях
+		for i := range sqis {
+			sqis[i].Concurrently = false
+		}
+	}
+
+	if !md.IsView() {
+		cons, err := sr.Constraints2SQL(ctx, md)
+		if err != nil {
+			return nil, fmt.Errorf("MD2SQLModel %s: %w", md.TypeName(), err)
+		}
+		ret.Constraints = cons
+	}
+
+	sort.Slice(sqfks, func(i, j int) bool {
+		return sqfks[i].Name < sqfks[j].Name
+	})
+
+	sort.Slice(ret.Enums, func(i, j int) bool {
+		return ret.Enums[i].Name < ret.Enums[j].Name
+	})
+
 	ret.Columns = sqs
 	ret.Indexes = sqis
+	ret.ForeignKeys = sqfks
 	return ret, nil
 }
 
 func SQLCreateTableWithColumns(pt *PatchTable, sqs *modelcols.SQLModel) {
 	pt.AddCreateTablePatch(
 		PatchCreateTable{
-			Schema: pt.Schema,
-			Table:  pt.Name,
-			Cols:   sqs.Columns,
+			Schema:    pt.Schema,
+			Table:     pt.Name,
+			Cols:      sqs.Columns,
+			FKs:       sqs.ForeignKeys,
+			Cons:      sqs.Constraints,
+			Partition: sqs.Partition,
+			PKs:       sqs.PrimaryKey,
 		},
 	)
 	for _, idx := range sqs.Indexes {
+		// новая таблица пуста, индекс строим в транзакции
+		idx.Concurrently = false
 		pt.AddCreateIndexPatch(
 			PatchCreateIndex{
 				Schema: pt.Schema,
@@ -209,6 +348,33 @@ func SQLCreateTableWithColumns(pt *PatchTable, sqs *modelcols.SQLModel) {
 			},
 		)
 	}
+	for _, c := range modelComments(pt.Schema, pt.Name, sqs) {
+		pt.AddCommentPatch(c)
+	}
+}
+
+// modelComments returns not empty comments of the table or view and its columns
+func modelComments(schema, tname string, sqs *modelcols.SQLModel) []fmt.Stringer {
+	var ret []fmt.Stringer
+	if len(sqs.Comment) > 0 {
+		ret = append(ret, PatchComment{Schema: schema, Table: tname, Object: commentObject(sqs), Text: sqs.Comment})
+	}
+	for _, col := range sqs.Columns {
+		if len(col.Comment) > 0 {
+			ret = append(ret, PatchComment{Schema: schema, Table: tname, Column: col.ColName, Text: col.Comment})
+		}
+	}
+	return ret
+}
+
+func commentObject(sqs *modelcols.SQLModel) string {
+	switch {
+	case sqs.IsMaterialized:
+		return "MATERIALIZED VIEW"
+	case sqs.IsView:
+		return "VIEW"
+	}
+	return "TABLE"
 }
 
 func SQLCreateView(pt *PatchView, sqs *modelcols.SQLModel) {
@@ -222,6 +388,8 @@ func SQLCreateView(pt *PatchView, sqs *modelcols.SQLModel) {
 	)
 	if sqs.IsMaterialized {
 		for _, idx := range sqs.Indexes {
+			// представление создается заново, индекс строим в транзакции
+			idx.Concurrently = false
 			pt.AddCreateIndexPatch(
 				PatchCreateIndex{
 					Schema: pt.Schema,
@@ -231,14 +399,69 @@ func SQLCreateView(pt *PatchView, sqs *modelcols.SQLModel) {
 			)
 		}
 	}
+	for _, c := range modelComments(pt.Schema, pt.Name, sqs) {
+		pt.AddCommentPatch(c)
+	}
 }
 
-func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfos []DBColInfo, dbidxs DBIndexDefs) []string {
+// retainDroppedColumns adds to the target model columns of the stored model that are gone from the model,
+// but stay in the table by the drop policy. They are stored as retained and dropped when the policy allows it.
+func retainDroppedColumns(schema string, last, to *modelcols.SQLModel, policy ColumnDropPolicy) {
+	if to.IsView || policy == ColumnDrop || policy == ColumnDropArchive {
+		return
+	}
+	for _, d := range last.Columns {
+		if _, ok := to.Columns.FindColumnByName(d.ColName); ok {
+			continue
+		}
+		renamed := false
+		for _, col := range to.Columns {
+			if strings.EqualFold(col.RenamedFrom, d.ColName) {
+				renamed = true
+				break
+			}
+		}
+		if renamed {
+			continue
+		}
+		if !d.Retained {
+			log.Printf("column %s.%s.%s is not in the model anymore, but it is not dropped by migration policy",
+				schema, to.Table, d.ColName)
+		}
+		d.Retained = true
+		to.Columns = append(to.Columns, d)
+	}
+	sort.Slice(to.Columns, func(i, j int) bool {
+		return to.Columns[i].ColName < to.Columns[j].ColName
+	})
+}
+
+func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfos []DBColInfo, dbidxs DBIndexDefs) ([]string, error) {
+	pt, err := SQLAlterTablePatch(schema, tname, last, to, dbcolinfos, dbidxs, nil, MigrationOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pt.Queries(), nil
+}
+
+func SQLAlterTablePatch(schema, tname string, last, to *modelcols.SQLModel, dbcolinfos []DBColInfo, dbidxs DBIndexDefs,
+	dbcons DBConstraintDefs, opts MigrationOptions,
+) (*PatchTable, error) {
 	patchTable := &PatchTable{
 		Schema: schema,
 		Name:   tname,
 	}
 
+	// секционирование задается только при создании таблицы
+	if !last.Partition.Equal(to.Partition) {
+		return nil, ErrorPartitionChange{Schema: schema, Table: tname}
+	}
+
+	// старые имена переименованных колонок
+	renamed := make(map[string]string)
+	// пересоздаваемые вычисляемые колонки
+	rebuilt := make(map[string]bool)
+
 	// перебираем колонки
 	for _, col := range to.Columns {
 		fnd, dbfnd := false, false
@@ -253,6 +476,24 @@ func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfo
 			}
 		}
 
+		// колонка переименована - ищем в схеме по старому имени
+		if !fnd && len(col.RenamedFrom) > 0 {
+			for _, d := range last.Columns {
+				if strings.EqualFold(col.RenamedFrom, d.ColName) {
+					fnd = true
+					dbcol = d
+					renamed[strings.ToLower(d.ColName)] = col.ColName
+					patchTable.AddRenameColumnPatch(PatchRenameColumn{
+						Schema: schema,
+						Table:  tname,
+						From:   d.ColName,
+						To:     col.ColName,
+					})
+					break
+				}
+			}
+		}
+
 		dbcolinfo := DBColInfo{}
 		if !fnd {
 			// если не нашли в схеме, смотрим на базу
@@ -266,6 +507,24 @@ func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfo
 			}
 		}
 
+		if !fnd && !dbfnd && len(col.RenamedFrom) > 0 {
+			// в схеме старой колонки нет, но в самой БД она осталась
+			for _, d := range dbcolinfos {
+				if strings.EqualFold(col.RenamedFrom, d.Name) {
+					dbfnd = true
+					dbcolinfo = d
+					renamed[strings.ToLower(d.Name)] = col.ColName
+					patchTable.AddRenameColumnPatch(PatchRenameColumn{
+						Schema: schema,
+						Table:  tname,
+						From:   d.Name,
+						To:     col.ColName,
+					})
+					break
+				}
+			}
+		}
+
 		if !fnd && !dbfnd {
 			// нет в схеме БД или в самой БД - добавляем колонку
 			patchTable.AddColumnPatch(PatchAddColumn{
@@ -280,26 +539,40 @@ func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfo
 			dbcol.DefaultValue = col.DefaultValue
 			dbcol.PrimaryKey = col.PrimaryKey
 			dbcol.NotNull = strings.EqualFold(dbcolinfo.IsNullable, "NO")
-			dbcol.DataType = strings.ToUpper(dbcolinfo.Type)
-			if dbcol.DataType == "VARCHAR" && dbcolinfo.CharLen != nil {
-				dbcol.DataType = fmt.Sprintf("VARCHAR(%d)", *dbcolinfo.CharLen)
+			dbcol.DataType = dbcolinfo.SQLDataType()
+			if dbcolinfo.Identity != nil {
+				dbcol.Identity = *dbcolinfo.Identity
 			}
-			if dbcol.DataType == "JSONB" {
-				dbcol.DataType = jsonType
-			}
-			if dbcol.DataType == "BOOL" {
-				dbcol.DataType = "BOOLEAN"
+			if dbcolinfo.Generated != nil {
+				dbcol.Generated = *dbcolinfo.Generated
 			}
 			fnd = true
 		}
 
-		if fnd {
+		// выражение вычисляемой колонки не меняется - удаляем колонку и добавляем заново,
+		// ее значения будут вычислены, индексы по ней пересоздаются
+		rebuild := fnd && len(col.Generated) > 0 && col.Generated != dbcol.Generated
+		if rebuild {
+			patchTable.AddDropColumnPatch(PatchRebuildColumn{
+				Schema: schema,
+				Table:  tname,
+				Col:    col.ColName,
+			})
+			patchTable.AddColumnPatch(PatchAddColumn{
+				Col: col,
+			})
+			rebuilt[strings.ToLower(col.ColName)] = true
+			dbcol.Comment = ""
+		}
+
+		if fnd && !rebuild {
 			// есть колонка в схеме из БД (или ее имитация) - сравниваем и делаем патчи
 
-			if col.PrimaryKey != dbcol.PrimaryKey {
-				// TODO: подумать, как тут менять PK, просто так наверное не выйдет
-				// пока считаем что это исключительный случай
-				panic("Нельзя менять Primary Key!")
+			// колонка перестала быть вычисляемой - значения остаются
+			if len(dbcol.Generated) > 0 && len(col.Generated) == 0 {
+				patchTable.AddColumnPatch(PatchDropExpression{
+					Col: col,
+				})
 			}
 
 			// если было с null, а стало not null - апдейтим к новому DefaultValue
@@ -312,10 +585,36 @@ func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfo
 			}
 
 			// изменился тип колонки
+			dropdef := false
 			if !strings.EqualFold(col.DataType, dbcol.DataType) {
-				patchTable.AddColumnPatch(PatchAlterColumnType{
-					Col: col,
-				})
+				change, using := ClassifyColumnTypeChange(col.ColName, dbcol.DataType, col.DataType)
+				// приведение из тега с типами этой смены - явное согласие на небезопасную смену типа,
+				// оставшийся после миграции тег не разрешает и не приводит следующие смены типа
+				consent := len(col.Using) > 0 &&
+					strings.EqualFold(col.UsingFrom, dbcol.DataType) && strings.EqualFold(col.UsingTo, col.DataType)
+				if consent || (len(col.Using) > 0 && len(col.UsingFrom) == 0) {
+					using = col.Using
+				}
+				if change == TypeChangeUnsafe && !opts.AllowUnsafeTypeChanges && !consent {
+					return nil, ErrorUnsafeColumnTypeChange{
+						Schema: schema,
+						Table:  tname,
+						Column: col.ColName,
+						From:   dbcol.DataType,
+						To:     col.DataType,
+					}
+				}
+				if change != TypeChangeNone {
+					// старое значение по умолчанию может не привестись к новому типу
+					dropdef = len(using) > 0 && len(dbcol.DefaultValue) > 0 && !dbcol.PrimaryKey
+					patchTable.AddColumnPatch(PatchAlterColumnType{
+						Col:         col,
+						From:        dbcol.DataType,
+						Using:       using,
+						Change:      change,
+						DropDefault: dropdef,
+					})
+				}
 			}
 
 			// сменился not null
@@ -325,12 +624,208 @@ func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfo
 				})
 			}
 
-			// сменилось дефолтное значение
-			if col.DefaultValue != dbcol.DefaultValue {
+			// сменилось дефолтное значение, у serial колонки значение по умолчанию из последовательности
+			fromSerial := len(col.Identity) > 0 && len(dbcol.Identity) == 0 &&
+				strings.HasSuffix(strings.ToUpper(dbcol.DataType), "SERIAL")
+			if col.DefaultValue != dbcol.DefaultValue || (dropdef && len(col.DefaultValue) > 0) || fromSerial {
 				patchTable.AddColumnPatch(PatchAlterColumnDefVal{
 					Col: col,
 				})
 			}
+
+			// сменилась identity колонки
+			switch {
+			case col.Identity == dbcol.Identity:
+			case len(dbcol.Identity) == 0:
+				// последовательность serial колонки удаляется после DROP DEFAULT, identity создает свою
+				patchTable.AddConstraintPatch(PatchDropSerialSequence{
+					Schema: schema,
+					Table:  tname,
+					Col:    col.ColName,
+				})
+				patchTable.AddConstraintPatch(PatchAddIdentity{
+					Schema: schema,
+					Table:  tname,
+					Col:    col,
+				})
+				patchTable.AddConstraintPatch(PatchSyncIdentity{
+					Schema: schema,
+					Table:  tname,
+					Col:    col.ColName,
+				})
+			case len(col.Identity) == 0:
+				patchTable.AddDropConstraintPatch(PatchDropIdentity{
+					Schema: schema,
+					Table:  tname,
+					Col:    col.ColName,
+				})
+			default:
+				patchTable.AddColumnPatch(PatchSetIdentity{
+					Col: col,
+				})
+			}
+		}
+
+		// сменился комментарий, у новой колонки комментария еще нет
+		if col.Comment != dbcol.Comment {
+			patchTable.AddCommentPatch(PatchComment{
+				Schema: schema,
+				Table:  tname,
+				Column: col.ColName,
+				Text:   col.Comment,
+			})
+		}
+	}
+
+	// сменился комментарий таблицы
+	if to.Comment != last.Comment {
+		patchTable.AddCommentPatch(PatchComment{
+			Schema: schema,
+			Table:  tname,
+			Object: commentObject(to),
+			Text:   to.Comment,
+		})
+	}
+
+	// сменился первичный ключ, порядок колонок ключа берем из модели
+	// lastpks - колонки текущего ключа с именами после переименования колонок
+	var lastpks []string
+	for _, pk := range last.PrimaryKeyColumns() {
+		if rn := renamed[strings.ToLower(pk)]; len(rn) > 0 {
+			lastpks = append(lastpks, rn)
+		} else {
+			lastpks = append(lastpks, pk)
+		}
+	}
+	topks := to.PrimaryKeyColumns()
+	if !modelcols.ColumnsEqual(sortedCopy(lastpks), sortedCopy(topks)) {
+		for _, pk := range topks {
+			if col, ok := to.Columns.FindColumnByName(pk); ok && !col.NotNull {
+				return nil, ErrorPrimaryKeyChange{
+					Schema: schema,
+					Table:  tname,
+					From:   lastpks,
+					To:     topks,
+					Reason: fmt.Sprintf("column %s is nullable", col.ColName),
+				}
+			}
+		}
+		// имя ограничения могло быть задано не нами, например у принятой или переименованной таблицы
+		pkname := tname + "_pkey"
+		for _, c := range dbcons {
+			if c.Type == "p" {
+				pkname = c.Name
+			}
+		}
+		patchTable.AddDropConstraintPatch(PatchDropConstraint{
+			Schema: schema,
+			Table:  tname,
+			Name:   pkname,
+		})
+		if len(topks) > 0 {
+			// проверка выполняется до всех изменений таблицы, поэтому колонки берем по старым именам,
+			// дубликаты ищем, только если все колонки нового ключа уже есть в таблице
+			oldnames := make(map[string]string, len(renamed))
+			for from, to := range renamed {
+				oldnames[strings.ToLower(to)] = from
+			}
+			var vcols []string
+			for _, pk := range topks {
+				if from := oldnames[strings.ToLower(pk)]; len(from) > 0 {
+					vcols = append(vcols, from)
+				} else if _, ok := last.Columns.FindColumnByName(pk); ok {
+					vcols = append(vcols, pk)
+				} else {
+					vcols = nil
+					break
+				}
+			}
+			patchTable.AddValidatePatch(PatchValidatePrimaryKey{
+				Schema: schema,
+				Table:  tname,
+				Cols:   vcols,
+			})
+			patchTable.AddConstraintPatch(PatchAddPrimaryKey{
+				Schema: schema,
+				Table:  tname,
+				Cols:   topks,
+			})
+		}
+	}
+
+	// внешние ключи: удаляем исчезнувшие или измененные, добавляем новые
+	for _, fk := range last.ForeignKeys {
+		if tofk, ok := to.ForeignKeys.FindByName(fk.Name); !ok || !tofk.Equal(fk) {
+			patchTable.AddDropConstraintPatch(PatchDropConstraint{
+				Schema: schema,
+				Table:  tname,
+				Name:   fk.Name,
+			})
+		}
+	}
+	for _, fk := range to.ForeignKeys {
+		if lastfk, ok := last.ForeignKeys.FindByName(fk.Name); !ok || !lastfk.Equal(fk) {
+			patchTable.AddConstraintPatch(PatchAddForeignKey{
+				Schema: schema,
+				Table:  tname,
+				FK:     fk,
+			})
+		}
+	}
+
+	// ограничения CHECK и UNIQUE: пересоздаем измененные и отсутствующие в БД, удаляем исчезнувшие из модели
+	for _, c := range last.Constraints {
+		if _, ok := to.Constraints.FindByName(c.Name); !ok {
+			patchTable.AddDropConstraintPatch(PatchDropConstraint{
+				Schema: schema,
+				Table:  tname,
+				Name:   c.Name,
+			})
+		}
+	}
+	for _, c := range to.Constraints {
+		lastc, oklast := last.Constraints.FindByName(c.Name)
+		dbc, okdb := dbcons.FindByName(c.Name)
+		if oklast && okdb && lastc.Equal(c) && ConstraintEqualDBConstraint(c, dbc) && !usesColumns(rebuilt, c.Columns, c.Expr) {
+			continue
+		}
+		if okdb {
+			patchTable.AddDropConstraintPatch(PatchDropConstraint{
+				Schema: schema,
+				Table:  tname,
+				Name:   c.Name,
+			})
+		}
+		patchTable.AddConstraintPatch(PatchAddConstraint{
+			Schema: schema,
+			Table:  tname,
+			Con:    c,
+		})
+	}
+
+	// колонки, которых больше нет в модели, оставленные колонки есть в to с признаком Retained
+	for _, d := range last.Columns {
+		if _, ok := to.Columns.FindColumnByName(d.ColName); ok || len(renamed[strings.ToLower(d.ColName)]) > 0 {
+			continue
+		}
+		switch opts.DropColumns {
+		case ColumnDropArchive:
+			patchTable.AddArchiveColumnPatch(PatchArchiveColumn{
+				Schema: schema,
+				Table:  tname,
+				Col:    d.ColName,
+				PKs:    lastpks,
+			})
+			patchTable.AddColumnPatch(PatchDropColumn{
+				Col: d,
+			})
+		case ColumnDrop:
+			patchTable.AddColumnPatch(PatchDropColumn{
+				Col: d,
+			})
+		default:
+			log.Printf("column %s.%s.%s is not in the model anymore, but it is not dropped by migration policy",
+				schema, tname, d.ColName)
 		}
 	}
 
@@ -343,6 +838,11 @@ func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfo
 		if okdb {
 			knownidxs[strings.ToLower(patchTable.Name+idxto.Name)] = true
 		}
+		// индекс удален вместе с пересоздаваемой колонкой
+		if okdb && usesColumns(rebuilt, append(append([]string{}, idxto.Columns...), idxto.Include...),
+			append(append([]string{}, idxto.Expressions...), idxto.Where)...) {
+			okdb = false
+		}
 		if oklast {
 			if okdb {
 				// есть в схеме и в базе - пересоздаем если отличаются
@@ -350,9 +850,10 @@ func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfo
 					IndexEqualDBIndex(patchTable.Name, idxto, dbidx)) {
 					// пересоздаем
 					patchTable.AddDropIndexPatch(PatchDropIndex{
-						Schema: schema,
-						Table:  tname,
-						Index:  idxto.Name,
+						Schema:       schema,
+						Table:        tname,
+						Index:        idxto.Name,
+						Concurrently: idxto.Concurrently,
 					})
 					patchTable.AddCreateIndexPatch(PatchCreateIndex{
 						Schema: schema,
@@ -372,9 +873,10 @@ func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfo
 			if okdb {
 				// нет в схеме, есть в базе - пересоздаем, т.к. он нужен в новом виде
 				patchTable.AddDropIndexPatch(PatchDropIndex{
-					Schema: schema,
-					Table:  tname,
-					Index:  idxto.Name,
+					Schema:       schema,
+					Table:        tname,
+					Index:        idxto.Name,
+					Concurrently: idxto.Concurrently,
 				})
 				patchTable.AddCreateIndexPatch(PatchCreateIndex{
 					Schema: schema,
@@ -394,7 +896,7 @@ func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfo
 
 	// удаляем неактуальные индексы
 	for _, idx := range dbidxs {
-		if !knownidxs[strings.ToLower(idx.Name)] {
+		if !knownidxs[strings.ToLower(idx.Name)] && !last.IsUnmanagedIndex(idx.Name) && !to.IsUnmanagedIndex(idx.Name) {
 			patchTable.AddDropIndexPatch(PatchDropIndex{
 				Schema: schema,
 				Force:  true,
@@ -403,7 +905,35 @@ func SQLAlterTable(schema, tname string, last, to *modelcols.SQLModel, dbcolinfo
 		}
 	}
 
-	return patchTable.Queries()
+	return patchTable, nil
+}
+
+func sortedCopy(ss []string) []string {
+	ret := append([]string(nil), ss...)
+	sort.Strings(ret)
+	return ret
+}
+
+// usesColumns reports that columns or expressions of the index or constraint refer to one of cols
+func usesColumns(cols map[string]bool, names []string, exprs ...string) bool {
+	if len(cols) == 0 {
+		return false
+	}
+	for _, n := range names {
+		if cols[strings.ToLower(n)] {
+			return true
+		}
+	}
+	for _, e := range exprs {
+		for _, w := range strings.FieldsFunc(strings.ToLower(e), func(r rune) bool {
+			return !(r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+		}) {
+			if cols[w] {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func SQLCreateModelWithColumns(ctx context.Context, md *ModelDesc, sqs *modelcols.SQLModel) error {
@@ -470,7 +1000,10 @@ func SQLAlterModel(ctx context.Context, md *ModelDesc, mddbidxs DBIndexDefs, las
 		if err != nil {
 			return fmt.Errorf("SQLAlterModel DBColumnsInfo error: %w", err)
 		}
-		qsqls = SQLAlterTable(sn, md.DatabaseName(), last, to, colinfos, mddbidxs)
+		qsqls, err = SQLAlterTable(sn, md.DatabaseName(), last, to, colinfos, mddbidxs)
+		if err != nil {
+			return err
+		}
 	}
 
 	log.Println(strings.Join(qsqls, "\n"))
@@ -485,7 +1018,52 @@ func SQLAlterModel(ctx context.Context, md *ModelDesc, mddbidxs DBIndexDefs, las
 	return stx.SaveModelConfig(ctx, md)
 }
 
+// viewCommentsChanged reports whether models of the view differ only in comments,
+// the view indexes must be the same as dbidxs if they are given
+func viewCommentsChanged(last, to *modelcols.SQLModel, dbidxs DBIndexDefs) bool {
+	if last.Equal(to) || last.ViewQuery != to.ViewQuery || last.IsMaterialized != to.IsMaterialized ||
+		(dbidxs != nil && !IndexesEqualToDBIndexes(to, dbidxs)) {
+		return false
+	}
+	uncommented := func(m *modelcols.SQLModel) *modelcols.SQLModel {
+		ret := *m
+		ret.Comment = ""
+		ret.Columns = make(modelcols.SQLColumns, len(m.Columns))
+		for i, col := range m.Columns {
+			col.Comment = ""
+			ret.Columns[i] = col
+		}
+		return &ret
+	}
+	return uncommented(last).Equal(uncommented(to))
+}
+
 func SQLAlterView(schema, tname string, last, to *modelcols.SQLModel, dbidxs DBIndexDefs) []string {
+	return SQLAlterViewPatch(schema, tname, last, to, dbidxs).Queries()
+}
+
+// SQLAlterViewPatch recreates the view, if only comments are changed it comments the view and its columns
+func SQLAlterViewPatch(schema, tname string, last, to *modelcols.SQLModel, dbidxs DBIndexDefs) *PatchView {
+	pt := &PatchView{
+		Schema: schema,
+		Name:   tname,
+	}
+	if viewCommentsChanged(last, to, dbidxs) {
+		if to.Comment != last.Comment {
+			pt.AddCommentPatch(PatchComment{Schema: schema, Table: tname, Object: commentObject(to), Text: to.Comment})
+		}
+		for _, col := range to.Columns {
+			if lastcol, ok := last.Columns.FindColumnByName(col.ColName); ok && lastcol.Comment != col.Comment {
+				pt.AddCommentPatch(PatchComment{Schema: schema, Table: tname, Column: col.ColName, Text: col.Comment})
+			}
+		}
+		return pt
+	}
+	return SQLRecreateViewPatch(schema, tname, last, to)
+}
+
+// SQLRecreateViewPatch drops the view with its indexes and creates it again
+func SQLRecreateViewPatch(schema, tname string, last, to *modelcols.SQLModel) *PatchView {
 	pt := &PatchView{
 		Schema: schema,
 		Name:   tname,
@@ -498,9 +1076,10 @@ func SQLAlterView(schema, tname string, last, to *modelcols.SQLModel, dbidxs DBI
 		})
 	}
 	pt.AddDropViewPatch(PatchDropView{
-		Schema: schema,
-		Table:  tname,
+		Schema:       schema,
+		Table:        tname,
+		Materialized: last.IsMaterialized,
 	})
 	SQLCreateView(pt, to)
-	return pt.Queries()
+	return pt
 }
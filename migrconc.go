@@ -0,0 +1,193 @@
+package pgparty
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	IndexBuildPending = "pending"
+	IndexBuildRunning = "running"
+	IndexBuildDone    = "done"
+	IndexBuildFailed  = "failed"
+)
+
+// IndexBuild is a progress record of concurrent index build, stored in <schema>._index_builds table
+type IndexBuild struct {
+	Index     string    `db:"index_name"`
+	Table     string    `db:"table_name"`
+	Query     string    `db:"query"`
+	State     string    `db:"state"`
+	Error     string    `db:"error"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+func (s Shard) IndexBuilds(ctx context.Context) ([]IndexBuild, error) {
+	return s.Store.IndexBuilds(WithShard(ctx, s))
+}
+
+// IndexBuilds returns progress of concurrent index builds
+func (sr *PgStore) IndexBuilds(ctx context.Context) ([]IndexBuild, error) {
+	var ret []IndexBuild
+	if err := sr.WithTx(ctx, func(stx *PgStore) error {
+		ok := false
+		if err := stx.tx.GetContext(ctx, &ok, `SELECT to_regclass($1) IS NOT NULL`, stx.Schema()+"._index_builds"); err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		return stx.tx.SelectContext(ctx, &ret,
+			`SELECT index_name,table_name,query,state,error,updated_at FROM `+stx.Schema()+`._index_builds ORDER BY index_name`)
+	}); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("IndexBuilds: %w", err)
+	}
+	return ret, nil
+}
+
+func ensureIndexBuildsTable(ctx context.Context, ex sqlx.ExecerContext, schema string) error {
+	_, err := ex.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+schema+`._index_builds (
+		index_name VARCHAR(250) NOT NULL,
+		table_name VARCHAR(250) NOT NULL,
+		query TEXT NOT NULL,
+		state VARCHAR(20) NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (index_name)
+	)`)
+	return err
+}
+
+func upsertIndexBuild(ctx context.Context, ex sqlx.ExecerContext, schema, table string, st PatchStep, state, errText string) error {
+	_, err := ex.ExecContext(ctx, `INSERT INTO `+schema+`._index_builds (index_name,table_name,query,state,error,updated_at)
+	VALUES($1,$2,$3,$4,$5,now()) ON CONFLICT(index_name) DO
+	UPDATE SET table_name=excluded.table_name,query=excluded.query,state=excluded.state,error=excluded.error,updated_at=excluded.updated_at`,
+		strings.ToLower(st.Index), table, st.SQL, state, errText)
+	return err
+}
+
+// registerIndexBuilds records pending concurrent index builds of the plan in the migration transaction
+func (sr *PgStore) registerIndexBuilds(ctx context.Context, mp ModelPlan) error {
+	fnd := false
+	for _, st := range mp.Steps.Concurrent() {
+		if st.Kind != StepCreateIndex {
+			continue
+		}
+		if !fnd {
+			if err := ensureIndexBuildsTable(ctx, sr.tx, sr.Schema()); err != nil {
+				return err
+			}
+			fnd = true
+		}
+		if err := upsertIndexBuild(ctx, sr.tx, sr.Schema(), mp.Table, st, IndexBuildPending, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyConcurrentSteps runs concurrent index steps of the plan outside a transaction on a plain connection.
+// INVALID index left by a failed build is dropped before the next attempt and right after the failure.
+func (sr *PgStore) ApplyConcurrentSteps(ctx context.Context, mp ModelPlan) error {
+	if sr.tx != nil {
+		return fmt.Errorf("ApplyConcurrentSteps %s: concurrent steps can't run inside a transaction", mp.Table)
+	}
+	schema := sr.Schema()
+	for _, st := range mp.Steps.Concurrent() {
+		if st.Kind == StepCreateIndex {
+			// индекс уже построен другим экземпляром сервиса
+			built, err := sr.validIndexExists(ctx, st.Index)
+			if err != nil {
+				return fmt.Errorf("ApplyConcurrentSteps %s: %w", mp.Table, err)
+			}
+			if built {
+				if err := upsertIndexBuild(ctx, sr.db, schema, mp.Table, st, IndexBuildDone, ""); err != nil {
+					return fmt.Errorf("ApplyConcurrentSteps %s: %w", mp.Table, err)
+				}
+				continue
+			}
+			// чистим INVALID индекс от прошлой неудачной попытки
+			if err := sr.dropInvalidIndex(ctx, st.Index); err != nil {
+				return fmt.Errorf("ApplyConcurrentSteps %s: %w", mp.Table, err)
+			}
+			if err := upsertIndexBuild(ctx, sr.db, schema, mp.Table, st, IndexBuildRunning, ""); err != nil {
+				return fmt.Errorf("ApplyConcurrentSteps %s: %w", mp.Table, err)
+			}
+		}
+
+		log.Println(st.SQL)
+
+		if _, err := sr.db.ExecContext(ctx, st.SQL); err != nil {
+			if st.Kind == StepCreateIndex {
+				// неудачная сборка оставляет INVALID индекс
+				if e := sr.dropInvalidIndex(ctx, st.Index); e != nil {
+					log.Printf("ApplyConcurrentSteps %s: %s", mp.Table, e)
+				}
+				if e := upsertIndexBuild(ctx, sr.db, schema, mp.Table, st, IndexBuildFailed, err.Error()); e != nil {
+					log.Printf("ApplyConcurrentSteps %s: %s", mp.Table, e)
+				}
+			}
+			return fmt.Errorf("ApplyConcurrentSteps %s ExecContext error: %w", mp.Table, err)
+		}
+
+		if st.Kind == StepCreateIndex {
+			if err := upsertIndexBuild(ctx, sr.db, schema, mp.Table, st, IndexBuildDone, ""); err != nil {
+				return fmt.Errorf("ApplyConcurrentSteps %s: %w", mp.Table, err)
+			}
+		}
+	}
+	return sr.readBackConcurrentIndexes(ctx, mp)
+}
+
+// readBackConcurrentIndexes saves definitions of built concurrent indexes into the model config
+func (sr *PgStore) readBackConcurrentIndexes(ctx context.Context, mp ModelPlan) error {
+	if mp.To == nil || len(mp.Steps.Concurrent().OfKind(StepCreateIndex)) == 0 {
+		return nil
+	}
+	return sr.WithTx(ctx, func(stx *PgStore) error {
+		ctxTx := WithShard(ctx, Shard{Store: stx})
+		dbidxs, err := CurrentSchemaIndexes(ctxTx, mp.Table)
+		if err != nil {
+			return fmt.Errorf("ApplyConcurrentSteps %s CurrentSchemaIndexes error: %w", mp.Table, err)
+		}
+		readBackIndexes(mp.To, dbidxs, true)
+		return DbConfigTable{TableName: mp.Table, Storej: mp.To}.SaveTable(ctxTx)
+	})
+}
+
+func (sr *PgStore) dropInvalidIndex(ctx context.Context, index string) error {
+	index = strings.ToLower(index)
+	invalid := false
+	if err := sr.db.GetContext(ctx, &invalid, `select exists(
+		select 1 from pg_index as idx
+		join pg_class as i on i.oid = idx.indexrelid
+		join pg_namespace as ns on ns.oid = i.relnamespace
+		where ns.nspname = $1 and i.relname = $2 and not idx.indisvalid)`,
+		sr.Schema(), index); err != nil {
+		return err
+	}
+	if !invalid {
+		return nil
+	}
+	q := fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s.%s", sr.Schema(), index)
+	log.Println(q)
+	_, err := sr.db.ExecContext(ctx, q)
+	return err
+}
+
+func (sr *PgStore) validIndexExists(ctx context.Context, index string) (bool, error) {
+	ok := false
+	err := sr.db.GetContext(ctx, &ok, `select exists(
+		select 1 from pg_index as idx
+		join pg_class as i on i.oid = idx.indexrelid
+		join pg_namespace as ns on ns.oid = i.relnamespace
+		where ns.nspname = $1 and i.relname = $2 and idx.indisvalid)`,
+		sr.Schema(), strings.ToLower(index))
+	return ok, err
+}
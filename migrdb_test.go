@@ -0,0 +1,398 @@
+package pgparty_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/covrom/pgparty"
+)
+
+type UniqueItem struct {
+	ID   pgparty.UUIDv4 `json:"id"`
+	Shop pgparty.UUIDv4 `json:"shop"`
+	Qty  pgparty.Int64  `json:"qty"`
+}
+
+func (UniqueItem) DatabaseName() string { return "unique_items" }
+func (UniqueItem) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[UniqueItem]{}.TypeName()
+}
+func (UniqueItem) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[UniqueItem]{}.Fields()
+}
+func (UniqueItem) Constraints() []pgparty.ModelConstraint {
+	return []pgparty.ModelConstraint{{Unique: []string{"Shop", "Qty"}}}
+}
+
+// migrateTwice migrates the shard and checks that the next migration has no changes
+func migrateTwice(t *testing.T, schema string, register func(sh pgparty.Shard) error) (pgparty.Shard, context.Context) {
+	t.Helper()
+	shs, ctx := pgparty.NewShards(pgparty.WithLoggingQuery(context.Background()))
+	shard := shs.SetShard(schema, db, schema)
+	if err := register(shard); err != nil {
+		t.Fatalf("pgparty.Register error: %s", err)
+	}
+	if err := shard.Migrate(ctx, nil); err != nil {
+		t.Fatalf("first shard.Migrate error: %s", err)
+	}
+	plan, err := shard.PlanMigration(ctx)
+	if err != nil {
+		t.Fatalf("shard.PlanMigration error: %s", err)
+	}
+	if !plan.IsEmpty() {
+		t.Errorf("second migration must be empty:\n%v", plan.Queries())
+	}
+	if err := shard.Migrate(ctx, nil); err != nil {
+		t.Fatalf("second shard.Migrate error: %s", err)
+	}
+	return shard, ctx
+}
+
+func TestMigrateUniqueConstraintTwice(t *testing.T) {
+	if db == nil {
+		t.Error("run TestMain before")
+		return
+	}
+	migrateTwice(t, "uniq_shard", func(sh pgparty.Shard) error {
+		return pgparty.Register(sh, pgparty.MD[UniqueItem]{})
+	})
+}
+
+type DocStatus string
+
+var docStatusValues = []string{"new", "paid"}
+
+func (DocStatus) PostgresEnumValues() []string { return docStatusValues }
+
+type EnumDoc struct {
+	ID     pgparty.UUIDv4 `json:"id"`
+	Status DocStatus      `json:"status"`
+}
+
+func (EnumDoc) DatabaseName() string { return "enum_docs" }
+func (EnumDoc) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[EnumDoc]{}.TypeName()
+}
+func (EnumDoc) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[EnumDoc]{}.Fields()
+}
+
+func TestMigrateEnumValueAddedFirst(t *testing.T) {
+	if db == nil {
+		t.Error("run TestMain before")
+		return
+	}
+	defer func(vs []string) { docStatusValues = vs }(docStatusValues)
+	register := func(sh pgparty.Shard) error {
+		return pgparty.Register(sh, pgparty.MD[EnumDoc]{})
+	}
+	migrateTwice(t, "enum_shard", register)
+	// новое первое значение становится значением по умолчанию колонки
+	docStatusValues = []string{"draft", "new", "paid"}
+	migrateTwice(t, "enum_shard", register)
+}
+
+type OrphanItem struct {
+	ID   pgparty.UUIDv4 `json:"id"`
+	Name pgparty.String `json:"name"`
+}
+
+func (OrphanItem) DatabaseName() string { return "orphan_items" }
+func (OrphanItem) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[OrphanItem]{}.TypeName()
+}
+func (OrphanItem) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[OrphanItem]{}.Fields()
+}
+
+func migrateWithOptions(t *testing.T, schema string, opts pgparty.MigrationOptions, mds ...pgparty.Modeller) pgparty.Shard {
+	t.Helper()
+	shs, ctx := pgparty.NewShards(pgparty.WithMigrationOptions(context.Background(), opts))
+	shard := shs.SetShard(schema, db, schema)
+	for _, m := range mds {
+		if err := pgparty.Register(shard, pgparty.MD[pgparty.Modeller]{Val: m}); err != nil {
+			t.Fatalf("pgparty.Register error: %s", err)
+		}
+	}
+	if err := shard.Migrate(ctx, nil); err != nil {
+		t.Fatalf("shard.Migrate error: %s", err)
+	}
+	return shard
+}
+
+func TestMigrateOrphans(t *testing.T) {
+	if db == nil {
+		t.Error("run TestMain before")
+		return
+	}
+	archive := pgparty.MigrationOptions{Orphans: pgparty.OrphanArchive}
+	migrateWithOptions(t, "orphan_shard", archive, OrphanItem{})
+	migrateWithOptions(t, "orphan_shard", archive, UniqueItem{})
+	// первичный ключ архивной таблицы не мешает новой таблице с тем же именем
+	migrateWithOptions(t, "orphan_shard", archive, OrphanItem{}, UniqueItem{})
+	// повторный архив в тот же день получает следующий номер
+	migrateWithOptions(t, "orphan_shard", archive, UniqueItem{})
+	migrateWithOptions(t, "orphan_shard", archive, OrphanItem{}, UniqueItem{})
+	var archived bool
+	if err := db.Get(&archived, `SELECT to_regclass($1) IS NOT NULL`,
+		"orphan_shard.orphan_items_archive_"+time.Now().Format("20060102")+"_2"); err != nil {
+		t.Fatal(err)
+	}
+	if !archived {
+		t.Error("second archive of the day must be numbered")
+	}
+
+	if _, err := db.Exec(`CREATE VIEW orphan_shard.orphan_names AS SELECT name FROM orphan_shard.orphan_items`); err != nil {
+		t.Fatal(err)
+	}
+	drop := pgparty.MigrationOptions{Orphans: pgparty.OrphanDrop}
+	sh := migrateWithOptions(t, "orphan_shard", drop, UniqueItem{})
+	orphans, err := sh.Orphans(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 1 || len(orphans[0].Dependents) != 1 || orphans[0].Dependents[0] != "orphan_shard.orphan_names" {
+		t.Errorf("table used by the view must be reported: %+v", orphans)
+	}
+}
+
+type SerialItem struct {
+	ID   pgparty.BigSerial `json:"id"`
+	Name pgparty.String    `json:"name"`
+}
+
+func (SerialItem) DatabaseName() string { return "serial_items" }
+func (SerialItem) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[SerialItem]{}.TypeName()
+}
+func (SerialItem) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[SerialItem]{}.Fields()
+}
+
+type IdentitySerialItem struct {
+	ID   pgparty.BigSerial `json:"id" identity:"by default"`
+	Name pgparty.String    `json:"name"`
+}
+
+func (IdentitySerialItem) DatabaseName() string { return "serial_items" }
+func (IdentitySerialItem) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[IdentitySerialItem]{}.TypeName()
+}
+func (IdentitySerialItem) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[IdentitySerialItem]{}.Fields()
+}
+
+func TestMigrateSerialToIdentity(t *testing.T) {
+	if db == nil {
+		t.Error("run TestMain before")
+		return
+	}
+	migrateWithOptions(t, "identity_shard", pgparty.MigrationOptions{}, SerialItem{})
+	if _, err := db.Exec(`INSERT INTO identity_shard.serial_items (name) VALUES ('a'), ('b')`); err != nil {
+		t.Fatal(err)
+	}
+	migrateWithOptions(t, "identity_shard", pgparty.MigrationOptions{}, IdentitySerialItem{})
+
+	var seqs []string
+	if err := db.Select(&seqs, `SELECT sequencename FROM pg_sequences WHERE schemaname = 'identity_shard'`); err != nil {
+		t.Fatal(err)
+	}
+	if len(seqs) != 1 {
+		t.Errorf("old serial sequence must be dropped: %v", seqs)
+	}
+	var id int64
+	if err := db.Get(&id, `INSERT INTO identity_shard.serial_items (name) VALUES ('c') RETURNING id`); err != nil {
+		t.Fatal(err)
+	}
+	if id != 3 {
+		t.Errorf("identity must continue after existing values: %d", id)
+	}
+}
+
+type ArchiveItem struct {
+	ID   pgparty.UUIDv4 `json:"id"`
+	Name pgparty.String `json:"name"`
+}
+
+func (ArchiveItem) DatabaseName() string { return "archive_items" }
+func (ArchiveItem) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[ArchiveItem]{}.TypeName()
+}
+func (ArchiveItem) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[ArchiveItem]{}.Fields()
+}
+
+type ArchiveItemNoName struct {
+	ID pgparty.UUIDv4 `json:"id"`
+}
+
+func (ArchiveItemNoName) DatabaseName() string { return "archive_items" }
+func (ArchiveItemNoName) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[ArchiveItemNoName]{}.TypeName()
+}
+func (ArchiveItemNoName) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[ArchiveItemNoName]{}.Fields()
+}
+
+func TestMigrateArchiveColumnTwice(t *testing.T) {
+	if db == nil {
+		t.Error("run TestMain before")
+		return
+	}
+	archive := pgparty.MigrationOptions{DropColumns: pgparty.ColumnDropArchive}
+	// колонка архивируется второй раз после того, как ее вернули в модель
+	for i := 0; i < 2; i++ {
+		migrateWithOptions(t, "archive_shard", archive, ArchiveItem{})
+		if _, err := db.Exec(`INSERT INTO archive_shard.archive_items (id, name) VALUES (gen_random_uuid(), 'a')`); err != nil {
+			t.Fatal(err)
+		}
+		migrateWithOptions(t, "archive_shard", archive, ArchiveItemNoName{})
+	}
+
+	var tables []string
+	if err := db.Select(&tables, `SELECT tablename FROM pg_tables
+		WHERE schemaname = 'archive_shard' AND tablename LIKE 'archive_items_name_archive%' ORDER BY tablename`); err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 || tables[0] != "archive_items_name_archive" || tables[1] != "archive_items_name_archive_2" {
+		t.Errorf("second archive of the column must get a version suffix: %v", tables)
+	}
+}
+
+type PkParent struct {
+	ID   pgparty.UUIDv4 `json:"id"`
+	Code pgparty.String `json:"code" nullable:"false"`
+}
+
+func (PkParent) DatabaseName() string { return "pk_parents" }
+func (PkParent) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[PkParent]{}.TypeName()
+}
+func (PkParent) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[PkParent]{}.Fields()
+}
+
+type PkParentWide struct {
+	ID   pgparty.UUIDv4 `json:"id"`
+	Code pgparty.String `json:"code" nullable:"false" pk:""`
+}
+
+func (PkParentWide) DatabaseName() string { return "pk_parents" }
+func (PkParentWide) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[PkParentWide]{}.TypeName()
+}
+func (PkParentWide) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[PkParentWide]{}.Fields()
+}
+
+type PkChild struct {
+	ID     pgparty.UUIDv4 `json:"id"`
+	Parent pgparty.UUIDv4 `json:"parent" fk:"PkParent.ID"`
+}
+
+func (PkChild) DatabaseName() string { return "pk_children" }
+func (PkChild) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[PkChild]{}.TypeName()
+}
+func (PkChild) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[PkChild]{}.Fields()
+}
+
+func TestMigratePrimaryKeyReferenced(t *testing.T) {
+	if db == nil {
+		t.Error("run TestMain before")
+		return
+	}
+	migrateWithOptions(t, "pk_shard", pgparty.MigrationOptions{}, PkParent{}, PkChild{})
+
+	// ключ, на который ссылается внешний ключ другой таблицы, не удаляется
+	shs, ctx := pgparty.NewShards(context.Background())
+	shard := shs.SetShard("pk_shard", db, "pk_shard")
+	if err := pgparty.Register(shard, pgparty.MD[PkParentWide]{}); err != nil {
+		t.Fatal(err)
+	}
+	err := shard.Migrate(ctx, nil)
+	var pkerr pgparty.ErrorPrimaryKeyChange
+	if !errors.As(err, &pkerr) {
+		t.Fatalf("expected ErrorPrimaryKeyChange, got %v", err)
+	}
+	if !strings.Contains(pkerr.Reason, "pk_children.") {
+		t.Errorf("referencing foreign key is not reported: %s", pkerr.Reason)
+	}
+}
+
+type CheckItem struct {
+	ID     pgparty.UUIDv4 `json:"id"`
+	Qty    pgparty.Int64  `json:"qty" check:":Qty BETWEEN 1 AND 10"`
+	Status pgparty.String `json:"status"`
+}
+
+func (CheckItem) DatabaseName() string { return "check_items" }
+func (CheckItem) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[CheckItem]{}.TypeName()
+}
+func (CheckItem) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[CheckItem]{}.Fields()
+}
+func (CheckItem) Constraints() []pgparty.ModelConstraint {
+	return []pgparty.ModelConstraint{{Name: "check_items_status_check", Check: ":Status != 'x' AND :Status LIKE 'a%'"}}
+}
+
+func TestMigrateRewrittenCheckTwice(t *testing.T) {
+	if db == nil {
+		t.Error("run TestMain before")
+		return
+	}
+	// postgres переписывает BETWEEN, != и LIKE, повторная миграция не пересоздает ограничения
+	shard, ctx := migrateTwice(t, "check_shard", func(sh pgparty.Shard) error {
+		return pgparty.Register(sh, pgparty.MD[CheckItem]{})
+	})
+	plan, err := shard.PlanMigration(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mp, ok := plan.FindModel(CheckItem{}.TypeName()); !ok || mp.Action != pgparty.MigrationActionNone {
+		t.Errorf("checks must not be altered again: %v", mp.Steps.Queries())
+	}
+}
+
+type PartialItem struct {
+	ID     pgparty.UUIDv4 `json:"id"`
+	Status pgparty.String `json:"status"`
+	Kind   pgparty.String `json:"kind"`
+}
+
+func (PartialItem) DatabaseName() string { return "partial_items" }
+func (PartialItem) TypeName() pgparty.TypeName {
+	return pgparty.StructModel[PartialItem]{}.TypeName()
+}
+func (PartialItem) Fields() []pgparty.FieldDescription {
+	return pgparty.StructModel[PartialItem]{}.Fields()
+}
+func (PartialItem) Indexes() []pgparty.ModelIndex {
+	return []pgparty.ModelIndex{
+		{Name: "active_idx", Fields: []string{"Kind"}, Where: ":Status != 'x' AND :Kind IN ('a', 'b')"},
+		{Name: "status_lower_idx", Expressions: []string{"lower(:Status)"}, Where: ":Status BETWEEN 'a' AND 'k'"},
+	}
+}
+
+func TestMigrateRewrittenIndexTwice(t *testing.T) {
+	if db == nil {
+		t.Error("run TestMain before")
+		return
+	}
+	// postgres переписывает предикаты и выражения, повторная миграция не пересоздает индексы
+	shard, ctx := migrateTwice(t, "partial_shard", func(sh pgparty.Shard) error {
+		return pgparty.Register(sh, pgparty.MD[PartialItem]{})
+	})
+	plan, err := shard.PlanMigration(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mp, ok := plan.FindModel(PartialItem{}.TypeName()); !ok || mp.Action != pgparty.MigrationActionNone {
+		t.Errorf("indexes must not be rebuilt again: %v", mp.Steps.Queries())
+	}
+}
@@ -0,0 +1,391 @@
+package pgparty
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+// MigrationFile is an up or down file of the exported migration
+type MigrationFile struct {
+	Name string `json:"name"` // 1_add_items.up.sql
+	SQL  string `json:"sql"`
+}
+
+func (s Shard) PlanMigrationFromConfig(ctx context.Context, cfg DbConfig) (*MigrationPlan, error) {
+	return s.Store.PlanMigrationFromConfig(WithShard(ctx, s), cfg)
+}
+
+func (s Shard) DbConfigSnapshot(ctx context.Context) (DbConfig, error) {
+	return s.Store.DbConfigSnapshot(WithShard(ctx, s))
+}
+
+func (s Shard) ExportMigration(ctx context.Context, dir string, version uint64, name string) ([]MigrationFile, error) {
+	return s.Store.ExportMigration(WithShard(ctx, s), dir, version, name)
+}
+
+// DbConfigSnapshot returns stored model configs of the schema, it can be saved as json and used by PlanMigrationFromConfig
+func (sr *PgStore) DbConfigSnapshot(ctx context.Context) (DbConfig, error) {
+	shard, err := ShardFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("DbConfigSnapshot: %w", err)
+	}
+	ret := DbConfig{}
+	if err := sr.WithTx(ctx, func(stx *PgStore) error {
+		ctxTx := WithShard(ctx, Shard{shard.ID, stx})
+		ok, err := ConfigTableExists(ctxTx)
+		if err != nil || !ok {
+			return err
+		}
+		return ret.LoadAll(ctxTx, stx.tx, stx.Schema())
+	}); err != nil {
+		return nil, fmt.Errorf("DbConfigSnapshot: %w", err)
+	}
+	return ret, nil
+}
+
+// LoadDbConfigFile reads the json snapshot of stored model configs
+func LoadDbConfigFile(name string) (DbConfig, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	ret := DbConfig{}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return nil, fmt.Errorf("LoadDbConfigFile %s: %w", name, err)
+	}
+	return ret, nil
+}
+
+// PlanMigrationFromConfig builds the migration plan from the snapshot of stored model configs without database access.
+// The database is assumed to match the snapshot exactly: indexes and constraints are taken from it.
+func (sr *PgStore) PlanMigrationFromConfig(ctx context.Context, cfg DbConfig) (*MigrationPlan, error) {
+	opts := MigrationOptionsFromContext(ctx)
+	ret := &MigrationPlan{
+		Schema: sr.Schema(),
+	}
+	mds, err := MigrationOrder(sr.ModelDescriptions())
+	if err != nil {
+		return nil, fmt.Errorf("PlanMigrationFromConfig: %w", err)
+	}
+	if ret.Enums, err = configEnumSteps(ret.Schema, mds, cfg, opts); err != nil {
+		return nil, fmt.Errorf("PlanMigrationFromConfig: %w", err)
+	}
+	recreate := make(map[TypeName]bool)
+	for _, md := range mds {
+		mp := ModelPlan{
+			Model:  md.TypeName(),
+			Table:  md.DatabaseName(),
+			Action: MigrationActionNone,
+		}
+		if mp.To, err = sr.MD2SQLModel(ctx, md); err != nil {
+			return nil, fmt.Errorf("PlanMigrationFromConfig: %w", err)
+		}
+		dbconf, ok := cfg.Find(md.DatabaseName())
+		if !ok || dbconf.IsEmpty() {
+			mp.Action = MigrationActionCreate
+			mp.Steps = createModelSteps(ret.Schema, md, mp.To)
+		} else {
+			from := *dbconf.Storej
+			sortStoredModel(&from)
+			mp.From = &from
+			mp.To.KeepDBDefs(&from)
+			retainDroppedColumns(ret.Schema, &from, mp.To, opts.DropColumns)
+			if !from.Equal(mp.To) {
+				mp.Action = MigrationActionAlter
+				mp.Steps, err = alterModelSteps(ret.Schema, md, mp.From, mp.To, nil,
+					ExpectedDBIndexes(ret.Schema, mp.From), ExpectedDBConstraints(mp.From), opts)
+				if err != nil {
+					return nil, fmt.Errorf("PlanMigrationFromConfig: %w", err)
+				}
+			}
+		}
+		mp.Fingerprint = MigrationFingerprint(mp.From, mp.To, nil, nil, nil)
+		ret.Models = append(ret.Models, sr.planDependentViews(mds, recreate, md, mp))
+	}
+	return ret, nil
+}
+
+// configEnumSteps plans ENUM types assuming the database has types and columns of the snapshot models
+func configEnumSteps(schema string, mds []*ModelDesc, cfg DbConfig, opts MigrationOptions) (PatchSteps, error) {
+	enums, err := ModelEnums(mds)
+	if err != nil || len(enums) == 0 {
+		return nil, err
+	}
+	var dbenums modelcols.SQLEnums
+	uses := make(map[string][]EnumColumn)
+	for _, dbconf := range cfg {
+		if dbconf.IsEmpty() {
+			continue
+		}
+		for _, en := range dbconf.Storej.Enums {
+			if _, ok := dbenums.FindByName(en.Name); !ok {
+				dbenums = append(dbenums, en)
+			}
+		}
+		for _, col := range dbconf.Storej.Columns {
+			for _, en := range dbconf.Storej.Enums {
+				if strings.EqualFold(col.DataType, EnumTypeName(schema, en.Name)) {
+					uses[en.Name] = append(uses[en.Name], EnumColumn{
+						Table:   dbconf.TableName,
+						Column:  col.ColName,
+						Default: col.DefaultValue,
+					})
+				}
+			}
+		}
+	}
+	return SQLEnumSteps(schema, enums, dbenums, uses, opts)
+}
+
+// ExpectedDBIndexes returns index definitions that the database has after migration to the model config
+func ExpectedDBIndexes(schema string, m *modelcols.SQLModel) DBIndexDefs {
+	var ret DBIndexDefs
+	for _, idx := range m.Indexes {
+		method := idx.MethodName
+		if len(method) == 0 {
+			method = "btree"
+		}
+		dbidx := DBIndexDef{
+			Name:       strings.ToLower(m.Table + idx.Name),
+			Table:      m.Table,
+			Schema:     schema,
+			Method:     method,
+			IsUnique:   idx.IsUnique,
+			Predicate:  idx.Where,
+			Definition: idx.Options,
+		}
+		if len(idx.DBDef) > 0 {
+			dbidx.Definition = idx.DBDef
+		}
+		dbidx.Fields = append(dbidx.Fields, idx.Columns...)
+		dbidx.Fields = append(dbidx.Fields, idx.Expressions...)
+		dbidx.Fields = append(dbidx.Fields, idx.Include...)
+		with := strings.Trim(strings.TrimSpace(idx.With), "()")
+		for _, o := range strings.Split(with, ",") {
+			if o = strings.Join(strings.Fields(o), ""); len(o) > 0 {
+				dbidx.Options = append(dbidx.Options, o)
+			}
+		}
+		ret = append(ret, dbidx)
+	}
+	return ret
+}
+
+// ExpectedDBConstraints returns PRIMARY KEY, CHECK and UNIQUE constraints that the database has after migration to the model config
+func ExpectedDBConstraints(m *modelcols.SQLModel) DBConstraintDefs {
+	var ret DBConstraintDefs
+	if pks := m.PrimaryKeyColumns(); len(pks) > 0 && !m.IsView {
+		ret = append(ret, DBConstraintDef{
+			Name: strings.ToLower(m.Table) + "_pkey",
+			Type: "p",
+			Def:  "PRIMARY KEY (" + strings.Join(pks, ", ") + ")",
+		})
+	}
+	for _, c := range m.Constraints {
+		ret = append(ret, constraintDBDef(c))
+	}
+	return ret
+}
+
+// ExportMigration plans migration of the live schema and writes it as golang-migrate files into dir
+func (sr *PgStore) ExportMigration(ctx context.Context, dir string, version uint64, name string) ([]MigrationFile, error) {
+	plan, err := sr.PlanMigration(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files, err := plan.MigrationFiles(version, name)
+	if err != nil {
+		return nil, err
+	}
+	return files, WriteMigrationFiles(dir, files)
+}
+
+// WriteMigrationFiles writes migration files into dir
+func WriteMigrationFiles(dir string, files []MigrationFile) error {
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.Name), []byte(f.SQL), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrationFiles renders the plan as numbered up and down files in golang-migrate layout.
+// Transactional steps of all models go into the version file with model configs saved into _config,
+// each concurrent index step gets its own next version because it can't run in a transaction block.
+// Down files revert the plan: created tables are dropped, altered models are altered back
+// and columns added by the plan are dropped.
+func (p *MigrationPlan) MigrationFiles(version uint64, name string) ([]MigrationFile, error) {
+	if p.IsEmpty() {
+		return nil, nil
+	}
+	up := []string{
+		"CREATE SCHEMA IF NOT EXISTS " + p.Schema,
+		configTableDDL(p.Schema),
+	}
+	up = append(up, p.Enums.Queries()...)
+	var conc PatchSteps
+	for _, mp := range p.Models {
+		if mp.Action == MigrationActionNone {
+			continue
+		}
+		if mp.Adopted {
+			up = append(up, saveConfigSQL(p.Schema, mp.Table, mp.From))
+		}
+		up = append(up, stepsSQL(mp.Steps.Transactional())...)
+		up = append(up, saveConfigSQL(p.Schema, mp.Table, mp.To))
+		conc = append(conc, mp.Steps.Concurrent()...)
+	}
+
+	// откат: сначала удаляем представления, затем откатываем таблицы в обратном порядке,
+	// и создаем представления заново в прямом порядке
+	var downDrops, downTables, downCreates []string
+	for i := len(p.Models) - 1; i >= 0; i-- {
+		mp := p.Models[i]
+		if mp.Action == MigrationActionNone {
+			continue
+		}
+		steps, err := p.reverseModelSteps(mp, conc)
+		if err != nil {
+			return nil, err
+		}
+		restore := deleteConfigSQL(p.Schema, mp.Table)
+		if mp.Action == MigrationActionAlter && !mp.Adopted {
+			restore = saveConfigSQL(p.Schema, mp.Table, mp.From)
+		}
+		if mp.To.IsView {
+			var creates []string
+			for _, st := range steps {
+				switch st.Kind {
+				case StepDropIndex, StepDropView:
+					downDrops = append(downDrops, st.SQL)
+				default:
+					creates = append(creates, st.SQL)
+				}
+			}
+			downCreates = append(append(creates, restore), downCreates...)
+			continue
+		}
+		downTables = append(downTables, stepsSQL(steps)...)
+		downTables = append(downTables, restore)
+	}
+	down := append(append(downDrops, downTables...), downCreates...)
+	for i := len(p.Enums) - 1; i >= 0; i-- {
+		st := p.Enums[i]
+		if st.Kind == StepCreateType {
+			down = append(down, "DROP TYPE IF EXISTS "+st.Type)
+		} else {
+			down = append(down, "-- enum change is not reverted: "+st.SQL)
+		}
+	}
+
+	ret := []MigrationFile{
+		{Name: fmt.Sprintf("%d_%s.up.sql", version, name), SQL: joinSQL(up)},
+		{Name: fmt.Sprintf("%d_%s.down.sql", version, name), SQL: joinSQL(down)},
+	}
+	for i, st := range conc {
+		v := version + uint64(i) + 1
+		cdown := "-- nothing to revert, index is restored by the previous version"
+		if st.Kind == StepCreateIndex {
+			cdown = PatchDropIndex{
+				Schema:       p.Schema,
+				Index:        st.Index,
+				Concurrently: true,
+			}.String()
+		}
+		ret = append(ret,
+			MigrationFile{Name: fmt.Sprintf("%d_%s_%s.up.sql", v, name, st.Index), SQL: joinSQL([]string{st.SQL})},
+			MigrationFile{Name: fmt.Sprintf("%d_%s_%s.down.sql", v, name, st.Index), SQL: joinSQL([]string{cdown})},
+		)
+	}
+	return ret, nil
+}
+
+// reverseModelSteps plans the model back from the plan target to its source,
+// indexes built concurrently by the plan are dropped by their own down files
+func (p *MigrationPlan) reverseModelSteps(mp ModelPlan, conc PatchSteps) (PatchSteps, error) {
+	if mp.Action == MigrationActionCreate {
+		if mp.To.IsView {
+			return PatchView{
+				Schema:    p.Schema,
+				Name:      mp.Table,
+				DropViews: []fmt.Stringer{PatchDropView{Schema: p.Schema, Table: mp.Table, Materialized: mp.To.IsMaterialized}},
+			}.Steps(), nil
+		}
+		return PatchSteps{{Kind: StepDropTable, SQL: fmt.Sprintf("DROP TABLE IF EXISTS %s.%s", p.Schema, mp.Table)}}, nil
+	}
+
+	to := reverseRenames(mp.To, mp.From)
+	to.Indexes = make(modelcols.SQLIndexes, len(mp.From.Indexes))
+	copy(to.Indexes, mp.From.Indexes)
+	for i := range to.Indexes {
+		to.Indexes[i].Concurrently = false
+	}
+	if mp.To.IsView {
+		return SQLAlterViewPatch(p.Schema, mp.Table, mp.To, to, nil).Steps(), nil
+	}
+
+	built := make(map[string]bool)
+	for _, st := range conc {
+		if st.Kind == StepCreateIndex {
+			built[strings.ToLower(st.Index)] = true
+		}
+	}
+	var dbidxs DBIndexDefs
+	for _, dbidx := range ExpectedDBIndexes(p.Schema, mp.To) {
+		if !built[dbidx.Name] {
+			dbidxs = append(dbidxs, dbidx)
+		}
+	}
+	pt, err := SQLAlterTablePatch(p.Schema, mp.Table, mp.To, to, nil, dbidxs, ExpectedDBConstraints(mp.To),
+		MigrationOptions{DropColumns: ColumnDrop, AllowUnsafeTypeChanges: true})
+	if err != nil {
+		return nil, err
+	}
+	return pt.Steps(), nil
+}
+
+func stepsSQL(steps PatchSteps) []string {
+	ret := make([]string, 0, len(steps))
+	for _, st := range steps {
+		if st.Kind == StepValidatePrimaryKey {
+			// проверка выполняется только при Migrate, в файле оставляем запрос для ручной проверки
+			ret = append(ret, "-- new primary key must not have duplicates: "+st.SQL)
+			continue
+		}
+		ret = append(ret, st.SQL)
+	}
+	return ret
+}
+
+func saveConfigSQL(schema, table string, m *modelcols.SQLModel) string {
+	b, _ := json.Marshal(m)
+	return fmt.Sprintf(`INSERT INTO %s._config (table_name,storej) VALUES(%s,%s) ON CONFLICT(table_name) DO UPDATE SET storej=excluded.storej`,
+		schema, quoteSQLString(table), quoteSQLString(string(b)))
+}
+
+func deleteConfigSQL(schema, table string) string {
+	return fmt.Sprintf(`DELETE FROM %s._config WHERE table_name = %s`, schema, quoteSQLString(table))
+}
+
+func quoteSQLString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func joinSQL(qs []string) string {
+	var b strings.Builder
+	for _, q := range qs {
+		b.WriteString(q)
+		if !strings.HasPrefix(q, "--") {
+			b.WriteString(";")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
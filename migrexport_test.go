@@ -0,0 +1,100 @@
+package pgparty
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+func TestMigrationFiles(t *testing.T) {
+	from := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "name", DataType: "VARCHAR(50)"},
+		},
+	}
+	to := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "name", DataType: "VARCHAR(50)"},
+			{ColName: "qty", DataType: "BIGINT", NotNull: true, DefaultValue: "0"},
+		},
+		Indexes: modelcols.SQLIndexes{
+			{Name: "nameidx", Columns: []string{"name"}, Concurrently: true},
+		},
+	}
+	pt, err := SQLAlterTablePatch("sh", "items", from, to, nil, ExpectedDBIndexes("sh", from), nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := &modelcols.SQLModel{
+		Table: "logs",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "BIGSERIAL", NotNull: true, PrimaryKey: true},
+		},
+	}
+	ct := &PatchTable{Schema: "sh", Name: "logs"}
+	SQLCreateTableWithColumns(ct, logs)
+
+	plan := &MigrationPlan{
+		Schema: "sh",
+		Models: []ModelPlan{
+			{Model: "Item", Table: "items", Action: MigrationActionAlter, Steps: pt.Steps(), From: from, To: to},
+			{Model: "Log", Table: "logs", Action: MigrationActionCreate, Steps: ct.Steps(), To: logs},
+		},
+	}
+	files, err := plan.MigrationFiles(7, "items_qty")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	wantNames := []string{
+		"7_items_qty.up.sql",
+		"7_items_qty.down.sql",
+		"8_items_qty_itemsnameidx.up.sql",
+		"8_items_qty_itemsnameidx.down.sql",
+	}
+	if strings.Join(names, " ") != strings.Join(wantNames, " ") {
+		t.Fatalf("files %v, want %v", names, wantNames)
+	}
+
+	for _, want := range []string{
+		"ALTER TABLE sh.items ADD COLUMN qty BIGINT NOT NULL DEFAULT 0;",
+		"CREATE TABLE sh.logs (id BIGSERIAL NOT NULL,PRIMARY KEY (id));",
+		"INSERT INTO sh._config (table_name,storej) VALUES('logs',",
+	} {
+		if !strings.Contains(files[0].SQL, want) {
+			t.Errorf("up file has no %q:\n%s", want, files[0].SQL)
+		}
+	}
+	if strings.Contains(files[0].SQL, "CONCURRENTLY") {
+		t.Errorf("concurrent steps must be in own files:\n%s", files[0].SQL)
+	}
+
+	down := files[1].SQL
+	for _, want := range []string{
+		"DROP TABLE IF EXISTS sh.logs;\nDELETE FROM sh._config WHERE table_name = 'logs';\n",
+		"ALTER TABLE sh.items DROP COLUMN qty;",
+	} {
+		if !strings.Contains(down, want) {
+			t.Errorf("down file has no %q:\n%s", want, down)
+		}
+	}
+	if strings.Index(down, "sh.logs") > strings.Index(down, "sh.items") {
+		t.Errorf("down file must revert models in reverse order:\n%s", down)
+	}
+
+	if files[2].SQL != "CREATE INDEX CONCURRENTLY itemsnameidx ON sh.items(name );\n" {
+		t.Errorf("wrong concurrent up file: %q", files[2].SQL)
+	}
+	if files[3].SQL != "DROP INDEX CONCURRENTLY IF EXISTS sh.itemsnameidx;\n" {
+		t.Errorf("wrong concurrent down file: %q", files[3].SQL)
+	}
+}
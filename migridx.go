@@ -4,19 +4,29 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/covrom/pgparty/modelcols"
 )
 
 type DBIndexDef struct {
-	Name   string      `db:"indname"`
-	Table  string      `db:"tablename"`
-	Schema string      `db:"nspname"`
-	Fields StringArray `db:"indkey_names"`
+	Name       string      `db:"indname"`
+	Table      string      `db:"tablename"`
+	Schema     string      `db:"nspname"`
+	Fields     StringArray `db:"indkey_names"`
+	Invalid    bool        `db:"indinvalid"` // left by failed CREATE INDEX CONCURRENTLY
+	Method     string      `db:"amname"`
+	IsUnique   bool        `db:"indisunique"`
+	Predicate  string      `db:"indpred"`    // WHERE of partial index
+	Options    StringArray `db:"reloptions"` // fillfactor=70
+	Definition string      `db:"indexdef"`   // pg_get_indexdef output
 }
 
 func (d DBIndexDef) String() string {
+	if len(d.Definition) > 0 {
+		return d.Definition
+	}
 	return fmt.Sprintf("%s (%s)", d.Name, strings.Join(d.Fields, ", "))
 }
 
@@ -45,6 +55,7 @@ func CurrentSchemaIndexes(ctx context.Context, tablename string) (DBIndexDefs, e
 
 	var idxs []DBIndexDef
 
+	// индексы ограничений UNIQUE и EXCLUDE принадлежат ограничениям и сравниваются вместе с ними
 	q := `select
 			i.relname as indname,
 			idx.indrelid::regclass::text tablename,
@@ -58,6 +69,12 @@ func CurrentSchemaIndexes(ctx context.Context, tablename string) (DBIndexDefs, e
 			order by
 				k
 			)) as indkey_names,
+			not idx.indisvalid as indinvalid,
+			am.amname,
+			idx.indisunique,
+			coalesce(pg_get_expr(idx.indpred, idx.indrelid, true), '') as indpred,
+			to_jsonb(coalesce(i.reloptions, '{}'::text[])) as reloptions,
+			pg_get_indexdef(idx.indexrelid) as indexdef,
 			ns.nspname nspname
 		from
 			pg_index as idx
@@ -72,6 +89,8 @@ func CurrentSchemaIndexes(ctx context.Context, tablename string) (DBIndexDefs, e
 			ns.oid = i.relnamespace
 		where 
 		not idx.indisprimary
+		and not exists (select 1 from pg_constraint c
+			where c.conrelid = idx.indrelid and c.conindid = idx.indexrelid and c.contype in ('p', 'u', 'x'))
 		and idx.indrelid::regclass::text = $1
 		order by i.relname`
 
@@ -83,6 +102,14 @@ func CurrentSchemaIndexes(ctx context.Context, tablename string) (DBIndexDefs, e
 }
 
 func IndexesEqualToDBIndexes(sqs *modelcols.SQLModel, dbidxs DBIndexDefs) bool {
+	// индексы принятой таблицы вне модели не сравниваются
+	managed := make(DBIndexDefs, 0, len(dbidxs))
+	for _, dbidx := range dbidxs {
+		if !sqs.IsUnmanagedIndex(dbidx.Name) {
+			managed = append(managed, dbidx)
+		}
+	}
+	dbidxs = managed
 	ins := sqs.AllIndexLowerNames()
 	if len(ins) != len(dbidxs) {
 		return false
@@ -100,8 +127,95 @@ func IndexesEqualToDBIndexes(sqs *modelcols.SQLModel, dbidxs DBIndexDefs) bool {
 	return true
 }
 
+// IndexEqualDBIndex compares the index of the model with its definition in the database:
+// columns, expressions, method, uniqueness, predicate, options and storage parameters.
+// The definition read back after the migration is compared as is, postgres rewrites expressions and predicates.
 func IndexEqualDBIndex(tname string, idx modelcols.SQLIndex, dbidx DBIndexDef) bool {
 	inm := strings.ToLower(tname + idx.Name)
-	return strings.EqualFold(inm, dbidx.Name) &&
-		modelcols.ColumnsEqual(dbidx.Fields, idx.Columns)
+	if dbidx.Invalid || !strings.EqualFold(inm, dbidx.Name) {
+		return false
+	}
+	if len(idx.DBDef) > 0 {
+		return dbidx.Definition == idx.DBDef
+	}
+	if idx.IsUnique != dbidx.IsUnique {
+		return false
+	}
+	method := idx.MethodName
+	if len(method) == 0 {
+		method = "btree"
+	}
+	if !strings.EqualFold(method, dbidx.Method) {
+		return false
+	}
+	if normIndexExpr(idx.Where) != normIndexExpr(dbidx.Predicate) {
+		return false
+	}
+	if !indexWithEqual(idx.With, dbidx.Options) {
+		return false
+	}
+	if len(idx.Options) > 0 {
+		// классы операторов и порядок сортировки ищем в определении индекса
+		def := strings.ToLower(dbidx.Definition)
+		for _, o := range strings.Fields(idx.Options) {
+			if !strings.Contains(def, strings.ToLower(strings.Trim(o, "()"))) {
+				return false
+			}
+		}
+	}
+	nkeys := len(idx.Columns) + len(idx.Expressions)
+	if len(dbidx.Fields) != nkeys+len(idx.Include) {
+		return false
+	}
+	// ключи индекса сравниваем по порядку, как они созданы: сначала колонки, затем выражения
+	if !modelcols.OrderedColumnsEqual(dbidx.Fields[:len(idx.Columns)], idx.Columns) {
+		return false
+	}
+	// выражения нормализуются postgres, поэтому сравниваем их без скобок, пробелов и приведений типов
+	for i, e := range idx.Expressions {
+		if normIndexExpr(e) != normIndexExpr(dbidx.Fields[len(idx.Columns)+i]) {
+			return false
+		}
+	}
+	// порядок включенных колонок не важен
+	return modelcols.ColumnsEqual(dbidx.Fields[nkeys:], idx.Include)
+}
+
+// readBackIndexes stores definitions of the model indexes as postgres prints them,
+// concurrent indexes are read back after they are built
+func readBackIndexes(m *modelcols.SQLModel, dbidxs DBIndexDefs, concurrent bool) {
+	for i, idx := range m.Indexes {
+		if idx.Concurrently != concurrent {
+			continue
+		}
+		if dbidx, ok := dbidxs.FindByName(m.Table + idx.Name); ok && !dbidx.Invalid {
+			m.Indexes[i].DBDef = dbidx.Definition
+		}
+	}
+}
+
+var reIndexExprCast = regexp.MustCompile(`::[a-z_]+( varying| precision| with(out)? time zone)?(\[\])?`)
+
+// normIndexExpr reduces the expression to a form that doesn't depend on postgres deparsing
+func normIndexExpr(s string) string {
+	s = reIndexExprCast.ReplaceAllString(strings.ToLower(s), "")
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '\r', '(', ')', '"':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func indexWithEqual(with string, reloptions []string) bool {
+	with = strings.TrimSpace(with)
+	with = strings.TrimSuffix(strings.TrimPrefix(with, "("), ")")
+	var opts []string
+	for _, o := range strings.Split(with, ",") {
+		if o = strings.Join(strings.Fields(o), ""); len(o) > 0 {
+			opts = append(opts, o)
+		}
+	}
+	return modelcols.ColumnsEqual(opts, reloptions)
 }
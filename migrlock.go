@@ -0,0 +1,107 @@
+package pgparty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultMigrationLockTimeout is used when MigrationOptions.LockTimeout is not set
+const DefaultMigrationLockTimeout = 5 * time.Minute
+
+// MigrationLockKey returns the advisory lock key of the schema migration
+func MigrationLockKey(schema string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("pgparty.migrate." + strings.ToLower(schema)))
+	return int64(h.Sum64())
+}
+
+// concurrentLockKey serializes concurrent index builds of the schema between instances
+func concurrentLockKey(schema string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("pgparty.concurrent." + strings.ToLower(schema)))
+	return int64(h.Sum64())
+}
+
+// lockMigration takes pg_advisory_xact_lock of the schema in the migration transaction,
+// waited reports that the lock was held by another instance
+func (sr *PgStore) lockMigration(ctx context.Context, timeout time.Duration) (waited bool, err error) {
+	if sr.tx == nil {
+		return false, ErrorNoTransaction{}
+	}
+	return advisoryLock(ctx, sr.tx, sr.Schema(), MigrationLockKey(sr.Schema()), true, timeout)
+}
+
+// lockConcurrent takes session advisory lock for the concurrent phase on the dedicated connection,
+// unlock must be called to release the lock and the connection
+func (sr *PgStore) lockConcurrent(ctx context.Context, timeout time.Duration) (unlock func(), err error) {
+	conn, err := sr.db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := concurrentLockKey(sr.Schema())
+	if waited, err := advisoryLock(ctx, conn, sr.Schema(), key, false, timeout); err != nil {
+		if waited {
+			// блокировка могла быть получена до ошибки сброса таймаута
+			conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+		}
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key); err != nil {
+			log.Printf("can't unlock concurrent migration of %s: %s", sr.Schema(), err)
+		}
+		conn.Close()
+	}, nil
+}
+
+type lockQueryer interface {
+	sqlx.QueryerContext
+	sqlx.ExecerContext
+}
+
+func advisoryLock(ctx context.Context, q lockQueryer, schema string, key int64, xact bool, timeout time.Duration) (waited bool, err error) {
+	if timeout <= 0 {
+		timeout = DefaultMigrationLockTimeout
+	}
+	tryfn, fn, set, reset := "pg_try_advisory_lock", "pg_advisory_lock", "SET", "RESET lock_timeout"
+	if xact {
+		tryfn, fn, set, reset = "pg_try_advisory_xact_lock", "pg_advisory_xact_lock", "SET LOCAL", "SET LOCAL lock_timeout TO DEFAULT"
+	}
+
+	ok := false
+	if err := sqlx.GetContext(ctx, q, &ok, `SELECT `+tryfn+`($1)`, key); err != nil {
+		return false, err
+	}
+	if ok {
+		return false, nil
+	}
+
+	log.Printf("another instance is migrating schema %s, waiting up to %s", schema, timeout)
+	if _, err := q.ExecContext(ctx, fmt.Sprintf("%s lock_timeout = %d", set, timeout.Milliseconds())); err != nil {
+		return true, err
+	}
+	// соединение сессионной блокировки возвращается в пул, таймаут сбрасываем и при ошибке,
+	// контекст ожидания может быть уже отменен
+	defer func() {
+		if _, rerr := q.ExecContext(context.Background(), reset); rerr != nil && err == nil {
+			err = rerr
+		}
+	}()
+	if _, err := q.ExecContext(ctx, `SELECT `+fn+`($1)`, key); err != nil {
+		var pgerr *pgconn.PgError
+		if errors.As(err, &pgerr) && pgerr.Code == "55P03" { // lock_not_available
+			return true, ErrorMigrationLocked{Schema: schema, Timeout: timeout}
+		}
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,51 @@
+package pgparty
+
+import (
+	"context"
+	"time"
+)
+
+// ColumnDropPolicy defines what migration does with columns
+// that exist in the stored model config but are gone from the model
+type ColumnDropPolicy string
+
+const (
+	ColumnDropNever   ColumnDropPolicy = "never"   // keep column in table, only warn
+	ColumnDropArchive ColumnDropPolicy = "archive" // copy column with primary key into archive table, then drop
+	ColumnDrop        ColumnDropPolicy = "drop"    // drop column
+)
+
+type MigrationOptions struct {
+	DropColumns ColumnDropPolicy
+	// LockTimeout limits waiting for the schema migration lock held by another instance,
+	// DefaultMigrationLockTimeout is used when zero
+	LockTimeout time.Duration
+	// ServiceVersion is recorded in the schema history with applied migrations
+	ServiceVersion string
+	// AllowUnsafeTypeChanges permits column type changes that may fail or lose data,
+	// a column with `using` tag is allowed without it
+	AllowUnsafeTypeChanges bool
+	// Orphans is a policy of tables and views whose models are not registered anymore, OrphanWarn by default
+	Orphans OrphanPolicy
+	// OrphanGracePeriod is a time since detection after which orphans are dropped by OrphanDrop policy
+	OrphanGracePeriod time.Duration
+	// AdoptExisting takes tables and views created without pgparty under management:
+	// their config is introspected from the database and then altered to the model
+	AdoptExisting bool
+	// AllowEnumValueRemoval recreates ENUM types whose values are removed from the model,
+	// by default such migration is refused
+	AllowEnumValueRemoval bool
+}
+
+type migrationOptions struct{}
+
+func WithMigrationOptions(ctx context.Context, opts MigrationOptions) context.Context {
+	return context.WithValue(ctx, migrationOptions{}, opts)
+}
+
+func MigrationOptionsFromContext(ctx context.Context) MigrationOptions {
+	if opts, ok := ctx.Value(migrationOptions{}).(MigrationOptions); ok {
+		return opts
+	}
+	return MigrationOptions{}
+}
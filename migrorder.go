@@ -0,0 +1,143 @@
+package pgparty
+
+// ModelDependencies returns type names of models that must be migrated before md:
+// tables referenced by foreign keys and models read by the view query
+func (md *ModelDesc) ModelDependencies() []TypeName {
+	var ret []TypeName
+	for _, dep := range md.ForeignKeyModels() {
+		if dep != md.TypeName() {
+			ret = UniqAdd(ret, dep)
+		}
+	}
+	if md.IsView() {
+		for _, dep := range md.ViewQueryModels() {
+			ret = UniqAdd(ret, dep)
+		}
+	}
+	return ret
+}
+
+// MigrationOrder sorts models in topological order of their dependencies,
+// so that referenced tables and views are migrated first. Cycle of dependencies is an error.
+func MigrationOrder(mds map[TypeName]*ModelDesc) ([]*ModelDesc, error) {
+	sorted := SortedModelDescriptions(mds)
+	ret := make([]*ModelDesc, 0, len(sorted))
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[TypeName]int, len(sorted))
+	var path []TypeName
+
+	var visit func(md *ModelDesc) error
+	visit = func(md *ModelDesc) error {
+		switch state[md.TypeName()] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := []TypeName{md.TypeName()}
+			for i := len(path) - 1; i >= 0 && path[i] != md.TypeName(); i-- {
+				cycle = append([]TypeName{path[i]}, cycle...)
+			}
+			return ErrorModelDependencyCycle{Models: append([]TypeName{md.TypeName()}, cycle...)}
+		}
+		state[md.TypeName()] = visiting
+		path = append(path, md.TypeName())
+		for _, dep := range md.ModelDependencies() {
+			if depmd, ok := mds[dep]; ok {
+				if err := visit(depmd); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[md.TypeName()] = visited
+		ret = append(ret, md)
+		return nil
+	}
+
+	for _, md := range sorted {
+		if err := visit(md); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// DependentViews returns views that read the model directly or through other views,
+// order must be the result of MigrationOrder, the views are returned in the same order
+func DependentViews(order []*ModelDesc, tn TypeName) []*ModelDesc {
+	var ret []*ModelDesc
+	affected := map[TypeName]bool{tn: true}
+	for _, md := range order {
+		if !md.IsView() || affected[md.TypeName()] {
+			continue
+		}
+		for _, dep := range md.ViewQueryModels() {
+			if affected[dep] {
+				affected[md.TypeName()] = true
+				ret = append(ret, md)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// columnsChanged reports whether the table steps rename, drop or change the type of columns,
+// views that read such a table must be dropped before the steps
+func columnsChanged(steps PatchSteps) bool {
+	for _, st := range steps {
+		switch st.Kind {
+		case StepRenameColumn, StepArchiveColumn, StepDropColumn:
+			return true
+		case StepAlterTable:
+			if st.TypeChange != TypeChangeNone {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// planDependentViews drops views that read the changed view or the table with changed columns
+// before the change and recreates them later in the migration order,
+// recreate collects such views between calls
+func (sr *PgStore) planDependentViews(order []*ModelDesc, recreate map[TypeName]bool, md *ModelDesc, mp ModelPlan) ModelPlan {
+	// удаленное представление создается заново, даже если у него изменились только комментарии
+	if recreate[md.TypeName()] && mp.From != nil && len(mp.Steps.OfKind(StepDropView)) == 0 &&
+		(mp.Action == MigrationActionNone || mp.Action == MigrationActionAlter) {
+		mp.Action = MigrationActionAlter
+		mp.Steps = SQLRecreateViewPatch(sr.Schema(), md.DatabaseName(), mp.From, mp.To).Steps()
+	}
+	if mp.Action != MigrationActionAlter {
+		return mp
+	}
+	// представление с новыми комментариями не пересоздается, зависимые от него не удаляются
+	if md.IsView() && len(mp.Steps.OfKind(StepDropView)) == 0 {
+		return mp
+	}
+	if !md.IsView() && !columnsChanged(mp.Steps) {
+		return mp
+	}
+	deps := DependentViews(order, md.TypeName())
+	if len(deps) == 0 {
+		return mp
+	}
+	steps := make(PatchSteps, 0, len(deps)+len(mp.Steps))
+	for i := len(deps) - 1; i >= 0; i-- {
+		dv := deps[i]
+		recreate[dv.TypeName()] = true
+		steps = append(steps, PatchStep{
+			Kind: StepDropView,
+			SQL: PatchDropView{
+				Schema:       sr.Schema(),
+				Table:        dv.DatabaseName(),
+				Materialized: dv.IsMaterialized(),
+			}.String(),
+		})
+	}
+	mp.Steps = append(steps, mp.Steps...)
+	return mp
+}
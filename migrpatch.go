@@ -12,45 +12,157 @@ type PatchTable struct {
 	Schema string
 	Name   string
 
-	DropIndexes   []fmt.Stringer
-	UpdateNulls   []fmt.Stringer
-	AlterCols     []fmt.Stringer
-	CreateTables  []fmt.Stringer
-	CreateIndexes []fmt.Stringer
+	DropIndexes     []fmt.Stringer
+	DropConstraints []fmt.Stringer
+	RenameCols      []fmt.Stringer
+	ArchiveCols     []fmt.Stringer
+	DropCols        []fmt.Stringer
+	UpdateNulls     []fmt.Stringer
+	AlterCols       []fmt.Stringer
+	CreateTables    []fmt.Stringer
+	Validations     []fmt.Stringer
+	AddConstraints  []fmt.Stringer
+	CreateIndexes   []fmt.Stringer
+	Comments        []fmt.Stringer
+}
+
+type PatchStepKind string
+
+const (
+	StepDropIndex          PatchStepKind = "drop_index"
+	StepDropConstraint     PatchStepKind = "drop_constraint"
+	StepRenameColumn       PatchStepKind = "rename_column"
+	StepArchiveColumn      PatchStepKind = "archive_column"
+	StepDropColumn         PatchStepKind = "drop_column"
+	StepUpdateNulls        PatchStepKind = "update_nulls"
+	StepAlterTable         PatchStepKind = "alter_table"
+	StepCreateTable        PatchStepKind = "create_table"
+	StepValidatePrimaryKey PatchStepKind = "validate_primary_key"
+	StepAddConstraint      PatchStepKind = "add_constraint"
+	StepCreateIndex        PatchStepKind = "create_index"
+	StepDropView           PatchStepKind = "drop_view"
+	StepCreateView         PatchStepKind = "create_view"
+	StepDropTable          PatchStepKind = "drop_table"
+	StepCreateType         PatchStepKind = "create_type"
+	StepAlterType          PatchStepKind = "alter_type"
+	StepAddEnumValue       PatchStepKind = "add_enum_value" // committed before other steps, new values can't be used in the same transaction
+	StepComment            PatchStepKind = "comment"
+)
+
+// PatchStep is a single DDL statement of a migration plan.
+// Concurrent steps can't run inside a transaction and are applied after commit.
+// TypeChange is the most risky column type change of the step.
+type PatchStep struct {
+	Kind       PatchStepKind    `json:"kind"`
+	SQL        string           `json:"sql"`
+	Index      string           `json:"index,omitempty"`
+	Type       string           `json:"type,omitempty"` // ENUM тип для create_type, alter_type и add_enum_value
+	Concurrent bool             `json:"concurrent,omitempty"`
+	TypeChange ColumnTypeChange `json:"typeChange,omitempty"`
 }
 
-func (pt PatchTable) Queries() []string {
-	ret := make([]string, 0)
-	if len(pt.DropIndexes) > 0 {
-		for _, c := range pt.DropIndexes {
-			ret = append(ret, c.String())
+type PatchSteps []PatchStep
+
+func (steps PatchSteps) Queries() []string {
+	ret := make([]string, 0, len(steps))
+	for _, st := range steps {
+		ret = append(ret, st.SQL)
+	}
+	return ret
+}
+
+func (steps PatchSteps) Transactional() PatchSteps {
+	ret := make(PatchSteps, 0, len(steps))
+	for _, st := range steps {
+		if !st.Concurrent {
+			ret = append(ret, st)
 		}
 	}
-	if len(pt.UpdateNulls) > 0 {
-		for _, c := range pt.UpdateNulls {
-			ret = append(ret, c.String())
+	return ret
+}
+
+func (steps PatchSteps) Concurrent() PatchSteps {
+	ret := make(PatchSteps, 0)
+	for _, st := range steps {
+		if st.Concurrent {
+			ret = append(ret, st)
 		}
 	}
-	if len(pt.AlterCols) > 0 {
-		cs := make([]string, 0, len(pt.AlterCols))
-		for _, c := range pt.AlterCols {
-			cs = append(cs, c.String())
+	return ret
+}
+
+func (steps PatchSteps) OfKind(kind PatchStepKind) PatchSteps {
+	ret := make(PatchSteps, 0)
+	for _, st := range steps {
+		if st.Kind == kind {
+			ret = append(ret, st)
 		}
-		ret = append(ret, fmt.Sprintf("ALTER TABLE %s.%s %s", pt.Schema, pt.Name, strings.Join(cs, ", ")))
 	}
-	if len(pt.CreateTables) > 0 {
-		for _, c := range pt.CreateTables {
-			ret = append(ret, c.String())
+	return ret
+}
+
+func (steps PatchSteps) WithoutKind(kind PatchStepKind) PatchSteps {
+	ret := make(PatchSteps, 0, len(steps))
+	for _, st := range steps {
+		if st.Kind != kind {
+			ret = append(ret, st)
 		}
 	}
-	if len(pt.CreateIndexes) > 0 {
-		for _, c := range pt.CreateIndexes {
-			ret = append(ret, c.String())
+	return ret
+}
+
+func appendSteps(steps PatchSteps, kind PatchStepKind, cs []fmt.Stringer) PatchSteps {
+	for _, c := range cs {
+		st := PatchStep{Kind: kind, SQL: c.String()}
+		switch v := c.(type) {
+		case PatchCreateIndex:
+			st.Index = v.Table + v.Index.Name
+			st.Concurrent = v.Index.Concurrently
+		case PatchDropIndex:
+			st.Index = v.Table + v.Index
+			st.Concurrent = v.Concurrently
 		}
+		steps = append(steps, st)
 	}
+	return steps
+}
+
+func (pt PatchTable) Steps() PatchSteps {
+	ret := make(PatchSteps, 0)
+	// новый первичный ключ проверяется до удаления старого
+	ret = appendSteps(ret, StepValidatePrimaryKey, pt.Validations)
+	ret = appendSteps(ret, StepDropIndex, pt.DropIndexes)
+	ret = appendSteps(ret, StepDropConstraint, pt.DropConstraints)
+	ret = appendSteps(ret, StepRenameColumn, pt.RenameCols)
+	ret = appendSteps(ret, StepArchiveColumn, pt.ArchiveCols)
+	ret = appendSteps(ret, StepDropColumn, pt.DropCols)
+	ret = appendSteps(ret, StepUpdateNulls, pt.UpdateNulls)
+	if len(pt.AlterCols) > 0 {
+		cs := make([]string, 0, len(pt.AlterCols))
+		change := TypeChangeNone
+		for _, c := range pt.AlterCols {
+			cs = append(cs, c.String())
+			if ct, ok := c.(PatchAlterColumnType); ok && typeChangeRank[ct.Change] > typeChangeRank[change] {
+				change = ct.Change
+			}
+		}
+		ret = append(ret, PatchStep{
+			Kind:       StepAlterTable,
+			TypeChange: change,
+			SQL:        fmt.Sprintf("ALTER TABLE %s.%s %s", pt.Schema, pt.Name, strings.Join(cs, ", ")),
+		})
+	}
+	ret = appendSteps(ret, StepCreateTable, pt.CreateTables)
+	ret = appendSteps(ret, StepAddConstraint, pt.AddConstraints)
+	ret = appendSteps(ret, StepCreateIndex, pt.CreateIndexes)
+	ret = appendSteps(ret, StepComment, pt.Comments)
 	return ret
 }
 
+func (pt PatchTable) Queries() []string {
+	return pt.Steps().Queries()
+}
+
 func (pt *PatchTable) AddColumnPatch(cp fmt.Stringer) {
 	pt.AlterCols = append(pt.AlterCols, cp)
 }
@@ -59,6 +171,30 @@ func (pt *PatchTable) AddDropIndexPatch(cp fmt.Stringer) {
 	pt.DropIndexes = append(pt.DropIndexes, cp)
 }
 
+func (pt *PatchTable) AddDropConstraintPatch(cp fmt.Stringer) {
+	pt.DropConstraints = append(pt.DropConstraints, cp)
+}
+
+func (pt *PatchTable) AddValidatePatch(cp fmt.Stringer) {
+	pt.Validations = append(pt.Validations, cp)
+}
+
+func (pt *PatchTable) AddConstraintPatch(cp fmt.Stringer) {
+	pt.AddConstraints = append(pt.AddConstraints, cp)
+}
+
+func (pt *PatchTable) AddRenameColumnPatch(cp fmt.Stringer) {
+	pt.RenameCols = append(pt.RenameCols, cp)
+}
+
+func (pt *PatchTable) AddArchiveColumnPatch(cp fmt.Stringer) {
+	pt.ArchiveCols = append(pt.ArchiveCols, cp)
+}
+
+func (pt *PatchTable) AddDropColumnPatch(cp fmt.Stringer) {
+	pt.DropCols = append(pt.DropCols, cp)
+}
+
 func (pt *PatchTable) AddUpdateNullsPatch(cp fmt.Stringer) {
 	pt.UpdateNulls = append(pt.UpdateNulls, cp)
 }
@@ -71,28 +207,180 @@ func (pt *PatchTable) AddCreateIndexPatch(cp fmt.Stringer) {
 	pt.CreateIndexes = append(pt.CreateIndexes, cp)
 }
 
+func (pt *PatchTable) AddCommentPatch(cp fmt.Stringer) {
+	pt.Comments = append(pt.Comments, cp)
+}
+
 type PatchAddColumn struct {
 	Col modelcols.SQLColumn
 }
 
 func (c PatchAddColumn) String() string {
-	snull := ""
-	if c.Col.NotNull {
-		snull = " NOT NULL"
+	return "ADD COLUMN " + columnDef(c.Col)
+}
+
+// columnDef is a column definition of CREATE TABLE and ADD COLUMN
+func columnDef(c modelcols.SQLColumn) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s %s", c.ColName, c.DataType)
+	if c.NotNull {
+		fmt.Fprint(sb, " NOT NULL")
 	}
-	sdef := ""
-	if len(c.Col.DefaultValue) > 0 && !c.Col.PrimaryKey {
-		sdef = " DEFAULT " + c.Col.DefaultValue
+	switch {
+	case len(c.Generated) > 0:
+		fmt.Fprintf(sb, " GENERATED ALWAYS AS (%s) STORED", c.Generated)
+	case len(c.Identity) > 0:
+		fmt.Fprintf(sb, " GENERATED %s AS IDENTITY", c.Identity)
+	case len(c.DefaultValue) > 0 && !c.PrimaryKey:
+		fmt.Fprint(sb, " DEFAULT ", c.DefaultValue)
 	}
-	return fmt.Sprintf("ADD COLUMN %s %s%s%s", c.Col.ColName, c.Col.DataType, snull, sdef)
+	return sb.String()
 }
 
-type PatchAlterColumnType struct {
+// PatchRebuildColumn drops the generated column before it is added again with the new expression
+type PatchRebuildColumn struct {
+	Schema string
+	Table  string
+	Col    string
+}
+
+func (c PatchRebuildColumn) String() string {
+	return fmt.Sprintf("ALTER TABLE %s.%s DROP COLUMN %s", c.Schema, c.Table, c.Col)
+}
+
+type PatchDropColumn struct {
 	Col modelcols.SQLColumn
 }
 
+func (c PatchDropColumn) String() string {
+	return fmt.Sprintf("DROP COLUMN %s", c.Col.ColName)
+}
+
+type PatchRenameColumn struct {
+	Schema string
+	Table  string
+	From   string
+	To     string
+}
+
+func (c PatchRenameColumn) String() string {
+	return fmt.Sprintf("ALTER TABLE %s.%s RENAME COLUMN %s TO %s", c.Schema, c.Table, c.From, c.To)
+}
+
+// PatchArchiveColumn copies column values with primary key into a separate table before drop,
+// the next archive of the same column gets the first free version suffix: _2, _3 and so on
+type PatchArchiveColumn struct {
+	Schema string
+	Table  string
+	Col    string
+	PKs    []string
+}
+
+func (c PatchArchiveColumn) String() string {
+	cols := append(append([]string{}, c.PKs...), c.Col)
+	// имя архива выбирается при выполнении, чтобы план не зависел от уже существующих архивов
+	return fmt.Sprintf("DO $$DECLARE n text := '%s_%s_archive'; v int := 1; "+
+		"BEGIN WHILE to_regclass('%s.' || quote_ident(n)) IS NOT NULL LOOP v := v + 1; n := '%s_%s_archive_' || v; END LOOP; "+
+		"EXECUTE 'CREATE TABLE %s.' || quote_ident(n) || ' AS SELECT %s FROM %s.%s'; END$$",
+		c.Table, c.Col, c.Schema, c.Table, c.Col, c.Schema, strings.Join(cols, ", "), c.Schema, c.Table)
+}
+
+type PatchDropConstraint struct {
+	Schema string
+	Table  string
+	Name   string
+}
+
+func (c PatchDropConstraint) String() string {
+	return fmt.Sprintf("ALTER TABLE %s.%s DROP CONSTRAINT IF EXISTS %s", c.Schema, c.Table, c.Name)
+}
+
+// PatchValidatePrimaryKey selects duplicates of the new primary key before the table is changed,
+// the result must be empty. Cols are existing columns of the key, without them nothing is selected,
+// duplicates in new columns are reported by postgres when the key is added.
+type PatchValidatePrimaryKey struct {
+	Schema string
+	Table  string
+	Cols   []string
+}
+
+func (c PatchValidatePrimaryKey) String() string {
+	if len(c.Cols) == 0 {
+		return fmt.Sprintf("SELECT FROM %s.%s LIMIT 0", c.Schema, c.Table)
+	}
+	cols := strings.Join(c.Cols, ", ")
+	return fmt.Sprintf("SELECT %s FROM %s.%s GROUP BY %s HAVING count(*) > 1 LIMIT 1",
+		cols, c.Schema, c.Table, cols)
+}
+
+type PatchAddPrimaryKey struct {
+	Schema string
+	Table  string
+	Cols   []string
+}
+
+func (c PatchAddPrimaryKey) String() string {
+	return fmt.Sprintf("ALTER TABLE %s.%s ADD PRIMARY KEY (%s)", c.Schema, c.Table, strings.Join(c.Cols, ","))
+}
+
+type PatchAddForeignKey struct {
+	Schema string
+	Table  string
+	FK     modelcols.SQLForeignKey
+}
+
+func (c PatchAddForeignKey) String() string {
+	return fmt.Sprintf("ALTER TABLE %s.%s ADD %s", c.Schema, c.Table, foreignKeyDef(c.Schema, c.FK))
+}
+
+func foreignKeyDef(schema string, fk modelcols.SQLForeignKey) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s.%s (%s)",
+		fk.Name, strings.Join(fk.Columns, ","), schema, fk.RefTable, strings.Join(fk.RefColumns, ","))
+	if len(fk.OnDelete) > 0 {
+		fmt.Fprint(sb, " ON DELETE ", fk.OnDelete)
+	}
+	if len(fk.OnUpdate) > 0 {
+		fmt.Fprint(sb, " ON UPDATE ", fk.OnUpdate)
+	}
+	return sb.String()
+}
+
+type PatchAddConstraint struct {
+	Schema string
+	Table  string
+	Con    modelcols.SQLConstraint
+}
+
+func (c PatchAddConstraint) String() string {
+	return fmt.Sprintf("ALTER TABLE %s.%s ADD %s", c.Schema, c.Table, constraintDef(c.Con))
+}
+
+func constraintDef(con modelcols.SQLConstraint) string {
+	if con.Type == modelcols.ConstraintUnique {
+		return fmt.Sprintf("CONSTRAINT %s UNIQUE (%s)", con.Name, strings.Join(con.Columns, ","))
+	}
+	return fmt.Sprintf("CONSTRAINT %s CHECK (%s)", con.Name, con.Expr)
+}
+
+type PatchAlterColumnType struct {
+	Col         modelcols.SQLColumn
+	From        string
+	Using       string
+	Change      ColumnTypeChange
+	DropDefault bool // default is set again by PatchAlterColumnDefVal
+}
+
 func (c PatchAlterColumnType) String() string {
-	return fmt.Sprintf("ALTER COLUMN %s TYPE %s", c.Col.ColName, c.Col.DataType)
+	sb := &strings.Builder{}
+	if c.DropDefault {
+		fmt.Fprintf(sb, "ALTER COLUMN %s DROP DEFAULT, ", c.Col.ColName)
+	}
+	fmt.Fprintf(sb, "ALTER COLUMN %s TYPE %s", c.Col.ColName, c.Col.DataType)
+	if len(c.Using) > 0 {
+		fmt.Fprint(sb, " USING ", c.Using)
+	}
+	return sb.String()
 }
 
 type PatchAlterColumnNullable struct {
@@ -117,14 +405,83 @@ func (c PatchAlterColumnDefVal) String() string {
 	return fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", c.Col.ColName)
 }
 
-type PatchDropIndex struct {
+// PatchDropExpression turns the generated column into a regular one keeping its values
+type PatchDropExpression struct {
+	Col modelcols.SQLColumn
+}
+
+func (c PatchDropExpression) String() string {
+	return fmt.Sprintf("ALTER COLUMN %s DROP EXPRESSION", c.Col.ColName)
+}
+
+// PatchSetIdentity changes ALWAYS and BY DEFAULT of the identity column
+type PatchSetIdentity struct {
+	Col modelcols.SQLColumn
+}
+
+func (c PatchSetIdentity) String() string {
+	return fmt.Sprintf("ALTER COLUMN %s SET GENERATED %s", c.Col.ColName, c.Col.Identity)
+}
+
+type PatchAddIdentity struct {
+	Schema string
+	Table  string
+	Col    modelcols.SQLColumn
+}
+
+func (c PatchAddIdentity) String() string {
+	return fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN %s ADD GENERATED %s AS IDENTITY",
+		c.Schema, c.Table, c.Col.ColName, c.Col.Identity)
+}
+
+// PatchDropSerialSequence drops the sequence of the serial column if it exists,
+// otherwise pg_get_serial_sequence may return it instead of the identity sequence
+type PatchDropSerialSequence struct {
+	Schema string
+	Table  string
+	Col    string
+}
+
+func (c PatchDropSerialSequence) String() string {
+	return fmt.Sprintf("DO $$DECLARE s text := pg_get_serial_sequence('%s.%s', '%s'); "+
+		"BEGIN IF s IS NOT NULL THEN EXECUTE 'DROP SEQUENCE ' || s; END IF; END$$",
+		c.Schema, c.Table, c.Col)
+}
+
+// PatchSyncIdentity continues the identity sequence after the existing values of the column
+type PatchSyncIdentity struct {
+	Schema string
+	Table  string
+	Col    string
+}
+
+func (c PatchSyncIdentity) String() string {
+	return fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s.%s', '%s'), coalesce(max(%s), 0) + 1, false) FROM %s.%s",
+		c.Schema, c.Table, c.Col, c.Col, c.Schema, c.Table)
+}
+
+type PatchDropIdentity struct {
 	Schema string
 	Table  string
-	Index  string
-	Force  bool
+	Col    string
+}
+
+func (c PatchDropIdentity) String() string {
+	return fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN %s DROP IDENTITY IF EXISTS", c.Schema, c.Table, c.Col)
+}
+
+type PatchDropIndex struct {
+	Schema       string
+	Table        string
+	Index        string
+	Force        bool
+	Concurrently bool
 }
 
 func (c PatchDropIndex) String() string {
+	if c.Concurrently {
+		return fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s.%s%s", c.Schema, c.Table, c.Index)
+	}
 	if c.Force {
 		return fmt.Sprintf("DROP INDEX %s.%s%s", c.Schema, c.Table, c.Index)
 	}
@@ -163,9 +520,21 @@ func (c PatchCreateIndex) String() string {
 	if len(c.Index.MethodName) > 0 {
 		fmt.Fprint(sb, " USING ", c.Index.MethodName)
 	}
-	fmt.Fprintf(sb, "(%s %s)", strings.Join(c.Index.Columns, ", "), c.Index.Options)
+	items := make([]string, 0, len(c.Index.Columns)+len(c.Index.Expressions))
+	items = append(items, c.Index.Columns...)
+	for _, e := range c.Index.Expressions {
+		items = append(items, "("+e+")")
+	}
+	fmt.Fprintf(sb, "(%s %s)", strings.Join(items, ", "), c.Index.Options)
+	if len(c.Index.Include) > 0 {
+		fmt.Fprintf(sb, " INCLUDE (%s)", strings.Join(c.Index.Include, ", "))
+	}
 	if len(c.Index.With) > 0 {
-		fmt.Fprint(sb, " WITH ", c.Index.With)
+		if strings.HasPrefix(c.Index.With, "(") {
+			fmt.Fprint(sb, " WITH ", c.Index.With)
+		} else {
+			fmt.Fprintf(sb, " WITH (%s)", c.Index.With)
+		}
 	}
 	if len(c.Index.Where) > 0 {
 		fmt.Fprint(sb, " WHERE ", c.Index.Where)
@@ -174,32 +543,42 @@ func (c PatchCreateIndex) String() string {
 }
 
 type PatchCreateTable struct {
-	Schema string
-	Table  string
-	Cols   modelcols.SQLColumns
+	Schema    string
+	Table     string
+	Cols      modelcols.SQLColumns
+	FKs       modelcols.SQLForeignKeys
+	Cons      modelcols.SQLConstraints
+	Partition *modelcols.SQLPartition
+	PKs       []string // primary key columns in declared order, sorted columns with PrimaryKey if empty
 }
 
 func (c PatchCreateTable) String() string {
 	res := make([]string, len(c.Cols))
 	pks := make([]string, 0, 1)
 	for i, v := range c.Cols {
-		snull := ""
-		if v.NotNull {
-			snull = " NOT NULL"
-		}
-		sdef := ""
-		if len(v.DefaultValue) > 0 && !v.PrimaryKey {
-			sdef = " DEFAULT " + v.DefaultValue
-		}
-		res[i] = fmt.Sprintf("%s %s%s%s", v.ColName, v.DataType, snull, sdef)
+		res[i] = columnDef(v)
 		if v.PrimaryKey {
 			pks = append(pks, v.ColName)
 		}
 	}
-	if len(pks) > 0 {
+	if len(c.PKs) > 0 {
+		pks = c.PKs
+	} else {
 		sort.Strings(pks)
+	}
+	if len(pks) > 0 {
 		res = append(res, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(pks, ",")))
 	}
+	for _, fk := range c.FKs {
+		res = append(res, foreignKeyDef(c.Schema, fk))
+	}
+	for _, con := range c.Cons {
+		res = append(res, constraintDef(con))
+	}
+	if c.Partition != nil {
+		return fmt.Sprintf("CREATE TABLE %s.%s (%s) PARTITION BY %s (%s)", c.Schema, c.Table, strings.Join(res, ","),
+			c.Partition.Method, strings.Join(c.Partition.Columns, ","))
+	}
 	return fmt.Sprintf("CREATE TABLE %s.%s (%s)", c.Schema, c.Table, strings.Join(res, ","))
 }
 
@@ -211,6 +590,7 @@ type PatchView struct {
 	CreateViews   []fmt.Stringer
 	DropIndexes   []fmt.Stringer
 	CreateIndexes []fmt.Stringer
+	Comments      []fmt.Stringer
 }
 
 func (pt *PatchView) AddDropViewPatch(cp fmt.Stringer) {
@@ -229,31 +609,24 @@ func (pt *PatchView) AddCreateIndexPatch(cp fmt.Stringer) {
 	pt.CreateIndexes = append(pt.CreateIndexes, cp)
 }
 
-func (pt PatchView) Queries() []string {
-	ret := make([]string, 0)
-	if len(pt.DropIndexes) > 0 {
-		for _, c := range pt.DropIndexes {
-			ret = append(ret, c.String())
-		}
-	}
-	if len(pt.DropViews) > 0 {
-		for _, c := range pt.DropViews {
-			ret = append(ret, c.String())
-		}
-	}
-	if len(pt.CreateViews) > 0 {
-		for _, c := range pt.CreateViews {
-			ret = append(ret, c.String())
-		}
-	}
-	if len(pt.CreateIndexes) > 0 {
-		for _, c := range pt.CreateIndexes {
-			ret = append(ret, c.String())
-		}
-	}
+func (pt *PatchView) AddCommentPatch(cp fmt.Stringer) {
+	pt.Comments = append(pt.Comments, cp)
+}
+
+func (pt PatchView) Steps() PatchSteps {
+	ret := make(PatchSteps, 0)
+	ret = appendSteps(ret, StepDropIndex, pt.DropIndexes)
+	ret = appendSteps(ret, StepDropView, pt.DropViews)
+	ret = appendSteps(ret, StepCreateView, pt.CreateViews)
+	ret = appendSteps(ret, StepCreateIndex, pt.CreateIndexes)
+	ret = appendSteps(ret, StepComment, pt.Comments)
 	return ret
 }
 
+func (pt PatchView) Queries() []string {
+	return pt.Steps().Queries()
+}
+
 type PatchCreateView struct {
 	Schema       string
 	Table        string
@@ -269,10 +642,35 @@ func (c PatchCreateView) String() string {
 }
 
 type PatchDropView struct {
-	Schema string
-	Table  string
+	Schema       string
+	Table        string
+	Materialized bool
 }
 
 func (c PatchDropView) String() string {
+	if c.Materialized {
+		return fmt.Sprintf("DROP MATERIALIZED VIEW IF EXISTS %s.%s", c.Schema, c.Table)
+	}
 	return fmt.Sprintf("DROP VIEW IF EXISTS %s.%s", c.Schema, c.Table)
 }
+
+// PatchComment sets the comment of Object (TABLE, VIEW, MATERIALIZED VIEW) or of the Column when it is set,
+// empty Text removes the comment
+type PatchComment struct {
+	Schema string
+	Table  string
+	Object string
+	Column string
+	Text   string
+}
+
+func (c PatchComment) String() string {
+	text := "NULL"
+	if len(c.Text) > 0 {
+		text = quoteSQLString(c.Text)
+	}
+	if len(c.Column) > 0 {
+		return fmt.Sprintf("COMMENT ON COLUMN %s.%s.%s IS %s", c.Schema, c.Table, c.Column, text)
+	}
+	return fmt.Sprintf("COMMENT ON %s %s.%s IS %s", c.Object, c.Schema, c.Table, text)
+}
@@ -0,0 +1,455 @@
+package pgparty
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+type MigrationAction string
+
+const (
+	MigrationActionNone   MigrationAction = "none"
+	MigrationActionCreate MigrationAction = "create"
+	MigrationActionAlter  MigrationAction = "alter"
+)
+
+// ModelPlan is a planned migration of one model table or view.
+// Fingerprint identifies the live schema state the plan was built from.
+type ModelPlan struct {
+	Model       TypeName            `json:"model"`
+	Table       string              `json:"table"`
+	Action      MigrationAction     `json:"action"`
+	Steps       PatchSteps          `json:"steps,omitempty"`
+	From        *modelcols.SQLModel `json:"from,omitempty"`
+	To          *modelcols.SQLModel `json:"to"`
+	Fingerprint string              `json:"fingerprint"`
+	// Adopted is set when the table existed without stored config and From is introspected from it
+	Adopted bool `json:"adopted,omitempty"`
+}
+
+// MigrationPlan is a dry-run result of migration for all models of the schema.
+// It can be serialized, reviewed and applied later with ApplyMigrationPlan.
+type MigrationPlan struct {
+	Schema  string      `json:"schema"`
+	Enums   PatchSteps  `json:"enums,omitempty"`
+	Models  []ModelPlan `json:"models"`
+	Orphans []Orphan    `json:"orphans,omitempty"`
+}
+
+func (p MigrationPlan) IsEmpty() bool {
+	if len(p.Enums) > 0 {
+		return false
+	}
+	for _, mp := range p.Models {
+		if mp.Action != MigrationActionNone {
+			return false
+		}
+	}
+	return true
+}
+
+func (p MigrationPlan) FindModel(tn TypeName) (ModelPlan, bool) {
+	for _, mp := range p.Models {
+		if mp.Model == tn {
+			return mp, true
+		}
+	}
+	return ModelPlan{}, false
+}
+
+func (p MigrationPlan) Queries() []string {
+	ret := p.Enums.Queries()
+	for _, mp := range p.Models {
+		ret = append(ret, mp.Steps.Queries()...)
+	}
+	return ret
+}
+
+func (s Shard) PlanMigration(ctx context.Context) (*MigrationPlan, error) {
+	return s.Store.PlanMigration(WithShard(ctx, s))
+}
+
+func (s Shard) ApplyMigrationPlan(ctx context.Context, plan *MigrationPlan, mProcessor MigrationProcessor) error {
+	return s.Store.ApplyMigrationPlan(WithShard(ctx, s), plan, mProcessor)
+}
+
+// PlanMigration builds the migration plan without executing any DDL
+func (sr *PgStore) PlanMigration(ctx context.Context) (*MigrationPlan, error) {
+	shard, err := ShardFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("PlanMigration: %w", err)
+	}
+	ret := &MigrationPlan{
+		Schema: sr.Schema(),
+	}
+	if err := sr.WithTx(ctx, func(stx *PgStore) error {
+		ctxTx := WithShard(ctx, Shard{shard.ID, stx})
+		mds, err := MigrationOrder(stx.ModelDescriptions())
+		if err != nil {
+			return err
+		}
+		ret.Enums, err = stx.planEnums(ctxTx, mds, MigrationOptionsFromContext(ctx))
+		if err != nil {
+			return err
+		}
+		recreate := make(map[TypeName]bool)
+		for _, md := range mds {
+			mp, err := stx.PlanModel(ctxTx, md)
+			if err != nil {
+				return err
+			}
+			ret.Models = append(ret.Models, stx.planDependentViews(mds, recreate, md, mp))
+		}
+		ret.Orphans, err = stx.findOrphans(ctxTx)
+		if err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("PlanMigration: %w", err)
+	}
+	return ret, nil
+}
+
+// ApplyMigrationPlan applies the previously approved plan.
+// It refuses with ErrorMigrationPlanOutdated if the live schema or models changed since planning.
+func (sr *PgStore) ApplyMigrationPlan(ctx context.Context, plan *MigrationPlan, mProcessor MigrationProcessor) error {
+	if plan == nil {
+		return fmt.Errorf("ApplyMigrationPlan: plan is nil")
+	}
+	if plan.Schema != sr.Schema() {
+		return fmt.Errorf("ApplyMigrationPlan: plan schema %q differs from store schema %q", plan.Schema, sr.Schema())
+	}
+	for _, mp := range plan.Models {
+		if _, ok := sr.ModelDescriptions()[mp.Model]; !ok {
+			return ErrorMigrationPlanOutdated{Schema: plan.Schema, Table: mp.Table}
+		}
+	}
+	_, err := sr.migrate(ctx, plan, mProcessor)
+	return err
+}
+
+func SortedModelDescriptions(mds map[TypeName]*ModelDesc) []*ModelDesc {
+	ret := make([]*ModelDesc, 0, len(mds))
+	for _, md := range mds {
+		ret = append(ret, md)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].DatabaseName() < ret[j].DatabaseName()
+	})
+	return ret
+}
+
+// ConfigTableExists checks that the _config table of store schema is created
+func ConfigTableExists(ctx context.Context) (bool, error) {
+	s, err := ShardFromContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("ConfigTableExists: %w", err)
+	}
+	stx := s.Store
+	if stx == nil || stx.tx == nil {
+		return false, fmt.Errorf("context must contains store transaction")
+	}
+	ok := false
+	if err := stx.tx.GetContext(ctx, &ok, `SELECT to_regclass($1) IS NOT NULL`, stx.Schema()+"._config"); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// PlanModel computes migration steps of the model without executing them
+func (sr *PgStore) PlanModel(ctx context.Context, md *ModelDesc) (ModelPlan, error) {
+	if sr.tx == nil {
+		return ModelPlan{}, fmt.Errorf("context must contains store transaction")
+	}
+	mdsn := sr.Schema()
+
+	ret := ModelPlan{
+		Model:  md.TypeName(),
+		Table:  md.DatabaseName(),
+		Action: MigrationActionNone,
+	}
+
+	dbidxs, err := CurrentSchemaIndexes(ctx, md.DatabaseName())
+	if err != nil {
+		return ret, fmt.Errorf("PlanModel CurrentSchemaIndexes error: %w", err)
+	}
+
+	log.Printf("db table %s have indexes: %s", mdsn+"."+md.DatabaseName(), dbidxs)
+
+	// грузим конфиг схемы, если он уже создан
+	dbconf := &DbConfigTable{
+		TableName: md.DatabaseName(),
+		Storej:    &modelcols.SQLModel{},
+	}
+	cfgExists, err := ConfigTableExists(ctx)
+	if err != nil {
+		return ret, err
+	}
+	if cfgExists {
+		if err := dbconf.LoadTable(ctx, md.DatabaseName()); err != nil {
+			return ret, err
+		}
+	}
+
+	sqsmd, err := sr.MD2SQLModel(ctx, md)
+	if err != nil {
+		return ret, err
+	}
+	ret.To = sqsmd
+
+	var colinfos []DBColInfo
+	var dbcons DBConstraintDefs
+	if !md.IsView() {
+		colinfos, err = DBColumnsInfo(ctx, sr.tx, mdsn, md.DatabaseName())
+		if err != nil {
+			return ret, fmt.Errorf("PlanModel DBColumnsInfo error: %w", err)
+		}
+		dbcons, err = CurrentSchemaConstraints(ctx, md.DatabaseName())
+		if err != nil {
+			return ret, fmt.Errorf("PlanModel CurrentSchemaConstraints error: %w", err)
+		}
+	}
+
+	opts := MigrationOptionsFromContext(ctx)
+	if dbconf.IsEmpty() {
+		// конфига нет, но таблица могла быть создана без pgparty
+		kind, err := sr.relationKind(ctx, md.DatabaseName())
+		if err != nil {
+			return ret, fmt.Errorf("PlanModel relationKind error: %w", err)
+		}
+		switch {
+		case len(kind) == 0, kind == relKindView && md.IsView() && !opts.AdoptExisting:
+			// представление пересоздается через CREATE OR REPLACE
+		case !opts.AdoptExisting:
+			return ret, ErrorUnmanagedTable{Schema: mdsn, Table: md.DatabaseName()}
+		default:
+			adopted, err := sr.adoptModel(ctx, md, kind, colinfos, dbidxs)
+			if err != nil {
+				return ret, err
+			}
+			dbconf.Storej = adopted
+			ret.Adopted = true
+		}
+	}
+
+	if dbconf.IsEmpty() && !ret.Adopted {
+		// пустая - создаем
+		ret.Action = MigrationActionCreate
+		ret.Steps = createModelSteps(mdsn, md, sqsmd)
+	} else {
+		sqsdb := dbconf.Storej
+		ret.From = sqsdb
+		sqsmd.KeepDBDefs(sqsdb)
+		retainDroppedColumns(mdsn, sqsdb, sqsmd, opts.DropColumns)
+		if ret.Adopted || !(sqsdb.Equal(sqsmd) && IndexesEqualToDBIndexes(sqsmd, dbidxs) &&
+			ConstraintsEqualToDBConstraints(sqsmd, dbcons)) {
+			// модифицируем таблицу
+			ret.Action = MigrationActionAlter
+			ret.Steps, err = alterModelSteps(mdsn, md, sqsdb, sqsmd, colinfos, dbidxs, dbcons, opts)
+			if err != nil {
+				return ret, err
+			}
+		}
+	}
+
+	ret.Fingerprint = MigrationFingerprint(ret.From, ret.To, dbidxs, colinfos, dbcons)
+
+	return ret, nil
+}
+
+func createModelSteps(schema string, md *ModelDesc, to *modelcols.SQLModel) PatchSteps {
+	if md.IsView() {
+		pv := &PatchView{
+			Schema: schema,
+			Name:   md.DatabaseName(),
+		}
+		SQLCreateView(pv, to)
+		return pv.Steps()
+	}
+	pt := &PatchTable{
+		Schema: schema,
+		Name:   md.DatabaseName(),
+	}
+	SQLCreateTableWithColumns(pt, to)
+	return pt.Steps()
+}
+
+func alterModelSteps(schema string, md *ModelDesc, from, to *modelcols.SQLModel, colinfos []DBColInfo,
+	dbidxs DBIndexDefs, dbcons DBConstraintDefs, opts MigrationOptions,
+) (PatchSteps, error) {
+	if md.IsView() {
+		return SQLAlterViewPatch(schema, md.DatabaseName(), from, to, dbidxs).Steps(), nil
+	}
+	pt, err := SQLAlterTablePatch(schema, md.DatabaseName(), from, to, colinfos, dbidxs, dbcons, opts)
+	if err != nil {
+		return nil, err
+	}
+	return pt.Steps(), nil
+}
+
+// MigrationFingerprint is a hash of stored and target models with the live table state
+func MigrationFingerprint(from, to *modelcols.SQLModel, dbidxs DBIndexDefs, colinfos []DBColInfo,
+	dbcons DBConstraintDefs,
+) string {
+	cis := make([]DBColInfo, len(colinfos))
+	copy(cis, colinfos)
+	sort.Slice(cis, func(i, j int) bool {
+		return cis[i].Name < cis[j].Name
+	})
+	b, _ := json.Marshal(struct {
+		From        *modelcols.SQLModel
+		To          *modelcols.SQLModel
+		Indexes     DBIndexDefs
+		Columns     []DBColInfo
+		Constraints DBConstraintDefs
+	}{from, to, dbidxs, cis, dbcons})
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// ApplyModelPlan executes plan steps of the model in the store transaction and saves the model config.
+// Concurrent index steps are only registered as pending, they are executed by ApplyConcurrentSteps after commit.
+// The _migrations table of mProcessor is created once per migration before plans of models.
+func (sr *PgStore) ApplyModelPlan(ctx context.Context, md *ModelDesc, mp ModelPlan, mProcessor MigrationProcessor) error {
+	if sr.tx == nil {
+		return fmt.Errorf("context must contains store transaction")
+	}
+	mdsn := sr.Schema()
+
+	switch mp.Action {
+	case MigrationActionCreate:
+		if err := sr.execModelPlan(ctx, mp); err != nil {
+			return err
+		}
+		if mProcessor != nil {
+			if err := mProcessor.AfterCreateNewSchemaTable(ctx, sr, md, mdsn); err != nil {
+				return err
+			}
+		}
+		return nil
+	case MigrationActionAlter:
+		if mp.Adopted {
+			if err := sr.saveAdoptedModel(ctx, mp); err != nil {
+				return err
+			}
+		}
+		if err := sr.execModelPlan(ctx, mp); err != nil {
+			if mProcessor != nil {
+				if err2 := mProcessor.AfterAlterModelError(ctx, err, sr, md, mp.From, mp.To, mdsn); err2 != nil {
+					return err2
+				}
+			}
+			return err
+		}
+	}
+
+	if mProcessor != nil {
+		if err := mProcessor.AfterMigrate(ctx, sr, sr, mp.From, mp.To, mdsn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sr *PgStore) execModelPlan(ctx context.Context, mp ModelPlan) error {
+	qsqls := mp.Steps.Transactional().Queries()
+
+	log.Println(strings.Join(qsqls, "\n"))
+
+	for _, st := range mp.Steps.Transactional() {
+		if st.Kind == StepValidatePrimaryKey {
+			if err := sr.validatePrimaryKey(ctx, mp, st); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := sr.tx.ExecContext(ctx, st.SQL); err != nil {
+			return fmt.Errorf("ApplyModelPlan %s ExecContext error: %w", mp.Table, err)
+		}
+	}
+
+	// определения индексов и ограничений сохраняются такими, как их вернул postgres, с ними сравнивается база
+	if mp.To != nil && len(mp.To.Indexes) > 0 {
+		dbidxs, err := CurrentSchemaIndexes(ctx, mp.Table)
+		if err != nil {
+			return fmt.Errorf("ApplyModelPlan %s CurrentSchemaIndexes error: %w", mp.Table, err)
+		}
+		readBackIndexes(mp.To, dbidxs, false)
+	}
+	if mp.To != nil && !mp.To.IsView && len(mp.To.Constraints) > 0 {
+		dbcons, err := CurrentSchemaConstraints(ctx, mp.Table)
+		if err != nil {
+			return fmt.Errorf("ApplyModelPlan %s CurrentSchemaConstraints error: %w", mp.Table, err)
+		}
+		readBackConstraints(mp.To, dbcons)
+	}
+
+	if err := (DbConfigTable{
+		TableName: mp.Table,
+		Storej:    mp.To,
+	}).SaveTable(ctx); err != nil {
+		return err
+	}
+
+	if err := sr.appendSchemaHistory(ctx, mp); err != nil {
+		return err
+	}
+
+	return sr.registerIndexBuilds(ctx, mp)
+}
+
+func (sr *PgStore) validatePrimaryKey(ctx context.Context, mp ModelPlan, st PatchStep) error {
+	pkErr := func(reason string) error {
+		ret := ErrorPrimaryKeyChange{
+			Schema: sr.Schema(),
+			Table:  mp.Table,
+			Reason: reason,
+		}
+		if mp.From != nil {
+			ret.From = mp.From.PrimaryKeyColumns()
+		}
+		if mp.To != nil {
+			ret.To = mp.To.PrimaryKeyColumns()
+		}
+		return ret
+	}
+
+	// внешние ключи других таблиц зависят от индекса первичного ключа, его нельзя удалить
+	var refs []string
+	if err := sr.tx.SelectContext(ctx, &refs, `SELECT r.relname || '.' || c.conname
+		FROM pg_constraint c
+		JOIN pg_index i ON i.indexrelid = c.conindid AND i.indisprimary
+		JOIN pg_class t ON t.oid = c.confrelid
+		JOIN pg_namespace ns ON ns.oid = t.relnamespace
+		JOIN pg_class r ON r.oid = c.conrelid
+		WHERE c.contype = 'f' AND ns.nspname = $1 AND t.relname = $2
+		ORDER BY 1`, sr.Schema(), mp.Table); err != nil {
+		return fmt.Errorf("ApplyModelPlan %s validate primary key error: %w", mp.Table, err)
+	}
+	if len(refs) > 0 {
+		return pkErr(fmt.Sprintf("it is referenced by foreign keys %s", strings.Join(refs, ", ")))
+	}
+
+	rows, err := sr.tx.QueryxContext(ctx, st.SQL)
+	if err != nil {
+		return fmt.Errorf("ApplyModelPlan %s validate primary key error: %w", mp.Table, err)
+	}
+	dup := rows.Next()
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ApplyModelPlan %s validate primary key error: %w", mp.Table, err)
+	}
+	if dup {
+		return pkErr("new primary key columns contain duplicate values")
+	}
+	return nil
+}
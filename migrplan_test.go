@@ -0,0 +1,427 @@
+package pgparty
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+func TestPlanSteps(t *testing.T) {
+	last := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "name", DataType: "VARCHAR(50)"},
+		},
+		Indexes: modelcols.SQLIndexes{
+			{Name: "nameidx", Columns: []string{"name"}},
+		},
+	}
+	to := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "name", DataType: "VARCHAR(100)", NotNull: true, DefaultValue: "''"},
+			{ColName: "qty", DataType: "BIGINT", NotNull: true, DefaultValue: "0"},
+		},
+	}
+	dbidxs := DBIndexDefs{
+		{Name: "itemsnameidx", Table: "items", Schema: "sh", Fields: StringArray{"name"}},
+	}
+
+	pt, err := SQLAlterTablePatch("sh", "items", last, to, nil, dbidxs, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := pt.Steps()
+
+	want := PatchSteps{
+		{Kind: StepDropIndex, SQL: "DROP INDEX sh.itemsnameidx", Index: "itemsnameidx"},
+		{Kind: StepUpdateNulls, SQL: "UPDATE sh.items SET name = '' WHERE name IS NULL"},
+		{Kind: StepAlterTable, SQL: "ALTER TABLE sh.items ALTER COLUMN name TYPE VARCHAR(100), " +
+			"ALTER COLUMN name SET NOT NULL, ALTER COLUMN name SET DEFAULT '', ADD COLUMN qty BIGINT NOT NULL DEFAULT 0",
+			TypeChange: TypeChangeSafe},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("steps count %d != %d: %v", len(steps), len(want), steps)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("step %d:\n%v\nwant:\n%v", i, steps[i], want[i])
+		}
+	}
+
+	fp1 := MigrationFingerprint(last, to, dbidxs, nil, nil)
+	fp2 := MigrationFingerprint(last, to, dbidxs, nil, nil)
+	if fp1 != fp2 {
+		t.Errorf("fingerprint is not stable: %s != %s", fp1, fp2)
+	}
+	if fp3 := MigrationFingerprint(last, to, nil, nil, nil); fp3 == fp1 {
+		t.Errorf("fingerprint must depend on db indexes")
+	}
+}
+
+func TestPlanRenameDropColumns(t *testing.T) {
+	last := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "name", DataType: "VARCHAR(50)"},
+			{ColName: "old", DataType: "BIGINT"},
+		},
+	}
+	to := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "title", DataType: "VARCHAR(50)", RenamedFrom: "name"},
+		},
+	}
+
+	for _, tc := range []struct {
+		policy ColumnDropPolicy
+		want   []string
+	}{
+		{ColumnDropNever, []string{
+			"ALTER TABLE sh.items RENAME COLUMN name TO title",
+		}},
+		{ColumnDrop, []string{
+			"ALTER TABLE sh.items RENAME COLUMN name TO title",
+			"ALTER TABLE sh.items DROP COLUMN old",
+		}},
+		{ColumnDropArchive, []string{
+			"ALTER TABLE sh.items RENAME COLUMN name TO title",
+			"DO $$DECLARE n text := 'items_old_archive'; v int := 1; " +
+				"BEGIN WHILE to_regclass('sh.' || quote_ident(n)) IS NOT NULL LOOP v := v + 1; n := 'items_old_archive_' || v; END LOOP; " +
+				"EXECUTE 'CREATE TABLE sh.' || quote_ident(n) || ' AS SELECT id, old FROM sh.items'; END$$",
+			"ALTER TABLE sh.items DROP COLUMN old",
+		}},
+	} {
+		pt, err := SQLAlterTablePatch("sh", "items", last, to, nil, nil, nil, MigrationOptions{DropColumns: tc.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		qs := pt.Queries()
+		if strings.Join(qs, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("policy %s:\n%s\nwant:\n%s", tc.policy, strings.Join(qs, "\n"), strings.Join(tc.want, "\n"))
+		}
+	}
+
+	// архив читает колонку ключа по новому имени, потому что выполняется после переименования
+	renamedPK := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "item_id", DataType: "UUID", NotNull: true, PrimaryKey: true, RenamedFrom: "id"},
+			{ColName: "title", DataType: "VARCHAR(50)", RenamedFrom: "name"},
+		},
+	}
+	pt, err := SQLAlterTablePatch("sh", "items", last, renamedPK, nil, nil, nil, MigrationOptions{DropColumns: ColumnDropArchive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive := pt.Steps().OfKind(StepArchiveColumn); len(archive) != 1 ||
+		!strings.Contains(archive[0].SQL, "SELECT item_id, old FROM sh.items") {
+		t.Errorf("archive must select the renamed key column: %v", archive)
+	}
+
+	// оставленная политикой колонка сохраняется в конфиге и удаляется, когда политика это разрешит
+	kept := *to
+	kept.Columns = append(modelcols.SQLColumns{}, to.Columns...)
+	retainDroppedColumns("sh", last, &kept, ColumnDropNever)
+	old, ok := kept.Columns.FindColumnByName("old")
+	if !ok || !old.Retained || len(kept.Columns) != 3 {
+		t.Fatalf("column is not retained: %v", kept.Columns)
+	}
+	next := *to
+	next.Columns = append(modelcols.SQLColumns{}, to.Columns...)
+	retainDroppedColumns("sh", &kept, &next, "")
+	if !kept.Equal(&next) {
+		t.Errorf("retained column must be kept by the next migration: %v", next.Columns)
+	}
+	pt, err = SQLAlterTablePatch("sh", "items", &kept, to, nil, nil, nil, MigrationOptions{DropColumns: ColumnDrop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qs := pt.Queries(); len(qs) != 1 || qs[0] != "ALTER TABLE sh.items DROP COLUMN old" {
+		t.Errorf("retained column is not dropped by the drop policy: %v", qs)
+	}
+}
+
+func TestPlanPrimaryKeyChange(t *testing.T) {
+	last := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "shop", DataType: "UUID", NotNull: true},
+		},
+	}
+	to := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "shop", DataType: "UUID", NotNull: true, PrimaryKey: true},
+		},
+	}
+	pt, err := SQLAlterTablePatch("sh", "items", last, to, nil, nil, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PatchSteps{
+		{Kind: StepValidatePrimaryKey, SQL: "SELECT id, shop FROM sh.items GROUP BY id, shop HAVING count(*) > 1 LIMIT 1"},
+		{Kind: StepDropConstraint, SQL: "ALTER TABLE sh.items DROP CONSTRAINT IF EXISTS items_pkey"},
+		{Kind: StepAddConstraint, SQL: "ALTER TABLE sh.items ADD PRIMARY KEY (id,shop)"},
+	}
+	steps := pt.Steps()
+	if len(steps) != len(want) {
+		t.Fatalf("steps count %d != %d: %v", len(steps), len(want), steps)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("step %d:\n%v\nwant:\n%v", i, steps[i], want[i])
+		}
+	}
+
+	// ключ создается в объявленном порядке, удаляется по имени из pg_constraint
+	to.PrimaryKey = []string{"shop", "id"}
+	dbcons := DBConstraintDefs{{Name: "old_items_pk", Type: "p", Def: "PRIMARY KEY (id)"}}
+	pt, err = SQLAlterTablePatch("sh", "items", last, to, nil, nil, dbcons, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := pt.Queries()
+	if len(q) != 3 || q[1] != "ALTER TABLE sh.items DROP CONSTRAINT IF EXISTS old_items_pk" ||
+		q[2] != "ALTER TABLE sh.items ADD PRIMARY KEY (shop,id)" {
+		t.Errorf("wrong declared order steps:\n%s", strings.Join(q, "\n"))
+	}
+
+	// проверка выполняется до переименования колонок, поэтому использует старые имена
+	renamedTo := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "shop_id", DataType: "UUID", NotNull: true, PrimaryKey: true, RenamedFrom: "shop"},
+		},
+	}
+	pt, err = SQLAlterTablePatch("sh", "items", last, renamedTo, nil, nil, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps := pt.Steps(); steps[0].Kind != StepValidatePrimaryKey ||
+		steps[0].SQL != "SELECT id, shop FROM sh.items GROUP BY id, shop HAVING count(*) > 1 LIMIT 1" {
+		t.Errorf("wrong validation of renamed key:\n%s", strings.Join(steps.Queries(), "\n"))
+	}
+
+	to.Columns[1].NotNull = false
+	_, err = SQLAlterTablePatch("sh", "items", last, to, nil, nil, nil, MigrationOptions{})
+	var pkerr ErrorPrimaryKeyChange
+	if !errors.As(err, &pkerr) {
+		t.Fatalf("expected ErrorPrimaryKeyChange, got %v", err)
+	}
+
+	// nullable тип колонки неизменного ключа не мешает другим изменениям
+	last.Columns[0].NotNull = false
+	nulto := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			last.Columns[0],
+			{ColName: "shop", DataType: "UUID"},
+		},
+	}
+	pt, err = SQLAlterTablePatch("sh", "items", last, nulto, nil, nil, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatalf("unchanged nullable primary key must not fail: %v", err)
+	}
+	if q := pt.Queries(); len(q) != 1 || q[0] != "ALTER TABLE sh.items ALTER COLUMN shop DROP NOT NULL" {
+		t.Errorf("wrong nullable steps:\n%s", strings.Join(q, "\n"))
+	}
+}
+
+func TestPlanConcurrentIndexes(t *testing.T) {
+	cols := modelcols.SQLColumns{
+		{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+		{ColName: "name", DataType: "VARCHAR(50)"},
+	}
+	idx := modelcols.SQLIndex{Name: "nameidx", Columns: []string{"name"}, Concurrently: true}
+	last := &modelcols.SQLModel{Table: "items", Columns: cols, Indexes: modelcols.SQLIndexes{idx}}
+	to := &modelcols.SQLModel{Table: "items", Columns: cols, Indexes: modelcols.SQLIndexes{idx}}
+
+	// индекс остался INVALID после неудачной сборки
+	dbidxs := DBIndexDefs{
+		{Name: "itemsnameidx", Table: "items", Schema: "sh", Fields: StringArray{"name"}, Method: "btree", Invalid: true},
+	}
+	if IndexesEqualToDBIndexes(to, dbidxs) {
+		t.Errorf("invalid index must not be equal")
+	}
+
+	pt, err := SQLAlterTablePatch("sh", "items", last, to, nil, dbidxs, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := pt.Steps()
+	if len(steps.Transactional()) != 0 {
+		t.Errorf("unexpected transactional steps: %v", steps.Transactional())
+	}
+	want := PatchSteps{
+		{Kind: StepDropIndex, SQL: "DROP INDEX CONCURRENTLY IF EXISTS sh.itemsnameidx", Index: "itemsnameidx", Concurrent: true},
+		{Kind: StepCreateIndex, SQL: "CREATE INDEX CONCURRENTLY itemsnameidx ON sh.items(name )", Index: "itemsnameidx", Concurrent: true},
+	}
+	conc := steps.Concurrent()
+	if len(conc) != len(want) {
+		t.Fatalf("wrong concurrent steps: %v", conc)
+	}
+	for i := range want {
+		if conc[i] != want[i] {
+			t.Errorf("step %d:\n%v\nwant:\n%v", i, conc[i], want[i])
+		}
+	}
+
+	// новая таблица - индекс строится в транзакции
+	ct := &PatchTable{Schema: "sh", Name: "items"}
+	SQLCreateTableWithColumns(ct, to)
+	if len(ct.Steps().Concurrent()) != 0 {
+		t.Errorf("new table indexes must be transactional")
+	}
+}
+
+func TestMigrationLockKey(t *testing.T) {
+	if MigrationLockKey("Shard1") != MigrationLockKey("shard1") {
+		t.Errorf("lock key must not depend on schema case")
+	}
+	if MigrationLockKey("shard1") == MigrationLockKey("shard2") {
+		t.Errorf("lock keys of different schemas must differ")
+	}
+	if MigrationLockKey("shard1") == concurrentLockKey("shard1") {
+		t.Errorf("migration and concurrent lock keys must differ")
+	}
+}
+
+func TestPlanComments(t *testing.T) {
+	last := &modelcols.SQLModel{
+		Table:   "items",
+		Comment: "Items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "name", DataType: "TEXT", Comment: "Name"},
+		},
+	}
+	to := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "name", DataType: "TEXT", Comment: "Item's name"},
+			{ColName: "qty", DataType: "BIGINT", Comment: "Quantity"},
+		},
+	}
+	if last.Equal(to) {
+		t.Fatal("models with different comments must not be equal")
+	}
+	pt, err := SQLAlterTablePatch("sh", "items", last, to, nil, nil, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ALTER TABLE sh.items ADD COLUMN qty BIGINT",
+		"COMMENT ON COLUMN sh.items.name IS 'Item''s name'",
+		"COMMENT ON COLUMN sh.items.qty IS 'Quantity'",
+		"COMMENT ON TABLE sh.items IS NULL",
+	}
+	if q := pt.Queries(); strings.Join(q, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong comment steps:\n%s", strings.Join(q, "\n"))
+	}
+
+	pv := &PatchView{Schema: "sh", Name: "totals"}
+	SQLCreateView(pv, &modelcols.SQLModel{Table: "totals", IsView: true, IsMaterialized: true,
+		ViewQuery: "SELECT 1 AS one", Comment: "Totals"})
+	if q := pv.Queries(); q[len(q)-1] != "COMMENT ON MATERIALIZED VIEW sh.totals IS 'Totals'" {
+		t.Errorf("wrong view comment steps: %q", q)
+	}
+
+	// изменились только комментарии - представление не пересоздается
+	lastv := &modelcols.SQLModel{Table: "totals", IsView: true, IsMaterialized: true, ViewQuery: "SELECT 1 AS one",
+		Columns: modelcols.SQLColumns{{ColName: "one", DataType: "BIGINT", Comment: "One"}}}
+	tov := &modelcols.SQLModel{Table: "totals", IsView: true, IsMaterialized: true, ViewQuery: "SELECT 1 AS one",
+		Columns: modelcols.SQLColumns{{ColName: "one", DataType: "BIGINT", Comment: "Just one"}}, Comment: "Totals"}
+	want = []string{
+		"COMMENT ON MATERIALIZED VIEW sh.totals IS 'Totals'",
+		"COMMENT ON COLUMN sh.totals.one IS 'Just one'",
+	}
+	if q := SQLAlterViewPatch("sh", "totals", lastv, tov, nil).Queries(); strings.Join(q, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong view comment only steps:\n%s", strings.Join(q, "\n"))
+	}
+	tov.ViewQuery = "SELECT 2 AS one"
+	if q := SQLAlterViewPatch("sh", "totals", lastv, tov, nil).Queries(); !strings.HasPrefix(q[0], "DROP MATERIALIZED VIEW") {
+		t.Errorf("changed view must be recreated: %q", q)
+	}
+}
+
+type GeneratedItem struct {
+	ID    BigSerial `json:"id" identity:"by default"`
+	Price Int64     `json:"price"`
+	Qty   Int64     `json:"qty"`
+	Total Int64     `json:"total" generated:":Price * :Qty"`
+}
+
+func (GeneratedItem) DatabaseName() string       { return "items" }
+func (GeneratedItem) TypeName() TypeName         { return StructModel[GeneratedItem]{}.TypeName() }
+func (GeneratedItem) Fields() []FieldDescription { return StructModel[GeneratedItem]{}.Fields() }
+
+func TestPlanGeneratedColumns(t *testing.T) {
+	shs, ctx := NewShards(context.Background())
+	sh := shs.SetShard("sh", nil, "sh")
+	if err := Register(sh, MD[GeneratedItem]{}); err != nil {
+		t.Fatal(err)
+	}
+	md := sh.Store.ModelDescriptions()[GeneratedItem{}.TypeName()]
+	for _, fn := range []string{"ID", "Total"} {
+		if fd, _ := md.ColumnByFieldName(fn); !fd.SkipReplace {
+			t.Errorf("%s must be skipped by Replace", fn)
+		}
+	}
+	to, err := sh.Store.MD2SQLModel(WithShard(ctx, sh), md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := &PatchTable{Schema: "sh", Name: "items"}
+	SQLCreateTableWithColumns(pt, to)
+	want := "CREATE TABLE sh.items (id BIGINT NOT NULL GENERATED BY DEFAULT AS IDENTITY," +
+		"price BIGINT NOT NULL DEFAULT 0,qty BIGINT NOT NULL DEFAULT 0," +
+		"total BIGINT NOT NULL GENERATED ALWAYS AS (price * qty) STORED,PRIMARY KEY (id))"
+	if q := pt.Queries(); q[0] != want {
+		t.Errorf("wrong create table:\n%s\nwant:\n%s", q[0], want)
+	}
+
+	last := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "BIGSERIAL", NotNull: true, PrimaryKey: true},
+			{ColName: "price", DataType: "BIGINT", NotNull: true, DefaultValue: "0"},
+			{ColName: "qty", DataType: "BIGINT", NotNull: true, DefaultValue: "0"},
+			{ColName: "total", DataType: "BIGINT", NotNull: true, Generated: "price + qty"},
+		},
+		Indexes: modelcols.SQLIndexes{
+			{Name: "totalidx", Columns: []string{"total"}},
+		},
+	}
+	to.Indexes = last.Indexes
+	dbidxs := ExpectedDBIndexes("sh", last)
+	pt, err = SQLAlterTablePatch("sh", "items", last, to, nil, dbidxs, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantq := []string{
+		"ALTER TABLE sh.items DROP COLUMN total",
+		"ALTER TABLE sh.items ALTER COLUMN id DROP DEFAULT, " +
+			"ADD COLUMN total BIGINT NOT NULL GENERATED ALWAYS AS (price * qty) STORED",
+		"DO $$DECLARE s text := pg_get_serial_sequence('sh.items', 'id'); " +
+			"BEGIN IF s IS NOT NULL THEN EXECUTE 'DROP SEQUENCE ' || s; END IF; END$$",
+		"ALTER TABLE sh.items ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY",
+		"SELECT setval(pg_get_serial_sequence('sh.items', 'id'), coalesce(max(id), 0) + 1, false) FROM sh.items",
+		"CREATE INDEX itemstotalidx ON sh.items(total )",
+	}
+	if q := pt.Queries(); strings.Join(q, "\n") != strings.Join(wantq, "\n") {
+		t.Errorf("wrong alter steps:\n%s", strings.Join(q, "\n"))
+	}
+}
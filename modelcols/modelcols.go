@@ -10,6 +10,14 @@ type SQLColumn struct {
 	DefaultValue string
 	NotNull      bool
 	PrimaryKey   bool
+	RenamedFrom  string `json:",omitempty"`
+	Using        string `json:",omitempty"` // USING expression of type change, not compared
+	UsingFrom    string `json:",omitempty"` // type the Using expression converts from, not compared
+	UsingTo      string `json:",omitempty"` // type the Using expression converts to, not compared
+	Comment      string `json:",omitempty"`
+	Identity     string `json:",omitempty"` // ALWAYS or BY DEFAULT
+	Generated    string `json:",omitempty"` // expression of stored generated column
+	Retained     bool   `json:",omitempty"` // gone from the model, but kept in the table by the drop policy
 }
 
 func (sqc SQLColumn) Equal(cto SQLColumn) bool {
@@ -17,7 +25,11 @@ func (sqc SQLColumn) Equal(cto SQLColumn) bool {
 		strings.EqualFold(sqc.DataType, cto.DataType) &&
 		sqc.DefaultValue == cto.DefaultValue &&
 		sqc.NotNull == cto.NotNull &&
-		sqc.PrimaryKey == cto.PrimaryKey
+		sqc.PrimaryKey == cto.PrimaryKey &&
+		sqc.Comment == cto.Comment &&
+		sqc.Identity == cto.Identity &&
+		sqc.Generated == cto.Generated &&
+		sqc.Retained == cto.Retained
 }
 
 type SQLColumns []SQLColumn
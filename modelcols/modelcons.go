@@ -0,0 +1,34 @@
+package modelcols
+
+import "strings"
+
+const (
+	ConstraintCheck  = "check"
+	ConstraintUnique = "unique"
+)
+
+type SQLConstraint struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Columns []string `json:"columns,omitempty"`
+	Expr    string   `json:"expr,omitempty"`
+	DBDef   string   `json:"dbdef,omitempty"` // pg_get_constraintdef after migration, not compared
+}
+
+type SQLConstraints []SQLConstraint
+
+func (cs SQLConstraints) FindByName(n string) (SQLConstraint, bool) {
+	for _, c := range cs {
+		if strings.EqualFold(c.Name, n) {
+			return c, true
+		}
+	}
+	return SQLConstraint{}, false
+}
+
+func (c SQLConstraint) Equal(to SQLConstraint) bool {
+	return strings.EqualFold(c.Name, to.Name) &&
+		strings.EqualFold(c.Type, to.Type) &&
+		OrderedColumnsEqual(c.Columns, to.Columns) &&
+		c.Expr == to.Expr
+}
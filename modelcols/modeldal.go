@@ -7,12 +7,19 @@ import (
 )
 
 type SQLModel struct {
-	Table          string     `json:"table"`
-	Columns        SQLColumns `json:"cols,omitempty"`
-	Indexes        SQLIndexes `json:"idxs,omitempty"`
-	ViewQuery      string     `json:"viewQuery,omitempty"`
-	IsView         bool       `json:"isView,omitempty"`
-	IsMaterialized bool       `json:"isMaterialized,omitempty"`
+	Table          string         `json:"table"`
+	Columns        SQLColumns     `json:"cols,omitempty"`
+	Indexes        SQLIndexes     `json:"idxs,omitempty"`
+	ForeignKeys    SQLForeignKeys `json:"fks,omitempty"`
+	Constraints    SQLConstraints `json:"cons,omitempty"`
+	Enums          SQLEnums       `json:"enums,omitempty"`
+	Comment        string         `json:"comment,omitempty"`
+	Partition      *SQLPartition  `json:"partition,omitempty"`
+	PrimaryKey     []string       `json:"pk,omitempty"` // primary key columns in declared order, not compared
+	ViewQuery      string         `json:"viewQuery,omitempty"`
+	IsView         bool           `json:"isView,omitempty"`
+	IsMaterialized bool           `json:"isMaterialized,omitempty"`
+	Unmanaged      []string       `json:"unmanaged,omitempty"` // indexes of the adopted table out of the model, not compared
 }
 
 func (f SQLModel) String() string {
@@ -49,13 +56,57 @@ func (m SQLModel) AllIndexLowerNames() map[string]SQLIndex {
 	return ret
 }
 
+// PrimaryKeyColumns returns primary key columns in declared order,
+// in order of columns if the model was stored without it
+func (m SQLModel) PrimaryKeyColumns() []string {
+	if len(m.PrimaryKey) > 0 {
+		return append([]string(nil), m.PrimaryKey...)
+	}
+	var ret []string
+	for _, v := range m.Columns {
+		if v.PrimaryKey {
+			ret = append(ret, v.ColName)
+		}
+	}
+	return ret
+}
+
+// IsUnmanagedIndex reports that the database index was left by adoption out of the model
+func (m SQLModel) IsUnmanagedIndex(name string) bool {
+	for _, n := range m.Unmanaged {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeepDBDefs copies definitions read back from the database for indexes and constraints that are not changed since from
+func (m *SQLModel) KeepDBDefs(from *SQLModel) {
+	m.Unmanaged = from.Unmanaged
+	for i, idx := range m.Indexes {
+		if fidx, ok := from.Indexes.FindByName(idx.Name); ok && fidx.Equal(idx) {
+			m.Indexes[i].DBDef = fidx.DBDef
+		}
+	}
+	for i, c := range m.Constraints {
+		if fc, ok := from.Constraints.FindByName(c.Name); ok && fc.Equal(c) {
+			m.Constraints[i].DBDef = fc.DBDef
+		}
+	}
+}
+
 func (from *SQLModel) Equal(to *SQLModel) bool {
 	if len(from.Columns) != len(to.Columns) ||
-		len(from.Indexes) != len(to.Indexes) {
+		len(from.Indexes) != len(to.Indexes) ||
+		len(from.ForeignKeys) != len(to.ForeignKeys) ||
+		len(from.Constraints) != len(to.Constraints) ||
+		len(from.Enums) != len(to.Enums) {
 		return false
 	}
 
-	res := strings.EqualFold(from.Table, to.Table)
+	res := strings.EqualFold(from.Table, to.Table) && from.Comment == to.Comment &&
+		from.Partition.Equal(to.Partition)
 	if !res {
 		return false
 	}
@@ -94,5 +145,26 @@ func (from *SQLModel) Equal(to *SQLModel) bool {
 		}
 	}
 
+	for _, v1 := range from.ForeignKeys {
+		v2, ok := to.ForeignKeys.FindByName(v1.Name)
+		if !ok || !v1.Equal(v2) {
+			return false
+		}
+	}
+
+	for _, v1 := range from.Constraints {
+		v2, ok := to.Constraints.FindByName(v1.Name)
+		if !ok || !v1.Equal(v2) {
+			return false
+		}
+	}
+
+	for _, v1 := range from.Enums {
+		v2, ok := to.Enums.FindByName(v1.Name)
+		if !ok || !v1.Equal(v2) {
+			return false
+		}
+	}
+
 	return res
 }
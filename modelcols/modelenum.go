@@ -0,0 +1,33 @@
+package modelcols
+
+import "strings"
+
+// SQLEnum is a postgres ENUM type used by model columns, values are in sort order
+type SQLEnum struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type SQLEnums []SQLEnum
+
+func (es SQLEnums) FindByName(n string) (SQLEnum, bool) {
+	for _, e := range es {
+		if strings.EqualFold(e.Name, n) {
+			return e, true
+		}
+	}
+	return SQLEnum{}, false
+}
+
+// Equal compares enum names and values, values are case sensitive
+func (e SQLEnum) Equal(to SQLEnum) bool {
+	if !strings.EqualFold(e.Name, to.Name) || len(e.Values) != len(to.Values) {
+		return false
+	}
+	for i := range e.Values {
+		if e.Values[i] != to.Values[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package modelcols
+
+import "strings"
+
+type SQLForeignKey struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	RefTable   string   `json:"refTable"`
+	RefColumns []string `json:"refColumns"`
+	OnDelete   string   `json:"onDelete,omitempty"`
+	OnUpdate   string   `json:"onUpdate,omitempty"`
+}
+
+type SQLForeignKeys []SQLForeignKey
+
+func (fks SQLForeignKeys) FindByName(n string) (SQLForeignKey, bool) {
+	for _, fk := range fks {
+		if strings.EqualFold(fk.Name, n) {
+			return fk, true
+		}
+	}
+	return SQLForeignKey{}, false
+}
+
+func (fk SQLForeignKey) Equal(to SQLForeignKey) bool {
+	return strings.EqualFold(fk.Name, to.Name) &&
+		OrderedColumnsEqual(fk.Columns, to.Columns) &&
+		strings.EqualFold(fk.RefTable, to.RefTable) &&
+		OrderedColumnsEqual(fk.RefColumns, to.RefColumns) &&
+		strings.EqualFold(fk.OnDelete, to.OnDelete) &&
+		strings.EqualFold(fk.OnUpdate, to.OnUpdate)
+}
+
+func OrderedColumnsEqual(cols1, cols2 []string) bool {
+	if len(cols1) != len(cols2) {
+		return false
+	}
+	for i := range cols1 {
+		if !strings.EqualFold(cols1[i], cols2[i]) {
+			return false
+		}
+	}
+	return true
+}
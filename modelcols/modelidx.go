@@ -7,10 +7,13 @@ type SQLIndex struct {
 	IsUnique     bool     `json:"isUnique,omitempty"`
 	MethodName   string   `json:"methodName,omitempty"`
 	Columns      []string `json:"columns"`
+	Expressions  []string `json:"exprs,omitempty"`   // lower(email)
+	Include      []string `json:"include,omitempty"` // INCLUDE columns
 	Options      string   `json:"options,omitempty"` // jsonb_path_ops или (title NULLS FIRST)
 	Concurrently bool     `json:"concurrently,omitempty"`
 	With         string   `json:"with,omitempty"`
 	Where        string   `json:"where,omitempty"`
+	DBDef        string   `json:"dbdef,omitempty"` // pg_get_indexdef after migration, not compared
 }
 
 type SQLIndexes []SQLIndex
@@ -28,7 +31,9 @@ func (idx SQLIndex) Equal(to SQLIndex) bool {
 	return strings.EqualFold(idx.Name, to.Name) &&
 		idx.IsUnique == to.IsUnique &&
 		strings.EqualFold(idx.MethodName, to.MethodName) &&
-		ColumnsEqual(idx.Columns, to.Columns) &&
+		OrderedColumnsEqual(idx.Columns, to.Columns) &&
+		OrderedColumnsEqual(idx.Expressions, to.Expressions) &&
+		ColumnsEqual(idx.Include, to.Include) &&
 		strings.EqualFold(idx.Options, to.Options) &&
 		idx.Concurrently == to.Concurrently &&
 		strings.EqualFold(idx.With, to.With) &&
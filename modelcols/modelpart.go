@@ -0,0 +1,25 @@
+package modelcols
+
+import "strings"
+
+// SQLPartition is PARTITION BY clause of the partitioned table, Columns are in partition key order
+type SQLPartition struct {
+	Method  string   `json:"method"` // RANGE, LIST, HASH
+	Columns []string `json:"cols"`
+}
+
+// Equal compares partitioning of tables, nil is a plain table
+func (p *SQLPartition) Equal(to *SQLPartition) bool {
+	if p == nil || to == nil {
+		return p == nil && to == nil
+	}
+	if !strings.EqualFold(p.Method, to.Method) || len(p.Columns) != len(to.Columns) {
+		return false
+	}
+	for i := range p.Columns {
+		if !strings.EqualFold(p.Columns[i], to.Columns[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -155,16 +155,55 @@ func (m *ModelObject) MarshalJSON() ([]byte, error) {
 
 	enc := json.NewEncoder(b)
 
-	b.WriteByte('{')
-	comma := false
-
+	pvs := make([]jsonPathValue, 0, len(m.vals))
 	for fdi, v := range m.vals {
 		fd := m.md.ColumnPtr(fdi)
 		if fd.JsonName == "" || fd.JsonSkip {
 			continue
 		}
+		path := []string{fd.JsonName}
+		if _, _, ok := fd.embedParent(); ok {
+			path = strings.Split(fd.JsonName, ".")
+		}
+		pvs = append(pvs, jsonPathValue{path: path, v: v, omitEmpty: fd.JsonOmitEmpty})
+	}
+	if err := writeJSONObject(b, enc, pvs); err != nil {
+		return nil, err
+	}
+	res := b.Bytes()
+
+	return res, nil
+}
+
+type jsonPathValue struct {
+	path      []string
+	v         interface{}
+	omitEmpty bool
+}
 
-		if fd.JsonOmitEmpty && reflect.ValueOf(v).IsZero() {
+// writeJSONObject writes values as a json object, values with long paths are written as nested objects,
+// a nested object with all nil values is written as null
+func writeJSONObject(b *bytes.Buffer, enc *json.Encoder, pvs []jsonPathValue) error {
+	b.WriteByte('{')
+	comma := false
+	done := make(map[string]bool)
+	for i, pv := range pvs {
+		k := pv.path[0]
+		if done[k] {
+			continue
+		}
+		done[k] = true
+
+		var nested []jsonPathValue
+		allnil := true
+		if len(pv.path) > 1 {
+			for _, npv := range pvs[i:] {
+				if npv.path[0] == k && len(npv.path) > 1 {
+					nested = append(nested, jsonPathValue{path: npv.path[1:], v: npv.v, omitEmpty: npv.omitEmpty})
+					allnil = allnil && npv.v == nil
+				}
+			}
+		} else if pv.omitEmpty && (pv.v == nil || reflect.ValueOf(pv.v).IsZero()) {
 			continue
 		}
 
@@ -172,20 +211,27 @@ func (m *ModelObject) MarshalJSON() ([]byte, error) {
 			b.WriteByte(',')
 		}
 		b.WriteByte('"')
-		b.WriteString(fd.JsonName)
+		b.WriteString(k)
 		b.WriteByte('"')
 		b.WriteByte(':')
 
-		if err := enc.Encode(v); err != nil {
-			return nil, fmt.Errorf("ModelObject enc.Encode error: %w", err)
+		switch {
+		case nested == nil:
+			if err := enc.Encode(pv.v); err != nil {
+				return fmt.Errorf("ModelObject enc.Encode error: %w", err)
+			}
+		case allnil:
+			b.WriteString("null")
+		default:
+			if err := writeJSONObject(b, enc, nested); err != nil {
+				return err
+			}
 		}
 
 		comma = true
 	}
 	b.WriteByte('}')
-	res := b.Bytes()
-
-	return res, nil
+	return nil
 }
 
 func (m *ModelObject) UnmarshalJSON(b []byte) error {
@@ -201,7 +247,17 @@ func (m *ModelObject) UnmarshalJSON(b []byte) error {
 
 	iter.ReadObjectCB(func(it *jsoniter.Iterator, k string) bool {
 		fd, err := m.md.ColumnByJsonName(k)
-		if (err != nil) || fd.JsonSkip {
+		if err != nil {
+			// поля вложенной структуры читаются из одного объекта
+			if _, leafs := m.md.embedColumnsByJsonName(k); len(leafs) > 0 {
+				m.unmarshalEmbed(it.SkipAndReturnBytes(), leafs)
+			} else {
+				it.Skip()
+			}
+			return true
+		}
+		if fd.JsonSkip {
+			it.Skip()
 			return true
 		}
 		tempv := reflect.New(fd.ElemType).Interface()
@@ -213,6 +269,29 @@ func (m *ModelObject) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+func (m *ModelObject) unmarshalEmbed(b []byte, fds []*FieldDescription) {
+	for _, fd := range fds {
+		m.vals[fd.Idx] = nil
+		raw := json.RawMessage(b)
+		for _, k := range strings.Split(fd.JsonName, ".")[1:] {
+			var obj map[string]json.RawMessage
+			if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(raw, &obj); err != nil {
+				raw = nil
+				break
+			}
+			raw = obj[k]
+		}
+		if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+			continue
+		}
+		tempv := reflect.New(fd.ElemType).Interface()
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(raw, tempv); err != nil {
+			continue
+		}
+		m.vals[fd.Idx] = reflect.Indirect(reflect.ValueOf(tempv)).Interface()
+	}
+}
+
 func (m *ModelObject) DBData() (cols []string, vals []any) {
 	ln := m.md.ColumnPtrsCount()
 	cols = make([]string, 0, ln)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/covrom/pgparty/utils"
 )
@@ -49,7 +50,12 @@ func (sr *PgStore) FieldByFD(modelItem Modeller, fd *FieldDescription) (any, err
 	if mv, ok := modelItem.(ModelValuer); ok {
 		return mv.FieldValue(fd)
 	}
-	fv, err := utils.GetFieldValueByName(reflect.Indirect(reflect.ValueOf(modelItem)), fd.FieldName)
+	rv := reflect.Indirect(reflect.ValueOf(modelItem))
+	if strings.Contains(fd.FieldName, ".") {
+		// поле вложенной структуры, значение модели не изменяем
+		return fd.readValue(reflect.ValueOf(rv.Interface())), nil
+	}
+	fv, err := utils.GetFieldValueByName(rv, fd.FieldName)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,301 @@
+package pgparty
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+)
+
+// OrphanPolicy defines what migration does with tables and views of the schema config
+// whose models are not registered anymore
+type OrphanPolicy string
+
+const (
+	OrphanWarn    OrphanPolicy = "warn"    // only report
+	OrphanArchive OrphanPolicy = "archive" // rename with archive suffix and forget
+	OrphanDrop    OrphanPolicy = "drop"    // drop after grace period since detection
+)
+
+type OrphanKind string
+
+const (
+	OrphanTable            OrphanKind = "table"
+	OrphanView             OrphanKind = "view"
+	OrphanMaterializedView OrphanKind = "materialized_view"
+)
+
+// Orphan is a table or view with its indexes left by a model that is not registered anymore
+type Orphan struct {
+	Name        string     `json:"name"`
+	Kind        OrphanKind `json:"kind"`
+	Indexes     []string   `json:"indexes,omitempty"`
+	Constraints []string   `json:"constraints,omitempty"` // primary key, unique and exclusion constraints with own indexes
+	Dependents  []string   `json:"dependents,omitempty"`  // views and tables with foreign keys that use the orphan, it is not dropped
+	DetectedAt  time.Time  `json:"detectedAt,omitempty"`  // zero until the first migration
+}
+
+func (s Shard) Orphans(ctx context.Context) ([]Orphan, error) {
+	return s.Store.Orphans(WithShard(ctx, s))
+}
+
+// Orphans reports tables and views of the schema config whose models are not registered
+func (sr *PgStore) Orphans(ctx context.Context) ([]Orphan, error) {
+	shard, err := ShardFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Orphans: %w", err)
+	}
+	var ret []Orphan
+	if err := sr.WithTx(ctx, func(stx *PgStore) error {
+		ret, err = stx.findOrphans(WithShard(ctx, Shard{shard.ID, stx}))
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("Orphans: %w", err)
+	}
+	return ret, nil
+}
+
+func (sr *PgStore) findOrphans(ctx context.Context) ([]Orphan, error) {
+	if sr.tx == nil {
+		return nil, ErrorNoTransaction{}
+	}
+	cfgExists, err := ConfigTableExists(ctx)
+	if err != nil || !cfgExists {
+		return nil, err
+	}
+
+	registered := make(map[string]bool, len(sr.ModelDescriptions()))
+	for _, md := range sr.ModelDescriptions() {
+		registered[strings.ToLower(md.DatabaseName())] = true
+	}
+
+	conf := NewDbConfig()
+	if err := conf.LoadAll(ctx, sr.tx, sr.Schema()); err != nil {
+		return nil, err
+	}
+
+	detected := make(map[string]time.Time)
+	ok := false
+	if err := sr.tx.GetContext(ctx, &ok, `SELECT to_regclass($1) IS NOT NULL`, sr.Schema()+"._orphans"); err != nil {
+		return nil, err
+	}
+	if ok {
+		var rows []struct {
+			Name       string    `db:"name"`
+			DetectedAt time.Time `db:"detected_at"`
+		}
+		if err := sr.tx.SelectContext(ctx, &rows, `SELECT name,detected_at FROM `+sr.Schema()+`._orphans`); err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			detected[strings.ToLower(r.Name)] = r.DetectedAt
+		}
+	}
+
+	var ret []Orphan
+	for _, c := range *conf {
+		if registered[strings.ToLower(c.TableName)] {
+			continue
+		}
+		o := Orphan{
+			Name:       c.TableName,
+			Kind:       OrphanTable,
+			DetectedAt: detected[strings.ToLower(c.TableName)],
+		}
+		if c.Storej != nil && c.Storej.IsView {
+			o.Kind = OrphanView
+			if c.Storej.IsMaterialized {
+				o.Kind = OrphanMaterializedView
+			}
+		}
+		rel := sr.Schema() + "." + strings.ToLower(c.TableName)
+		// индексы ограничений переименовываются и удаляются вместе с ограничениями
+		if err := sr.tx.SelectContext(ctx, &o.Indexes, `SELECT i.relname FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		WHERE x.indrelid = to_regclass($1)
+		AND NOT EXISTS (SELECT 1 FROM pg_constraint c
+			WHERE c.conrelid = x.indrelid AND c.conindid = x.indexrelid AND c.contype IN ('p', 'u', 'x'))
+		ORDER BY i.relname`, rel); err != nil {
+			return nil, err
+		}
+		if err := sr.tx.SelectContext(ctx, &o.Constraints, `SELECT conname FROM pg_constraint
+		WHERE conrelid = to_regclass($1) AND contype IN ('p', 'u', 'x')
+		ORDER BY conname`, rel); err != nil {
+			return nil, err
+		}
+		if err := sr.tx.SelectContext(ctx, &o.Dependents, `SELECT v.oid::regclass::text AS name FROM pg_depend d
+		JOIN pg_rewrite r ON r.oid = d.objid
+		JOIN pg_class v ON v.oid = r.ev_class
+		WHERE d.classid = 'pg_rewrite'::regclass AND d.refobjid = to_regclass($1) AND v.oid <> d.refobjid
+		UNION
+		SELECT conrelid::regclass::text AS name FROM pg_constraint
+		WHERE contype = 'f' AND confrelid = to_regclass($1) AND conrelid <> confrelid
+		ORDER BY name`, rel); err != nil {
+			return nil, err
+		}
+		ret = append(ret, o)
+	}
+	return ret, nil
+}
+
+// cleanupOrphans applies the orphan policy of migration options in the migration transaction,
+// detection time of orphans is recorded in <schema>._orphans table for the grace period
+func (sr *PgStore) cleanupOrphans(ctx context.Context, opts MigrationOptions) error {
+	cfgExists, err := ConfigTableExists(ctx)
+	if err != nil || !cfgExists {
+		return err
+	}
+	orphans, err := sr.findOrphans(ctx)
+	if err != nil {
+		return err
+	}
+	sn := sr.Schema()
+	if _, err := sr.tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+sn+`._orphans (
+		name VARCHAR(250) NOT NULL,
+		detected_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (name)
+	)`); err != nil {
+		return err
+	}
+
+	// модели снова зарегистрированы
+	names := make([]string, 0, len(orphans))
+	for _, o := range orphans {
+		names = append(names, o.Name)
+	}
+	if _, err := sr.tx.ExecContext(ctx, `DELETE FROM `+sn+`._orphans WHERE NOT (name = ANY($1))`, names); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, o := range orphans {
+		if o.DetectedAt.IsZero() {
+			o.DetectedAt = now
+			if _, err := sr.tx.ExecContext(ctx, `INSERT INTO `+sn+`._orphans (name,detected_at) VALUES($1,now())`,
+				o.Name); err != nil {
+				return err
+			}
+		}
+
+		switch opts.Orphans {
+		case OrphanArchive:
+			if err := sr.archiveOrphan(ctx, o, now); err != nil {
+				return err
+			}
+		case OrphanDrop:
+			if now.Sub(o.DetectedAt) < opts.OrphanGracePeriod {
+				log.Printf("orphaned %s %s.%s will be dropped after %s", o.Kind, sn, o.Name,
+					o.DetectedAt.Add(opts.OrphanGracePeriod).Format(time.RFC3339))
+				continue
+			}
+			// без CASCADE удаление упадет, а с CASCADE удалит чужие объекты - только сообщаем
+			if len(o.Dependents) > 0 {
+				log.Printf("orphaned %s %s.%s is not dropped, it is used by %s", o.Kind, sn, o.Name,
+					strings.Join(o.Dependents, ", "))
+				continue
+			}
+			if err := sr.dropOrphan(ctx, o); err != nil {
+				return err
+			}
+		default:
+			log.Printf("orphaned %s %s.%s (indexes: %s) is not registered as a model since %s",
+				o.Kind, sn, o.Name, strings.Join(o.Indexes, ", "), o.DetectedAt.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+func orphanRelation(k OrphanKind) string {
+	switch k {
+	case OrphanView:
+		return "VIEW"
+	case OrphanMaterializedView:
+		return "MATERIALIZED VIEW"
+	}
+	return "TABLE"
+}
+
+func (sr *PgStore) forgetOrphan(ctx context.Context, o Orphan) error {
+	if _, err := sr.tx.ExecContext(ctx, `DELETE FROM `+sr.Schema()+`._config WHERE table_name = $1`, o.Name); err != nil {
+		return err
+	}
+	_, err := sr.tx.ExecContext(ctx, `DELETE FROM `+sr.Schema()+`._orphans WHERE name = $1`, o.Name)
+	return err
+}
+
+func (sr *PgStore) archiveOrphan(ctx context.Context, o Orphan, now time.Time) error {
+	sfx, err := sr.archiveSuffix(ctx, o, now)
+	if err != nil {
+		return fmt.Errorf("archive orphaned %s %s: %w", o.Kind, o.Name, err)
+	}
+	arch := archiveName(o.Name, sfx)
+	qs := make([]string, 0, len(o.Indexes)+len(o.Constraints)+1)
+	qs = append(qs, fmt.Sprintf("ALTER %s IF EXISTS %s.%s RENAME TO %s", orphanRelation(o.Kind), sr.Schema(), o.Name, arch))
+	// индексы и ограничения с индексами тоже переименовываем, чтобы не мешали новой модели с тем же именем
+	for _, idx := range o.Indexes {
+		qs = append(qs, fmt.Sprintf("ALTER INDEX IF EXISTS %s.%s RENAME TO %s", sr.Schema(), idx, archiveName(idx, sfx)))
+	}
+	for _, c := range o.Constraints {
+		qs = append(qs, fmt.Sprintf("ALTER TABLE IF EXISTS %s.%s RENAME CONSTRAINT %s TO %s", sr.Schema(), arch, c, archiveName(c, sfx)))
+	}
+	for _, q := range qs {
+		log.Println(q)
+		if _, err := sr.tx.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("archive orphaned %s %s: %w", o.Kind, o.Name, err)
+		}
+	}
+	return sr.forgetOrphan(ctx, o)
+}
+
+// archiveSuffix returns `_archive_<date>` suffix, with `_2`, `_3` and so on
+// when archived names of the same day are already taken in the schema
+func (sr *PgStore) archiveSuffix(ctx context.Context, o Orphan, now time.Time) (string, error) {
+	base := "_archive_" + now.Format("20060102")
+	names := append(append([]string{o.Name}, o.Indexes...), o.Constraints...)
+	for n := 1; ; n++ {
+		sfx := base
+		if n > 1 {
+			sfx = fmt.Sprintf("%s_%d", base, n)
+		}
+		taken := false
+		// ограничения из списка имеют индексы, их имена тоже занимают место среди отношений схемы
+		for _, name := range names {
+			if err := sr.tx.GetContext(ctx, &taken, `SELECT to_regclass($1) IS NOT NULL`,
+				sr.Schema()+"."+archiveName(name, sfx)); err != nil {
+				return "", err
+			}
+			if taken {
+				break
+			}
+		}
+		if !taken {
+			return sfx, nil
+		}
+	}
+}
+
+// maxIdentLen is the postgres identifier length limit (NAMEDATALEN - 1), longer names are truncated
+const maxIdentLen = 63
+
+// archiveName appends the suffix to the name, a name that would not fit in an identifier
+// is cut and marked with a hash of the full name to keep cut names distinct
+func archiveName(name, sfx string) string {
+	if len(name)+len(sfx) <= maxIdentLen {
+		return name + sfx
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	hs := fmt.Sprintf("_%08x", h.Sum32())
+	return name[:maxIdentLen-len(sfx)-len(hs)] + hs + sfx
+}
+
+func (sr *PgStore) dropOrphan(ctx context.Context, o Orphan) error {
+	q := fmt.Sprintf("DROP %s IF EXISTS %s.%s", orphanRelation(o.Kind), sr.Schema(), o.Name)
+	log.Println(q)
+	if _, err := sr.tx.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("drop orphaned %s %s: %w", o.Kind, o.Name, err)
+	}
+	return sr.forgetOrphan(ctx, o)
+}
@@ -0,0 +1,26 @@
+package pgparty
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArchiveName(t *testing.T) {
+	sfx := "_archive_20240102_2"
+	if n := archiveName("items", sfx); n != "items_archive_20240102_2" {
+		t.Errorf("wrong archive name %s", n)
+	}
+
+	long1 := strings.Repeat("a", 50) + "_first_idx"
+	long2 := strings.Repeat("a", 50) + "_second_idx"
+	n1, n2 := archiveName(long1, sfx), archiveName(long2, sfx)
+	if len(n1) != maxIdentLen || len(n2) != maxIdentLen {
+		t.Errorf("archive names must be cut to %d bytes: %s, %s", maxIdentLen, n1, n2)
+	}
+	if n1 == n2 {
+		t.Errorf("cut archive names must differ: %s", n1)
+	}
+	if !strings.HasSuffix(n1, sfx) || !strings.HasPrefix(n1, strings.Repeat("a", 30)) {
+		t.Errorf("wrong cut archive name %s", n1)
+	}
+}
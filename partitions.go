@@ -0,0 +1,311 @@
+package pgparty
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+type PartitionMethod string
+
+const (
+	PartitionRange PartitionMethod = "RANGE"
+	PartitionList  PartitionMethod = "LIST"
+	PartitionHash  PartitionMethod = "HASH"
+)
+
+// Partition2SQL builds PARTITION BY clause of the model, partition key columns must be in the primary key
+func Partition2SQL(md *ModelDesc, cols modelcols.SQLColumns) (*modelcols.SQLPartition, error) {
+	mp := md.Partitioning()
+	method := PartitionMethod(strings.ToUpper(string(mp.Method)))
+	switch method {
+	case PartitionRange, PartitionList, PartitionHash:
+	default:
+		return nil, fmt.Errorf("unknown partition method %q", mp.Method)
+	}
+	if len(mp.Fields) == 0 {
+		return nil, fmt.Errorf("partition key has no fields")
+	}
+	ret := &modelcols.SQLPartition{Method: string(method)}
+	for _, fn := range mp.Fields {
+		fd, err := md.ColumnByFieldName(fn)
+		if err != nil {
+			return nil, err
+		}
+		ret.Columns = append(ret.Columns, fd.DatabaseName)
+	}
+	// первичный ключ секционированной таблицы должен содержать ключ секционирования
+	var pks []string
+	for _, c := range cols {
+		if c.PrimaryKey {
+			pks = append(pks, c.ColName)
+		}
+	}
+	for _, c := range ret.Columns {
+		if len(pks) > 0 && !containsFold(pks, c) {
+			return nil, fmt.Errorf("primary key must include partition key column %s", c)
+		}
+	}
+	return ret, nil
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, v := range ss {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentSchemaPartition returns PARTITION BY of the partitioned table of the store schema,
+// expression keys are not supported
+func CurrentSchemaPartition(ctx context.Context, table string) (*modelcols.SQLPartition, error) {
+	s, err := ShardFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("CurrentSchemaPartition: %w", err)
+	}
+	stx := s.Store
+	if stx == nil || stx.tx == nil {
+		return nil, fmt.Errorf("context must contains store transaction")
+	}
+	var row struct {
+		Strategy string      `db:"partstrat"`
+		Columns  StringArray `db:"cols"`
+	}
+	if err := stx.tx.GetContext(ctx, &row, `SELECT pt.partstrat::text AS partstrat,
+	to_jsonb(array_agg(a.attname::text ORDER BY k.ord)) AS cols
+	FROM pg_partitioned_table pt
+	JOIN pg_class c ON c.oid = pt.partrelid
+	JOIN pg_namespace ns ON ns.oid = c.relnamespace
+	CROSS JOIN LATERAL unnest(pt.partattrs::int2[]) WITH ORDINALITY AS k(attnum, ord)
+	JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = k.attnum
+	WHERE ns.nspname = $1 AND c.relname = $2
+	GROUP BY pt.partstrat`, stx.Schema(), table); err != nil {
+		return nil, err
+	}
+	ret := &modelcols.SQLPartition{Columns: row.Columns}
+	switch row.Strategy {
+	case "r":
+		ret.Method = string(PartitionRange)
+	case "l":
+		ret.Method = string(PartitionList)
+	case "h":
+		ret.Method = string(PartitionHash)
+	default:
+		return nil, fmt.Errorf("unknown partition strategy %q of %s.%s", row.Strategy, stx.Schema(), table)
+	}
+	return ret, nil
+}
+
+type PartitionInterval string
+
+const (
+	PartitionDaily   PartitionInterval = "day"
+	PartitionMonthly PartitionInterval = "month"
+	PartitionYearly  PartitionInterval = "year"
+)
+
+// layout of the partition name suffix
+func (i PartitionInterval) layout() string {
+	switch i {
+	case PartitionDaily:
+		return "20060102"
+	case PartitionYearly:
+		return "2006"
+	}
+	return "200601"
+}
+
+// start returns the beginning of the interval that contains t in UTC
+func (i PartitionInterval) start(t time.Time) time.Time {
+	t = t.UTC()
+	switch i {
+	case PartitionDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case PartitionYearly:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// add shifts the beginning of the interval by n intervals
+func (i PartitionInterval) add(t time.Time, n int) time.Time {
+	switch i {
+	case PartitionDaily:
+		return t.AddDate(0, 0, n)
+	case PartitionYearly:
+		return t.AddDate(n, 0, 0)
+	}
+	return t.AddDate(0, n, 0)
+}
+
+// PartitionOptions controls maintenance of range partitions by time column
+type PartitionOptions struct {
+	// Interval of one partition, month by default
+	Interval PartitionInterval
+	// Premake is a count of future partitions created ahead of the current one
+	Premake int
+	// Retention is a count of past partitions kept before the current one, older partitions are expired,
+	// zero keeps all partitions
+	Retention int
+	// DropExpired drops expired partitions, otherwise they are only detached and left in the schema
+	DropExpired bool
+	// Now is the current time, time.Now() when zero
+	Now time.Time
+}
+
+// RangePartition is a partition of the table for values from From inclusive to To exclusive
+type RangePartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// RangePartitions returns the current partition and Premake future partitions of the table,
+// partitions are named as <table>_p<start>, e.g. events_p202401 for monthly interval
+func RangePartitions(table string, opts PartitionOptions) []RangePartition {
+	iv := opts.interval()
+	from := iv.start(opts.now())
+	ret := make([]RangePartition, 0, opts.Premake+1)
+	for i := 0; i <= opts.Premake; i++ {
+		to := iv.add(from, 1)
+		ret = append(ret, RangePartition{
+			Name: strings.ToLower(table) + "_p" + from.Format(iv.layout()),
+			From: from,
+			To:   to,
+		})
+		from = to
+	}
+	return ret
+}
+
+// ExpiredPartitions returns partitions named by RangePartitions that end before the retention period,
+// partitions with other names are not touched
+func ExpiredPartitions(table string, partitions []string, opts PartitionOptions) []string {
+	if opts.Retention <= 0 {
+		return nil
+	}
+	iv := opts.interval()
+	cutoff := iv.add(iv.start(opts.now()), -opts.Retention)
+	prefix := strings.ToLower(table) + "_p"
+	var ret []string
+	for _, p := range partitions {
+		if !strings.HasPrefix(p, prefix) || len(p)-len(prefix) != len(iv.layout()) {
+			continue
+		}
+		from, err := time.ParseInLocation(iv.layout(), p[len(prefix):], time.UTC)
+		if err != nil {
+			continue
+		}
+		if !iv.add(from, 1).After(cutoff) {
+			ret = append(ret, p)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (o PartitionOptions) interval() PartitionInterval {
+	if len(o.Interval) == 0 {
+		return PartitionMonthly
+	}
+	return o.Interval
+}
+
+func (o PartitionOptions) now() time.Time {
+	if o.Now.IsZero() {
+		return time.Now()
+	}
+	return o.Now
+}
+
+// PartitionReport lists partitions changed by MaintainPartitions
+type PartitionReport struct {
+	Created  []string `json:"created,omitempty"`
+	Detached []string `json:"detached,omitempty"`
+	Dropped  []string `json:"dropped,omitempty"`
+}
+
+func MaintainPartitions[T Modeller](ctx context.Context, opts PartitionOptions) (*PartitionReport, error) {
+	s, err := ShardFromContext(ctx)
+	if err != nil {
+		_, file, no, ok := runtime.Caller(1)
+		if ok {
+			log.Printf("MaintainPartitions error at %s line %d: %s", file, no, err)
+		}
+		return nil, fmt.Errorf("MaintainPartitions: %w", err)
+	}
+	md, ok := s.Store.GetModelDescription(*new(T))
+	if !ok {
+		return nil, fmt.Errorf("MaintainPartitions error: can't get model description for %T in schema %q", *new(T), s.Store.Schema())
+	}
+	return s.Store.MaintainPartitions(ctx, md, opts)
+}
+
+// MaintainPartitions creates the current and future range partitions of the model table
+// and detaches (and drops with DropExpired) partitions older than the retention period.
+// The model must be partitioned by RANGE on one time column.
+func (sr *PgStore) MaintainPartitions(ctx context.Context, md *ModelDesc, opts PartitionOptions) (*PartitionReport, error) {
+	mp := md.Partitioning()
+	if !strings.EqualFold(string(mp.Method), string(PartitionRange)) || len(mp.Fields) != 1 {
+		return nil, fmt.Errorf("MaintainPartitions: %s must be partitioned by range of one column", md.TypeName())
+	}
+	ret := &PartitionReport{}
+	if err := sr.WithTx(ctx, func(stx *PgStore) error {
+		sn, tn := stx.Schema(), md.DatabaseName()
+		var existing []string
+		if err := stx.tx.SelectContext(ctx, &existing, `SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace ns ON ns.oid = p.relnamespace
+		WHERE ns.nspname = $1 AND p.relname = $2`, sn, tn); err != nil {
+			return err
+		}
+		exists := make(map[string]bool, len(existing))
+		for _, p := range existing {
+			exists[p] = true
+		}
+
+		var qs []string
+		for _, p := range RangePartitions(tn, opts) {
+			if exists[p.Name] {
+				continue
+			}
+			qs = append(qs, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s.%s PARTITION OF %s.%s FOR VALUES FROM (%s) TO (%s)",
+				sn, p.Name, sn, tn, partitionBound(p.From), partitionBound(p.To)))
+			ret.Created = append(ret.Created, p.Name)
+		}
+		for _, p := range ExpiredPartitions(tn, existing, opts) {
+			qs = append(qs, fmt.Sprintf("ALTER TABLE %s.%s DETACH PARTITION %s.%s", sn, tn, sn, p))
+			ret.Detached = append(ret.Detached, p)
+			if opts.DropExpired {
+				qs = append(qs, fmt.Sprintf("DROP TABLE %s.%s", sn, p))
+				ret.Dropped = append(ret.Dropped, p)
+			}
+		}
+
+		for _, q := range qs {
+			if IsLoggingQuery(ctx) {
+				log.Println(q)
+			}
+			if _, err := stx.tx.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("MaintainPartitions %s: %w", md.DatabaseName(), err)
+	}
+	return ret, nil
+}
+
+func partitionBound(t time.Time) string {
+	return quoteSQLString(t.Format("2006-01-02 15:04:05-07"))
+}
@@ -0,0 +1,84 @@
+package pgparty
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type PartEvent struct {
+	ID        UUIDv4 `json:"id"`
+	CreatedAt Time   `json:"createdAt" pk:"" key:"kindidx concurrently"`
+	Kind      String `json:"kind"`
+}
+
+func (PartEvent) DatabaseName() string       { return "events" }
+func (PartEvent) TypeName() TypeName         { return StructModel[PartEvent]{}.TypeName() }
+func (PartEvent) Fields() []FieldDescription { return StructModel[PartEvent]{}.Fields() }
+func (PartEvent) Partitioning() ModelPartitioning {
+	return ModelPartitioning{Method: PartitionRange, Fields: []string{"CreatedAt"}}
+}
+
+func TestPartitionedModel(t *testing.T) {
+	shs, ctx := NewShards(context.Background())
+	sh := shs.SetShard("sh", nil, "sh")
+	if err := Register(sh, MD[PartEvent]{}); err != nil {
+		t.Fatal(err)
+	}
+	md := sh.Store.ModelDescriptions()[PartEvent{}.TypeName()]
+	m, err := sh.Store.MD2SQLModel(WithShard(ctx, sh), md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Partition == nil || m.Partition.Method != "RANGE" || strings.Join(m.Partition.Columns, ",") != "created_at" {
+		t.Fatalf("wrong partitioning: %+v", m.Partition)
+	}
+	for _, idx := range m.Indexes {
+		if idx.Concurrently {
+			t.Errorf("index %s of partitioned table can't be built concurrently", idx.Name)
+		}
+	}
+
+	pt := &PatchTable{Schema: "sh", Name: "events"}
+	SQLCreateTableWithColumns(pt, m)
+	q := pt.Queries()
+	if !strings.HasSuffix(q[0], "PRIMARY KEY (id,created_at)) PARTITION BY RANGE (created_at)") {
+		t.Errorf("wrong create table: %s", q[0])
+	}
+
+	last := *m
+	last.Partition = nil
+	if _, err := SQLAlterTablePatch("sh", "events", &last, m, nil, nil, nil, MigrationOptions{}); err == nil {
+		t.Error("partitioning change must be refused")
+	}
+}
+
+func TestRangePartitions(t *testing.T) {
+	opts := PartitionOptions{
+		Premake:   2,
+		Retention: 3,
+		Now:       time.Date(2024, 12, 15, 10, 0, 0, 0, time.UTC),
+	}
+	var names []string
+	for _, p := range RangePartitions("events", opts) {
+		names = append(names, p.Name)
+	}
+	if got := strings.Join(names, " "); got != "events_p202412 events_p202501 events_p202502" {
+		t.Errorf("wrong partitions: %s", got)
+	}
+	if b := partitionBound(RangePartitions("events", opts)[0].To); b != "'2025-01-01 00:00:00+00'" {
+		t.Errorf("wrong partition bound: %s", b)
+	}
+
+	existing := []string{"events_p202407", "events_p202408", "events_p202409", "events_p202410", "events_default", "events_p2024"}
+	if got := strings.Join(ExpiredPartitions("events", existing, opts), " "); got != "events_p202407 events_p202408" {
+		t.Errorf("wrong expired partitions: %s", got)
+	}
+
+	opts.Interval = PartitionDaily
+	opts.Premake = 0
+	if p := RangePartitions("events", opts); len(p) != 1 || p[0].Name != "events_p20241215" {
+		t.Errorf("wrong daily partitions: %+v", p)
+	}
+}
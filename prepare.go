@@ -8,6 +8,7 @@ import (
 	"log"
 	"reflect"
 	"runtime"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jmoiron/sqlx"
@@ -33,6 +34,26 @@ func (sr *PgStore) PrepareQuery(ctx context.Context, query string) (string, erro
 	return res, nil
 }
 
+// PrepareModelExpr replaces :Field names of the model with its column names and prepares the expression,
+// it is used for expressions of the model table, e.g. in CHECK constraints and generated columns
+func (sr *PgStore) PrepareModelExpr(ctx context.Context, md *ModelDesc, expr string) (string, error) {
+	_, rpls, err := md.ReplaceEntries(sr.Schema())
+	if err != nil {
+		return "", err
+	}
+	sb := &strings.Builder{}
+	for _, qp := range scanParamsAndQueries(expr) {
+		if len(qp.param) > 0 && qp.param[0] == ':' {
+			if to, ok := rpls[qp.param]; ok {
+				sb.WriteString(strings.ReplaceAll(qp.query, qp.param, string(to)))
+				continue
+			}
+		}
+		sb.WriteString(qp.query)
+	}
+	return sr.PrepareQuery(ctx, sb.String())
+}
+
 func Get[T any](ctx context.Context, query string, dest *T, args ...interface{}) error {
 	s, err := ShardFromContext(ctx)
 	if err != nil {
@@ -0,0 +1,199 @@
+package pgparty
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/covrom/pgparty/modelcols"
+	"github.com/jmoiron/sqlx"
+)
+
+// SchemaHistoryEntry is a row of <schema>._config_history table appended by every applied model migration
+type SchemaHistoryEntry struct {
+	Version        int64               `db:"version"`
+	Table          string              `db:"table_name"`
+	Prev           *modelcols.SQLModel `db:"prev_storej"` // empty for a new table
+	Storej         *modelcols.SQLModel `db:"storej"`
+	DDL            string              `db:"ddl"`
+	AppliedAt      time.Time           `db:"applied_at"`
+	ServiceVersion string              `db:"service_version"`
+}
+
+func ensureSchemaHistoryTable(ctx context.Context, ex sqlx.ExecerContext, schema string) error {
+	_, err := ex.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+schema+`._config_history (
+		version BIGSERIAL NOT NULL,
+		table_name VARCHAR(250) NOT NULL,
+		prev_storej JSONB NULL,
+		storej JSONB NOT NULL,
+		ddl TEXT NOT NULL DEFAULT '',
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		service_version VARCHAR(250) NOT NULL DEFAULT '',
+		PRIMARY KEY (version)
+	)`)
+	return err
+}
+
+// appendSchemaHistory records the applied plan of the model in the migration transaction
+func (sr *PgStore) appendSchemaHistory(ctx context.Context, mp ModelPlan) error {
+	var prev interface{}
+	if mp.From != nil {
+		prev = mp.From
+	}
+	_, err := sr.tx.ExecContext(ctx, `INSERT INTO `+sr.Schema()+`._config_history
+	(table_name,prev_storej,storej,ddl,applied_at,service_version) VALUES($1,$2,$3,$4,now(),$5)`,
+		mp.Table, prev, mp.To, strings.Join(mp.Steps.Queries(), ";\n"), MigrationOptionsFromContext(ctx).ServiceVersion)
+	return err
+}
+
+func (s Shard) SchemaHistory(ctx context.Context, table string) ([]SchemaHistoryEntry, error) {
+	return s.Store.SchemaHistory(WithShard(ctx, s), table)
+}
+
+// SchemaHistory returns applied migrations of the table from the oldest to the latest
+func (sr *PgStore) SchemaHistory(ctx context.Context, table string) ([]SchemaHistoryEntry, error) {
+	var ret []SchemaHistoryEntry
+	if err := sr.WithTx(ctx, func(stx *PgStore) error {
+		ok := false
+		if err := stx.tx.GetContext(ctx, &ok, `SELECT to_regclass($1) IS NOT NULL`, stx.Schema()+"._config_history"); err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		return stx.tx.SelectContext(ctx, &ret, `SELECT version,table_name,prev_storej,storej,ddl,applied_at,service_version
+		FROM `+stx.Schema()+`._config_history WHERE table_name = $1 ORDER BY version`, table)
+	}); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("SchemaHistory: %w", err)
+	}
+	return ret, nil
+}
+
+func (s Shard) RollbackModel(ctx context.Context, table string, version int64) error {
+	return s.Store.RollbackModel(WithShard(ctx, s), table, version)
+}
+
+// RollbackModel returns the table to the model recorded by the schema history version:
+// the reverse diff between the current model config and that model is applied as a new migration.
+// Columns absent in that model are handled by the drop policy of migration options.
+func (sr *PgStore) RollbackModel(ctx context.Context, table string, version int64) error {
+	shard, err := ShardFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("RollbackModel: %w", err)
+	}
+	opts := MigrationOptionsFromContext(ctx)
+	var mp ModelPlan
+	if err := sr.WithTx(ctx, func(stx *PgStore) error {
+		ctxTx := WithShard(ctx, Shard{shard.ID, stx})
+		if _, err := stx.lockMigration(ctxTx, opts.LockTimeout); err != nil {
+			return err
+		}
+
+		h := SchemaHistoryEntry{}
+		if err := stx.tx.GetContext(ctxTx, &h, `SELECT version,table_name,prev_storej,storej,ddl,applied_at,service_version
+		FROM `+stx.Schema()+`._config_history WHERE table_name = $1 AND version = $2`, table, version); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("version %d is not found in schema history", version)
+			}
+			return err
+		}
+
+		dbconf := &DbConfigTable{}
+		if err := dbconf.LoadTable(ctxTx, table); err != nil {
+			return err
+		}
+		if dbconf.IsEmpty() {
+			return fmt.Errorf("model config is not found")
+		}
+
+		mp, err = stx.planRollback(ctxTx, table, dbconf.Storej, h.Storej)
+		if err != nil {
+			return err
+		}
+		if len(mp.Steps) == 0 && mp.From.Equal(mp.To) {
+			return nil
+		}
+		if len(mp.Steps.Concurrent()) > 0 && sr.tx != nil {
+			return fmt.Errorf("concurrent index steps can't be applied inside a transaction")
+		}
+		return stx.execModelPlan(ctxTx, mp)
+	}); err != nil {
+		return fmt.Errorf("RollbackModel %s: %w", table, err)
+	}
+
+	if len(mp.Steps.Concurrent()) > 0 {
+		unlock, err := sr.lockConcurrent(ctx, opts.LockTimeout)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := sr.ApplyConcurrentSteps(ctx, mp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sr *PgStore) planRollback(ctx context.Context, table string, from, to *modelcols.SQLModel) (ModelPlan, error) {
+	to = reverseRenames(from, to)
+	ret := ModelPlan{
+		Table:  table,
+		Action: MigrationActionAlter,
+		From:   from,
+		To:     to,
+	}
+	for _, md := range sr.ModelDescriptions() {
+		if md.DatabaseName() == table {
+			ret.Model = md.TypeName()
+			break
+		}
+	}
+
+	dbidxs, err := CurrentSchemaIndexes(ctx, table)
+	if err != nil {
+		return ret, err
+	}
+	if to.IsView {
+		ret.Steps = SQLAlterViewPatch(sr.Schema(), table, from, to, dbidxs).Steps()
+		return ret, nil
+	}
+	colinfos, err := DBColumnsInfo(ctx, sr.tx, sr.Schema(), table)
+	if err != nil {
+		return ret, err
+	}
+	dbcons, err := CurrentSchemaConstraints(ctx, table)
+	if err != nil {
+		return ret, err
+	}
+	opts := MigrationOptionsFromContext(ctx)
+	retainDroppedColumns(sr.Schema(), from, to, opts.DropColumns)
+	pt, err := SQLAlterTablePatch(sr.Schema(), table, from, to, colinfos, dbidxs, dbcons, opts)
+	if err != nil {
+		return ret, err
+	}
+	ret.Steps = pt.Steps()
+	return ret, nil
+}
+
+// reverseRenames marks columns of the target model that must be renamed back from the current model
+func reverseRenames(from, to *modelcols.SQLModel) *modelcols.SQLModel {
+	ret := *to
+	ret.Columns = make(modelcols.SQLColumns, len(to.Columns))
+	copy(ret.Columns, to.Columns)
+	for _, c := range from.Columns {
+		if len(c.RenamedFrom) == 0 {
+			continue
+		}
+		if _, ok := to.Columns.FindColumnByName(c.ColName); ok {
+			continue
+		}
+		for i := range ret.Columns {
+			if strings.EqualFold(ret.Columns[i].ColName, c.RenamedFrom) {
+				ret.Columns[i].RenamedFrom = c.ColName
+			}
+		}
+	}
+	return &ret
+}
@@ -0,0 +1,39 @@
+package pgparty
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+func TestRollbackRenamedColumn(t *testing.T) {
+	// версия до переименования
+	prev := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "title", DataType: "VARCHAR(100)"},
+		},
+	}
+	cur := &modelcols.SQLModel{
+		Table: "items",
+		Columns: modelcols.SQLColumns{
+			{ColName: "id", DataType: "UUID", NotNull: true, PrimaryKey: true},
+			{ColName: "name", DataType: "VARCHAR(100)", RenamedFrom: "title"},
+		},
+	}
+
+	to := reverseRenames(cur, prev)
+	if prev.Columns[1].RenamedFrom != "" {
+		t.Errorf("history model must not be changed")
+	}
+	pt, err := SQLAlterTablePatch("sh", "items", cur, to, nil, nil, nil, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ALTER TABLE sh.items RENAME COLUMN name TO title"
+	if qs := pt.Queries(); strings.Join(qs, "\n") != want {
+		t.Errorf("wrong queries:\n%s\nwant:\n%s", strings.Join(qs, "\n"), want)
+	}
+}
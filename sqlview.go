@@ -127,9 +127,7 @@ func (mo *SQLView[T]) Values() []interface{} {
 		if fd.Skip {
 			continue
 		}
-		rv := reflect.ValueOf(mo.V).FieldByName(fd.FieldName)
-		v := rv.Interface()
-		ret = append(ret, v)
+		ret = append(ret, fd.readValue(reflect.ValueOf(mo.V)))
 	}
 	return ret
 }
@@ -146,16 +144,27 @@ func (mo *SQLView[T]) Scan(rows sqlx.ColScanner, prefix string) error {
 	if mo.MD == nil {
 		return fmt.Errorf("model description not found for %T", mo.V)
 	}
+	mo.Filled, err = scanModelStruct(rows, mo.MD, reflect.ValueOf(&mo.V).Elem(), prefix, nil)
+	return err
+}
+
+// scanModelStruct scans the row into fields of the addressable model struct rv and returns filled fields,
+// columns from dests are scanned into its values,
+// embed structs referenced by nil pointers are allocated only for not NULL values of its columns
+func scanModelStruct(rows sqlx.ColScanner, md *ModelDesc, rv reflect.Value, prefix string, dests map[string]interface{}) ([]*FieldDescription, error) {
 	cols, err := rows.Columns()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	vals := make([]interface{}, len(cols))
-
-	morv := reflect.ValueOf(&mo.V)
-	mo.Filled = make([]*FieldDescription, 0, len(cols))
+	filled := make([]*FieldDescription, 0, len(cols))
+	ptrs := make(map[*FieldDescription]reflect.Value)
 
 	for i, k := range cols {
+		if d, ok := dests[k]; ok {
+			vals[i] = d
+			continue
+		}
 		cn := k
 		if prefix != "" {
 			if !strings.HasPrefix(strings.ToLower(cn), strings.ToLower(prefix)) {
@@ -164,18 +173,36 @@ func (mo *SQLView[T]) Scan(rows sqlx.ColScanner, prefix string) error {
 			}
 			cn = cn[len(prefix):]
 		}
-		fd, ok := mo.MD.columnByName[cn]
+		fd, ok := md.columnByName[cn]
 		if !ok || fd.Skip {
 			vals[i] = new(interface{})
 			continue
 		}
 
-		vals[i] = morv.Elem().FieldByName(fd.FieldName).Addr().Interface()
+		if fd.embedPtr(rv.Type()) {
+			// NULL сканируется в nil указатель, структура создается после сканирования
+			p := reflect.New(reflect.PointerTo(fieldTypeByPath(rv.Type(), strings.Split(fd.FieldName, "."))))
+			ptrs[fd] = p
+			vals[i] = p.Interface()
+		} else {
+			fv, _ := fd.structValue(rv)
+			vals[i] = fv.Addr().Interface()
+		}
 
-		mo.Filled = append(mo.Filled, fd)
+		filled = append(filled, fd)
 	}
 
-	return rows.Scan(vals...)
+	if err := rows.Scan(vals...); err != nil {
+		return nil, err
+	}
+	for fd, p := range ptrs {
+		if p.Elem().IsNil() {
+			continue
+		}
+		fv, _ := fd.structValue(rv)
+		fv.Set(p.Elem().Elem())
+	}
+	return filled, nil
 }
 
 func (sv *SQLView[T]) JsonView() *JsonView[T] {
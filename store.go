@@ -11,6 +11,7 @@ type (
 type Store struct {
 	modelDescriptions map[TypeName]*ModelDesc
 	queryReplacers    map[sqlPattern]map[string]ReplaceEntry
+	dataMigrations    []DataMigration
 }
 
 func (s *Store) Init() {
@@ -26,6 +27,10 @@ func (s Store) QueryReplacers() map[sqlPattern]map[string]ReplaceEntry {
 	return s.queryReplacers
 }
 
+func (s Store) DataMigrations() []DataMigration {
+	return s.dataMigrations
+}
+
 func (s Store) GetModelDescription(model Modeller) (*ModelDesc, bool) {
 	ret, ok := s.modelDescriptions[model.TypeName()]
 	return ret, ok
@@ -1,9 +1,12 @@
 package pgparty
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"reflect"
 
+	"github.com/covrom/pgparty/utils"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -48,6 +51,41 @@ func (s StructModel[T]) MaterializedView() bool {
 	return isMaterialized
 }
 
+func (s StructModel[T]) Constraints() []ModelConstraint {
+	if c, ok := any(s.M).(Constrainer); ok {
+		return c.Constraints()
+	}
+	return nil
+}
+
+func (s StructModel[T]) Indexes() []ModelIndex {
+	if ix, ok := any(s.M).(Indexer); ok {
+		return ix.Indexes()
+	}
+	return nil
+}
+
+func (s StructModel[T]) DatabaseComment() string {
+	if d, ok := any(s.M).(Describer); ok {
+		return d.DatabaseComment()
+	}
+	return ""
+}
+
+func (s StructModel[T]) Partitioning() ModelPartitioning {
+	if p, ok := any(s.M).(Partitioner); ok {
+		return p.Partitioning()
+	}
+	return ModelPartitioning{}
+}
+
+func (s StructModel[T]) FullTextConfig() string {
+	if c, ok := any(s.M).(FullTextConfigurer); ok {
+		return c.FullTextConfig()
+	}
+	return ""
+}
+
 func (s StructModel[T]) Fields() []FieldDescription {
 	rv, typ := reflStructType(s.M)
 	columns := make([]FieldDescription, 0, typ.NumField())
@@ -76,6 +114,13 @@ func structFields(rv reflect.Value, columns *[]FieldDescription) {
 			continue
 		}
 
+		if prefix, ok := structField.Tag.Lookup(TagEmbed); ok && prefix != "-" {
+			if et := embedStructType(structField.Type); et != nil {
+				embedFields(structField, et, prefix, columns)
+				continue
+			}
+		}
+
 		if v, ok := frv.Interface().(FieldDescriber); ok {
 			*columns = append(*columns, *v.FD())
 		} else if column := NewFDByStructField(structField); column != nil {
@@ -83,3 +128,64 @@ func structFields(rv reflect.Value, columns *[]FieldDescription) {
 		}
 	}
 }
+
+// embedStructType returns the struct type of the field stored in columns with embed tag
+func embedStructType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ.Implements(reflect.TypeOf((*driver.Valuer)(nil)).Elem()) ||
+		reflect.PointerTo(typ).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem()) {
+		return nil
+	}
+	return typ
+}
+
+// embedFields flattens fields of the nested struct to columns with prefix of database names,
+// snake case name of the struct field with underscore by default
+func embedFields(parent reflect.StructField, typ reflect.Type, prefix string, columns *[]FieldDescription) {
+	if len(prefix) == 0 {
+		prefix = ToSnakeCase2(parent.Name) + "_"
+	}
+	pjson := utils.JsonFieldName(parent)
+	skip := parent.Tag.Get(TagStore) == "-"
+
+	var nested []FieldDescription
+	structFields(reflect.New(typ).Elem(), &nested)
+	for _, fd := range nested {
+		fd.FieldName = parent.Name + "." + fd.FieldName
+		if len(fd.DatabaseName) > 0 {
+			fd.DatabaseName = prefix + fd.DatabaseName
+		}
+		// путь поля во вложенном json объекте
+		if len(pjson) > 0 && len(fd.JsonName) > 0 {
+			fd.JsonName = pjson + "." + fd.JsonName
+		} else {
+			fd.JsonName = ""
+			fd.JsonSkip = true
+		}
+		// индексы одной структуры в разных полях модели не должны совпадать
+		fd.Indexes = prefixIndexNames(prefix, fd.Indexes)
+		fd.GinIndexes = prefixIndexNames(prefix, fd.GinIndexes)
+		fd.UniqIndexes = prefixIndexNames(prefix, fd.UniqIndexes)
+		// колонки вложенной структуры не являются служебными полями модели
+		fd.PK = fd.PK && !fd.IsID
+		fd.IsID, fd.IsCreatedAt, fd.IsUpdatedAt, fd.IsDeletedAt = false, false, false, false
+		if parent.Type.Kind() == reflect.Ptr {
+			fd.Nullable = true
+		}
+		fd.Skip = fd.Skip || skip
+		*columns = append(*columns, fd)
+	}
+}
+
+func prefixIndexNames(prefix string, idxs []string) []string {
+	ret := make([]string, 0, len(idxs))
+	for _, idx := range idxs {
+		if len(idx) > 0 {
+			idx = prefix + idx
+		}
+		ret = append(ret, idx)
+	}
+	return ret
+}
@@ -1,17 +1,25 @@
 package pgparty
 
 const (
-	TagSql       = "sql"
-	TagStore     = "store"
-	TagKey       = "key"
-	TagGinKey    = "ginkey"
-	TagLen       = "len"
-	TagDBName    = "db"
-	TagPrec      = "prec"
-	TagDefVal    = "defval"
-	TagFullText  = "fulltext"
-	TagUniqueKey = "unikey"
-	TagPK        = "pk" // `pk:""` - поле входит в первичный ключ, актуально только для новых таблиц
+	TagSql         = "sql"
+	TagStore       = "store"
+	TagKey         = "key"
+	TagGinKey      = "ginkey"
+	TagLen         = "len"
+	TagDBName      = "db"
+	TagPrec        = "prec"
+	TagDefVal      = "defval"
+	TagFullText    = "fulltext" // `fulltext:"true"` или вес `fulltext:"A"` - поле входит в полнотекстовый поиск
+	TagUniqueKey   = "unikey"
+	TagPK          = "pk"           // `pk:""` - поле входит в первичный ключ
+	TagCheck       = "check"        // `check:":Qty > 0"` - ограничение CHECK на колонку
+	TagFK          = "fk"           // `fk:"Model.Field,ondelete=cascade"` - внешний ключ на поле другой модели
+	TagRenamedFrom = "renamed_from" // `renamed_from:"old_col"` - колонка переименована из old_col
+	TagUsing       = "using"        // `using:"VARCHAR->UUID:NULLIF(:Code, '')::uuid"` - приведение значений при смене типа колонки с VARCHAR на UUID
+	TagComment     = "comment"      // `comment:"Order total"` - комментарий колонки в pg_description
+	TagIdentity    = "identity"     // `identity:"always"` или `identity:"by default"` - колонка GENERATED ... AS IDENTITY
+	TagEmbed       = "embed"        // `embed:"addr_"` - поля вложенной структуры хранятся в колонках с префиксом
+	TagGenerated   = "generated"    // `generated:":Price * :Qty"` - вычисляемая колонка GENERATED ALWAYS AS (...) STORED
 
 	IDField        = "ID"
 	CreatedAtField = "CreatedAt"
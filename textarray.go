@@ -0,0 +1,135 @@
+package pgparty
+
+import (
+	"database/sql/driver"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	gob.Register(&TextArray{})
+}
+
+// TextArray is a string slice stored in postgres TEXT[] column,
+// unlike StringArray that is stored as JSONB
+type TextArray []string
+
+func (TextArray) PostgresType() string {
+	return "TEXT[]"
+}
+
+func (TextArray) PostgresDefaultValue() string {
+	return `'{}'`
+}
+
+func (u TextArray) PostgresAllowNull() bool {
+	return false
+}
+
+func (f *TextArray) Scan(value interface{}) error {
+	if value == nil {
+		*f = make([]string, 0)
+		return nil
+	}
+
+	var s string
+	switch val := value.(type) {
+	case []byte:
+		s = string(val)
+	case string:
+		s = val
+	default:
+		return fmt.Errorf("TextArray: can't scan %T", value)
+	}
+	v, err := parseTextArray(s)
+	if err != nil {
+		return err
+	}
+	*f = v
+	return nil
+}
+
+func (f TextArray) Value() (driver.Value, error) {
+	sb := &strings.Builder{}
+	sb.WriteByte('{')
+	for i, s := range f {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('"')
+		sb.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String(), nil
+}
+
+func (f TextArray) MarshalJSON() ([]byte, error) {
+	if f == nil {
+		return []byte("[]"), nil
+	}
+
+	var v []string = f
+
+	return json.Marshal(v)
+}
+
+func (f *TextArray) UnmarshalJSON(b []byte) error {
+	if f == nil {
+		return errors.New("TextArray: UnmarshalJSON on nil pointer")
+	}
+
+	v := make([]string, 0)
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*f = v
+
+	return nil
+}
+
+// parseTextArray parses one-dimensional postgres array literal {a,"b c",NULL}, NULL becomes empty string
+func parseTextArray(s string) ([]string, error) {
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, fmt.Errorf("TextArray: wrong array literal %q", s)
+	}
+	ret := make([]string, 0)
+	body := s[1 : len(s)-1]
+	if len(body) == 0 {
+		return ret, nil
+	}
+	sb := &strings.Builder{}
+	quoted, inQuotes := false, false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\\' && i+1 < len(body):
+			i++
+			sb.WriteByte(body[i])
+		case c == '"':
+			inQuotes = !inQuotes
+			quoted = true
+		case c == ',' && !inQuotes:
+			ret = append(ret, textArrayItem(sb.String(), quoted))
+			sb.Reset()
+			quoted = false
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("TextArray: wrong array literal %q", s)
+	}
+	return append(ret, textArrayItem(sb.String(), quoted)), nil
+}
+
+func textArrayItem(s string, quoted bool) string {
+	if !quoted && strings.EqualFold(s, "NULL") {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,36 @@
+package pgparty
+
+import (
+	"testing"
+)
+
+func TestTextArray(t *testing.T) {
+	a := TextArray{"a", `b "c"`, `d\e`, "f,g", ""}
+	v, err := a.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b TextArray
+	if err := b.Scan([]byte(v.(string))); err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != len(a) {
+		t.Fatalf("wrong scanned array: %q", b)
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Errorf("item %d: %q != %q", i, b[i], a[i])
+		}
+	}
+
+	// postgres не берет в кавычки простые значения
+	if err := b.Scan("{x,NULL,\"NULL\"}"); err != nil || len(b) != 3 || b[0] != "x" || b[1] != "" || b[2] != "NULL" {
+		t.Errorf("wrong scanned literal: %q, %v", b, err)
+	}
+	if err := b.Scan("{}"); err != nil || len(b) != 0 {
+		t.Errorf("wrong scanned empty array: %q, %v", b, err)
+	}
+	if err := b.Scan("x"); err == nil {
+		t.Errorf("wrong literal must fail")
+	}
+}
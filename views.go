@@ -0,0 +1,222 @@
+package pgparty
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ViewQueryModels returns type names of models referenced as &Model in the view query
+func (md *ModelDesc) ViewQueryModels() []TypeName {
+	var ret []TypeName
+	q := md.viewQuery
+	for i := 0; i < len(q); i++ {
+		if q[i] != '&' {
+			continue
+		}
+		j := i + 1
+		for j < len(q) && (q[j] == '_' || (q[j] >= '0' && q[j] <= '9') ||
+			(q[j] >= 'A' && q[j] <= 'Z') || (q[j] >= 'a' && q[j] <= 'z')) {
+			j++
+		}
+		if nm := q[i+1 : j]; len(nm) > 0 && nm != "CURRSCHEMA" && TypeName(nm) != md.TypeName() {
+			ret = UniqAdd(ret, TypeName(nm))
+		}
+		i = j - 1
+	}
+	return ret
+}
+
+// MaterializedViewOrder returns materialized views of the store so that a view is refreshed after views it reads
+func MaterializedViewOrder(mds map[TypeName]*ModelDesc) []*ModelDesc {
+	ret := make([]*ModelDesc, 0)
+	visited := make(map[TypeName]bool, len(mds))
+
+	var visit func(md *ModelDesc)
+	visit = func(md *ModelDesc) {
+		if visited[md.TypeName()] {
+			return
+		}
+		visited[md.TypeName()] = true
+		for _, dep := range md.ViewQueryModels() {
+			if depmd, ok := mds[dep]; ok {
+				visit(depmd)
+			}
+		}
+		if md.IsMaterialized() {
+			ret = append(ret, md)
+		}
+	}
+
+	for _, md := range SortedModelDescriptions(mds) {
+		visit(md)
+	}
+	return ret
+}
+
+func RefreshView[T Modeller](ctx context.Context, concurrently bool) error {
+	s, err := ShardFromContext(ctx)
+	if err != nil {
+		_, file, no, ok := runtime.Caller(1)
+		if ok {
+			log.Printf("RefreshView error at %s line %d: %s", file, no, err)
+		}
+		return fmt.Errorf("RefreshView: %w", err)
+	}
+	md, ok := s.Store.GetModelDescription(*new(T))
+	if !ok {
+		return fmt.Errorf("RefreshView error: cant't get model description for %T in schema %q", *new(T), s.Store.Schema())
+	}
+	return s.Store.RefreshView(ctx, md, concurrently)
+}
+
+// RefreshView refreshes the materialized view,
+// concurrent refresh requires unique index on columns of the view without expressions and predicate
+func (sr *PgStore) RefreshView(ctx context.Context, md *ModelDesc, concurrently bool) error {
+	if !md.IsMaterialized() {
+		return fmt.Errorf("RefreshView: %s is not a materialized view", md.TypeName())
+	}
+	return sr.WithTx(ctx, func(stx *PgStore) error {
+		q := "REFRESH MATERIALIZED VIEW "
+		if concurrently {
+			ok := false
+			if err := stx.tx.GetContext(ctx, &ok, `select exists(
+				select 1 from pg_index as idx
+				join pg_class as t on t.oid = idx.indrelid
+				join pg_namespace as ns on ns.oid = t.relnamespace
+				where ns.nspname = $1 and t.relname = $2
+				and idx.indisunique and idx.indisvalid and idx.indpred is null and idx.indexprs is null)`,
+				stx.Schema(), md.DatabaseName()); err != nil {
+				return fmt.Errorf("RefreshView %s: %w", md.DatabaseName(), err)
+			}
+			if !ok {
+				return fmt.Errorf("RefreshView %s: concurrent refresh requires unique index on columns without expressions and predicate",
+					md.DatabaseName())
+			}
+			q += "CONCURRENTLY "
+		}
+		q += stx.Schema() + "." + md.DatabaseName()
+		if IsLoggingQuery(ctx) {
+			log.Println(q)
+		}
+		if _, err := stx.tx.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("RefreshView %s: %w", md.DatabaseName(), err)
+		}
+		return nil
+	})
+}
+
+func (s Shard) RefreshViews(ctx context.Context, concurrently bool) error {
+	return s.Store.RefreshViews(WithShard(ctx, s), concurrently)
+}
+
+// RefreshViews refreshes all materialized views of the store in order of their dependencies,
+// each view in its own transaction
+func (sr *PgStore) RefreshViews(ctx context.Context, concurrently bool) error {
+	for _, md := range MaterializedViewOrder(sr.ModelDescriptions()) {
+		if err := sr.RefreshView(ctx, md, concurrently); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ViewRefreshConfig configures background refresh of materialized views of the shard
+type ViewRefreshConfig struct {
+	Interval     time.Duration              // refresh interval of all materialized views
+	Intervals    map[TypeName]time.Duration // refresh intervals of particular views, zero disables the view
+	Concurrently bool
+	OnError      func(shardID string, view TypeName, err error) // errors are logged when nil
+}
+
+func (c ViewRefreshConfig) interval(tn TypeName) time.Duration {
+	if d, ok := c.Intervals[tn]; ok {
+		return d
+	}
+	return c.Interval
+}
+
+// ViewRefresher refreshes materialized views of the shard in background
+type ViewRefresher struct {
+	shard  Shard
+	cfg    ViewRefreshConfig
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// StartViewRefresher runs background refresh of materialized views until Stop or cancel of ctx
+func (s Shard) StartViewRefresher(ctx context.Context, cfg ViewRefreshConfig) *ViewRefresher {
+	ctx, cancel := context.WithCancel(WithShard(ctx, s))
+	r := &ViewRefresher{
+		shard:  s,
+		cfg:    cfg,
+		cancel: cancel,
+	}
+	r.wg.Add(1)
+	go r.run(ctx)
+	return r
+}
+
+func (r *ViewRefresher) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *ViewRefresher) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	// тикаем с минимальным из интервалов
+	var tick time.Duration
+	for _, md := range MaterializedViewOrder(r.shard.Store.ModelDescriptions()) {
+		if d := r.cfg.interval(md.TypeName()); d > 0 && (tick == 0 || d < tick) {
+			tick = d
+		}
+	}
+	if tick == 0 {
+		return
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	last := make(map[TypeName]time.Time)
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.refreshDue(ctx, now, start, last)
+		}
+	}
+}
+
+// refreshDue refreshes views whose interval has passed, in order of dependencies
+func (r *ViewRefresher) refreshDue(ctx context.Context, now, start time.Time, last map[TypeName]time.Time) {
+	for _, md := range MaterializedViewOrder(r.shard.Store.ModelDescriptions()) {
+		d := r.cfg.interval(md.TypeName())
+		if d <= 0 {
+			continue
+		}
+		prev, ok := last[md.TypeName()]
+		if !ok {
+			prev = start
+		}
+		if now.Sub(prev) < d {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		last[md.TypeName()] = now
+		if err := r.shard.Store.RefreshView(ctx, md, r.cfg.Concurrently); err != nil {
+			if r.cfg.OnError != nil {
+				r.cfg.OnError(r.shard.ID, md.TypeName(), err)
+			} else {
+				log.Printf("shard %s: %s", r.shard.ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package pgparty
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/covrom/pgparty/modelcols"
+)
+
+func TestMaterializedViewOrder(t *testing.T) {
+	mds := map[TypeName]*ModelDesc{
+		"Order": {typeName: "Order"},
+		"ShopTotals": {typeName: "ShopTotals", isView: true, isMaterialized: true,
+			viewQuery: `SELECT :ShopTotals.ShopID, sum(:Total) FROM &DayTotals GROUP BY 1`},
+		"DayTotals": {typeName: "DayTotals", isView: true, isMaterialized: true,
+			viewQuery: `SELECT :Order.ShopID, sum(:Order.Total) FROM &CURRSCHEMA.&Order WHERE tags && '{a}' GROUP BY 1`},
+		"AllShops": {typeName: "AllShops", isView: true, isMaterialized: true,
+			viewQuery: `SELECT * FROM &ShopTotals`},
+	}
+
+	if deps := mds["DayTotals"].ViewQueryModels(); len(deps) != 1 || deps[0] != "Order" {
+		t.Errorf("wrong view dependencies: %v", deps)
+	}
+
+	var names []TypeName
+	for _, md := range MaterializedViewOrder(mds) {
+		names = append(names, md.TypeName())
+	}
+	want := []TypeName{"DayTotals", "ShopTotals", "AllShops"}
+	if len(names) != len(want) {
+		t.Fatalf("wrong views: %v", names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("wrong refresh order: %v, want %v", names, want)
+			break
+		}
+	}
+}
+
+func TestMigrationOrderViews(t *testing.T) {
+	mds := map[TypeName]*ModelDesc{
+		"Shop": {typeName: "Shop", storeName: "shops"},
+		"Order": {typeName: "Order", storeName: "orders",
+			columnPtrs: []*FieldDescription{{FieldName: "ShopID", ForeignKey: "Shop.ID"}}},
+		"DayTotals": {typeName: "DayTotals", storeName: "a_day_totals", isView: true, isMaterialized: true,
+			viewQuery: `SELECT :Order.ShopID FROM &Order`},
+		"ShopTotals": {typeName: "ShopTotals", storeName: "a_shop_totals", isView: true,
+			viewQuery: `SELECT * FROM &DayTotals JOIN &Shop USING (id)`},
+	}
+	order, err := MigrationOrder(mds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []TypeName
+	for _, md := range order {
+		names = append(names, md.TypeName())
+	}
+	want := []TypeName{"Shop", "Order", "DayTotals", "ShopTotals"}
+	for i := range want {
+		if i >= len(names) || names[i] != want[i] {
+			t.Fatalf("wrong migration order: %v, want %v", names, want)
+		}
+	}
+
+	deps := DependentViews(order, "Order")
+	if len(deps) != 2 || deps[0].TypeName() != "DayTotals" || deps[1].TypeName() != "ShopTotals" {
+		t.Errorf("wrong dependent views: %v", deps)
+	}
+
+	// изменение представления удаляет зависимые и пересоздает их позже
+	sr := NewPgStore(nil, "sh")
+	recreate := make(map[TypeName]bool)
+	mp := sr.planDependentViews(order, recreate, mds["DayTotals"], ModelPlan{
+		Action: MigrationActionAlter,
+		Steps:  PatchSteps{{Kind: StepDropView, SQL: "DROP MATERIALIZED VIEW IF EXISTS sh.a_day_totals"}},
+	})
+	if mp.Steps[0].SQL != "DROP VIEW IF EXISTS sh.a_shop_totals" || !recreate["ShopTotals"] {
+		t.Errorf("dependent view is not dropped: %v", mp.Steps)
+	}
+	stored := &modelcols.SQLModel{Table: "a_shop_totals", IsView: true, ViewQuery: "SELECT 1"}
+	mp = sr.planDependentViews(order, recreate, mds["ShopTotals"], ModelPlan{
+		Action: MigrationActionNone, From: stored, To: stored,
+	})
+	if mp.Action != MigrationActionAlter || mp.Steps[len(mp.Steps)-1].SQL != "CREATE OR REPLACE VIEW sh.a_shop_totals AS SELECT 1" {
+		t.Errorf("dependent view is not recreated: %v", mp.Steps)
+	}
+
+	// изменение колонок таблицы удаляет представления, которые ее читают
+	for _, st := range []PatchStep{
+		{Kind: StepRenameColumn, SQL: "ALTER TABLE sh.orders RENAME COLUMN shop TO shop_id"},
+		{Kind: StepDropColumn, SQL: "ALTER TABLE sh.orders DROP COLUMN shop"},
+		{Kind: StepAlterTable, TypeChange: TypeChangeRewrite, SQL: "ALTER TABLE sh.orders ALTER COLUMN shop_id TYPE bigint"},
+	} {
+		recreate = make(map[TypeName]bool)
+		mp = sr.planDependentViews(order, recreate, mds["Order"], ModelPlan{
+			Action: MigrationActionAlter, Steps: PatchSteps{st},
+		})
+		if len(mp.Steps) != 3 || mp.Steps[0].SQL != "DROP VIEW IF EXISTS sh.a_shop_totals" ||
+			mp.Steps[1].SQL != "DROP MATERIALIZED VIEW IF EXISTS sh.a_day_totals" || mp.Steps[2] != st ||
+			!recreate["DayTotals"] || !recreate["ShopTotals"] {
+			t.Errorf("dependent views of the table are not dropped before %s: %v", st.Kind, mp.Steps)
+		}
+	}
+	recreate = make(map[TypeName]bool)
+	mp = sr.planDependentViews(order, recreate, mds["Order"], ModelPlan{
+		Action: MigrationActionAlter,
+		Steps:  PatchSteps{{Kind: StepAlterTable, SQL: "ALTER TABLE sh.orders ALTER COLUMN shop_id SET NOT NULL"}},
+	})
+	if len(mp.Steps) != 1 || len(recreate) != 0 {
+		t.Errorf("views must not be dropped without column changes: %v", mp.Steps)
+	}
+
+	// удаленное представление с новыми комментариями создается заново
+	recreate = map[TypeName]bool{"ShopTotals": true}
+	commented := *stored
+	commented.Comment = "totals"
+	mp = sr.planDependentViews(order, recreate, mds["ShopTotals"], ModelPlan{
+		Action: MigrationActionAlter, From: stored, To: &commented,
+		Steps: SQLAlterViewPatch("sh", "a_shop_totals", stored, &commented, nil).Steps(),
+	})
+	if len(mp.Steps.OfKind(StepCreateView)) != 1 || len(mp.Steps.OfKind(StepComment)) != 1 {
+		t.Errorf("dropped view is not recreated with comments: %v", mp.Steps)
+	}
+
+	mds["Shop"].isView = true
+	mds["Shop"].viewQuery = `SELECT * FROM &ShopTotals`
+	var cerr ErrorModelDependencyCycle
+	if _, err := MigrationOrder(mds); !errors.As(err, &cerr) {
+		t.Errorf("cycle is not detected: %v", err)
+	}
+}